@@ -0,0 +1,141 @@
+package hmac
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// nonceSize is the number of random bytes in the nonce of a signature.
+const nonceSize = 16
+
+// Signer calculates VERACODE-HMAC-SHA-256 Authorization headers for a pair of API credentials. The credentials are
+// parsed once when the Signer is created. A Signer is safe for concurrent use.
+type Signer struct {
+	apiKeyID string
+	secret   []byte
+	now      func() time.Time
+	nonces   io.Reader
+}
+
+// SignerOption configures a Signer.
+type SignerOption func(*Signer)
+
+// WithSignerClock sets the function that the Signer uses to get the timestamp of a signature. The default is
+// time.Now.
+func WithSignerClock(now func() time.Time) SignerOption {
+	return func(s *Signer) {
+		s.now = now
+	}
+}
+
+// WithNonceSource sets the reader that the Signer reads the random nonce of a signature from. The default is
+// crypto/rand.Reader.
+//
+// Together with WithSignerClock, it allows tests to produce deterministic signatures. The reader must be safe for
+// concurrent use if the Signer is used concurrently.
+func WithNonceSource(r io.Reader) SignerOption {
+	return func(s *Signer) {
+		s.nonces = r
+	}
+}
+
+// NewSigner returns a Signer for the provided API credentials. The region prefix of the credentials, for example
+// "vera01ei-", is removed.
+func NewSigner(apiKeyID, apiKeySecret string, opts ...SignerOption) (*Signer, error) {
+	secret, err := hex.DecodeString(removeRegion(apiKeySecret))
+	if err != nil {
+		return nil, fmt.Errorf("API key secret is not hex encoded: %w", err)
+	}
+
+	s := &Signer{
+		apiKeyID: removeRegion(apiKeyID),
+		secret:   secret,
+		now:      time.Now,
+		nonces:   rand.Reader,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s, nil
+}
+
+// APIKeyID returns the API key ID of the Signer, without the region prefix.
+func (s *Signer) APIKeyID() string {
+	return s.apiKeyID
+}
+
+// AuthorizationHeader returns the value of the Authorization header for a request with the provided URL and method.
+func (s *Signer) AuthorizationHeader(u *url.URL, httpMethod string) (string, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(s.nonces, nonce); err != nil {
+		return "", fmt.Errorf("could not generate nonce: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(s.now().UnixMilli(), 10)
+	data := fmt.Sprintf(dataFormat, s.apiKeyID, u.Hostname(), u.RequestURI(), httpMethod)
+	dataSignature := calculateSignature(s.secret, nonce, []byte(timestamp), []byte(data))
+
+	return fmt.Sprintf(headerFormat, veracodeHMACSHA256, s.apiKeyID, timestamp, nonce, dataSignature), nil
+}
+
+// Sign sets the Authorization header of req. Any existing Authorization header is replaced.
+func (s *Signer) Sign(req *http.Request) error {
+	header, err := s.AuthorizationHeader(req.URL, req.Method)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", header)
+	return nil
+}
+
+// Transport is an http.RoundTripper that signs every request with a Signer before sending it using the base
+// http.RoundTripper.
+type Transport struct {
+	base   http.RoundTripper
+	signer *Signer
+}
+
+// NewTransport returns a Transport that signs requests with signer and sends them using base. If base is nil,
+// http.DefaultTransport is used.
+//
+// It allows any http.Client to call Veracode APIs, for example:
+//
+//	signer, err := hmac.NewSigner(apiKeyID, apiKeySecret)
+//	if err != nil {
+//		return err
+//	}
+//
+//	client := &http.Client{Transport: hmac.NewTransport(nil, signer)}
+func NewTransport(base http.RoundTripper, signer *Signer) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &Transport{base: base, signer: signer}
+}
+
+// RoundTrip is required to implement the http.RoundTripper interface.
+//
+// The request is cloned before it is signed, because a RoundTripper must not modify the request. Every call, such as
+// a redirect or a retry, is signed with a new nonce and timestamp.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+
+	if err := t.signer.Sign(r); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	return t.base.RoundTrip(r)
+}
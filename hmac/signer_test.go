@@ -0,0 +1,148 @@
+package hmac
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// deterministicSigner returns a Signer with a fixed clock and nonce source.
+func deterministicSigner(t *testing.T, apiKeyID, apiKeySecret string) *Signer {
+	t.Helper()
+
+	nonce := []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f}
+
+	signer, err := NewSigner(apiKeyID, apiKeySecret,
+		WithSignerClock(func() time.Time { return time.UnixMilli(1700000000000) }),
+		WithNonceSource(bytes.NewReader(bytes.Repeat(nonce, 10))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func TestSigner_Golden(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		want   string
+	}{
+		{
+			name:   "GET with query",
+			method: http.MethodGet,
+			url:    "https://api.veracode.com/api/authn/v2/users?page=1",
+			want:   "VERACODE-HMAC-SHA-256 id=3ddaeeb10ca690df3fee5e3bd1c329fa,ts=1700000000000,nonce=000102030405060708090A0B0C0D0E0F,sig=5A852E98FCBA86699C6FD24C2823AC9FFB8C3360CBA14BF88ED15C1F366406CA",
+		},
+		{
+			name:   "POST",
+			method: http.MethodPost,
+			url:    "https://api.veracode.com/appsec/v1/applications",
+			want:   "VERACODE-HMAC-SHA-256 id=3ddaeeb10ca690df3fee5e3bd1c329fa,ts=1700000000000,nonce=000102030405060708090A0B0C0D0E0F,sig=2572E3AA5F8E5A763DC8ED957EB9DDF5412907C9316738094C54D4D35FB4D19D",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+
+			// The region prefix must not change the signature.
+			for _, prefix := range []string{"", "vera01ei-"} {
+				got, err := deterministicSigner(t, prefix+testKeyID, prefix+testSecret).AuthorizationHeader(u, tt.method)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got != tt.want {
+					t.Errorf("prefix %q:\ngot:  %s\nwant: %s", prefix, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewSigner_InvalidSecret(t *testing.T) {
+	if _, err := NewSigner(testKeyID, "not-hex"); err == nil {
+		t.Error("expected an error for a secret that is not hex encoded")
+	}
+}
+
+func TestSigner_NonceSourceError(t *testing.T) {
+	signer, err := NewSigner(testKeyID, testSecret, WithNonceSource(bytes.NewReader(nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse("https://api.veracode.com/api/authn/v2/roles")
+	if _, err := signer.AuthorizationHeader(u, http.MethodGet); err == nil {
+		t.Error("expected an error when the nonce source is exhausted")
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestTransport(t *testing.T) {
+	nonces := NewMemoryNonceCache()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := Verify(r, testLookup, WithNonceCache(nonces)); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	signer, err := NewSigner(testKeyID, testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{Transport: NewTransport(nil, signer)}
+
+	// Every request is signed with a new nonce.
+	for range 3 {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/appsec/v1/applications?name=a%2Fb", nil)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("got status %d, expected 200", resp.StatusCode)
+		}
+
+		if req.Header.Get("Authorization") != "" {
+			t.Fatal("the transport modified the caller's request")
+		}
+	}
+}
+
+func TestTransport_SignError(t *testing.T) {
+	signer, err := NewSigner(testKeyID, testSecret, WithNonceSource(bytes.NewReader(nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var called bool
+	transport := NewTransport(roundTripFunc(func(*http.Request) (*http.Response, error) {
+		called = true
+		return nil, errors.New("unexpected call")
+	}), signer)
+
+	req := httptest.NewRequest(http.MethodGet, "https://api.veracode.com/api/authn/v2/roles", nil)
+	if _, err := transport.RoundTrip(req); err == nil {
+		t.Error("expected an error")
+	}
+
+	if called {
+		t.Error("the base transport was called with an unsigned request")
+	}
+}
@@ -2,14 +2,9 @@ package hmac
 
 import (
 	"crypto/hmac"
-	"crypto/rand"
 	"crypto/sha256"
-	"encoding/hex"
-	"fmt"
 	"net/url"
-	"strconv"
 	"strings"
-	"time"
 )
 
 const (
@@ -19,21 +14,6 @@ const (
 	veracodeHMACSHA256           = "VERACODE-HMAC-SHA-256"
 )
 
-func currentTimestamp() int64 {
-	return time.Now().UnixMilli()
-}
-
-func generateNonce(size int) ([]byte, error) {
-	nonce := make([]byte, size)
-	_, err := rand.Read(nonce)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return nonce, nil
-}
-
 func hmac256(message, key []byte) []byte {
 	sha := hmac.New(sha256.New, key)
 	sha.Write(message)
@@ -56,24 +36,14 @@ func calculateSignature(key, nonce, timestamp, data []byte) []byte {
 }
 
 // Returns the value for the Authorization header that must be added to requests
+//
+// CalculateAuthorizationHeader parses the credentials on every call. Use a [Signer] to sign multiple requests with
+// the same credentials.
 func CalculateAuthorizationHeader(url *url.URL, httpMethod, apiKeyID, apiKeySecret string) (string, error) {
-	apiKeyID = removeRegion(apiKeyID)
-	apiKeySecret = removeRegion(apiKeySecret)
-	nonce, err := generateNonce(16)
-
+	signer, err := NewSigner(apiKeyID, apiKeySecret)
 	if err != nil {
 		return "", err
 	}
 
-	secret, err := hex.DecodeString(apiKeySecret)
-
-	if err != nil {
-		return "", err
-	}
-
-	timestamp := strconv.FormatInt(currentTimestamp(), 10)
-	data := fmt.Sprintf(dataFormat, apiKeyID, url.Hostname(), url.RequestURI(), httpMethod)
-	dataSignature := calculateSignature(secret, nonce, []byte(timestamp), []byte(data))
-
-	return fmt.Sprintf(headerFormat, veracodeHMACSHA256, apiKeyID, timestamp, nonce, dataSignature), nil
+	return signer.AuthorizationHeader(url, httpMethod)
 }
@@ -0,0 +1,242 @@
+package hmac
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidAuthorization is returned for Authorization headers that are missing or malformed.
+	ErrInvalidAuthorization = errors.New("invalid VERACODE-HMAC-SHA-256 authorization header")
+
+	// ErrUnknownKey is returned if the key lookup does not know the API key ID of a request.
+	ErrUnknownKey = errors.New("unknown API key ID")
+
+	// ErrTimestampSkew is returned if the timestamp of a request is outside of the allowed window.
+	ErrTimestampSkew = errors.New("request timestamp is outside of the allowed window")
+
+	// ErrNonceReused is returned if the nonce of a request has already been used.
+	ErrNonceReused = errors.New("request nonce has already been used")
+
+	// ErrSignatureMismatch is returned if the signature of a request is not valid.
+	ErrSignatureMismatch = errors.New("request signature does not match")
+)
+
+// DefaultMaxSkew is the default maximum difference between the timestamp of a request and the current time.
+const DefaultMaxSkew = 5 * time.Minute
+
+// Authorization contains the fields of a VERACODE-HMAC-SHA-256 Authorization header.
+type Authorization struct {
+	ID        string    // API key ID, without the region prefix.
+	Timestamp time.Time // Time at which the request was signed, with millisecond precision.
+	Nonce     []byte
+	Signature []byte
+}
+
+// ParseAuthorizationHeader parses the value of a VERACODE-HMAC-SHA-256 Authorization header, for example:
+//
+//	VERACODE-HMAC-SHA-256 id=3ddaeeb10ca690df3fee5e3bd1c329fa,ts=1700000000000,nonce=0A1B...,sig=9C8D...
+func ParseAuthorizationHeader(header string) (Authorization, error) {
+	scheme, params, _ := strings.Cut(header, " ")
+	if scheme != veracodeHMACSHA256 {
+		return Authorization{}, fmt.Errorf("%w: scheme must be %s", ErrInvalidAuthorization, veracodeHMACSHA256)
+	}
+
+	fields := make(map[string]string)
+	for _, param := range strings.Split(params, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok {
+			return Authorization{}, fmt.Errorf("%w: malformed parameter %q", ErrInvalidAuthorization, param)
+		}
+		fields[key] = value
+	}
+
+	for _, key := range []string{"id", "ts", "nonce", "sig"} {
+		if fields[key] == "" {
+			return Authorization{}, fmt.Errorf("%w: missing parameter %q", ErrInvalidAuthorization, key)
+		}
+	}
+
+	ts, err := strconv.ParseInt(fields["ts"], 10, 64)
+	if err != nil {
+		return Authorization{}, fmt.Errorf("%w: timestamp is not a number", ErrInvalidAuthorization)
+	}
+
+	nonce, err := hex.DecodeString(fields["nonce"])
+	if err != nil {
+		return Authorization{}, fmt.Errorf("%w: nonce is not hex encoded", ErrInvalidAuthorization)
+	}
+
+	sig, err := hex.DecodeString(fields["sig"])
+	if err != nil {
+		return Authorization{}, fmt.Errorf("%w: signature is not hex encoded", ErrInvalidAuthorization)
+	}
+
+	return Authorization{
+		ID:        fields["id"],
+		Timestamp: time.UnixMilli(ts),
+		Nonce:     nonce,
+		Signature: sig,
+	}, nil
+}
+
+// KeyLookup returns the API key secret of an API key ID. It should return an error that wraps ErrUnknownKey if the
+// API key ID is not known.
+type KeyLookup func(apiKeyID string) (apiKeySecret string, err error)
+
+// NonceCache records the nonces of verified requests, so that replayed requests can be rejected. See WithNonceCache.
+type NonceCache interface {
+	// Add records the nonce of the API key ID and reports whether it was added. It must return false if the nonce
+	// has already been recorded. The nonce only needs to be kept until expires, after which a replayed request is
+	// rejected because of its timestamp.
+	//
+	// now is the time of the verification, as returned by the clock of Verify (see WithClock). It should be used
+	// instead of the wall clock to decide whether a recorded nonce has expired.
+	Add(apiKeyID, nonce string, now, expires time.Time) bool
+}
+
+// VerifyOption configures Verify.
+type VerifyOption func(*verifyConfig)
+
+type verifyConfig struct {
+	maxSkew time.Duration
+	nonces  NonceCache
+	now     func() time.Time
+}
+
+// WithMaxSkew sets the maximum difference between the timestamp of a request and the current time. The default is
+// DefaultMaxSkew.
+func WithMaxSkew(d time.Duration) VerifyOption {
+	return func(cfg *verifyConfig) {
+		cfg.maxSkew = d
+	}
+}
+
+// WithNonceCache makes Verify reject requests whose nonce has already been used. Without a NonceCache, a request can
+// be replayed until its timestamp is outside of the allowed window.
+func WithNonceCache(cache NonceCache) VerifyOption {
+	return func(cfg *verifyConfig) {
+		cfg.nonces = cache
+	}
+}
+
+// WithClock sets the function that Verify uses to get the current time. The default is time.Now.
+func WithClock(now func() time.Time) VerifyOption {
+	return func(cfg *verifyConfig) {
+		cfg.now = now
+	}
+}
+
+// Verify checks the VERACODE-HMAC-SHA-256 signature in the Authorization header of req and returns the parsed
+// header. The request can either be a request that was received by a server or a request that was signed by a client.
+//
+// The returned error wraps ErrInvalidAuthorization, ErrUnknownKey, ErrTimestampSkew, ErrNonceReused or
+// ErrSignatureMismatch, or an error returned by keyLookup.
+func Verify(req *http.Request, keyLookup KeyLookup, opts ...VerifyOption) (Authorization, error) {
+	cfg := verifyConfig{maxSkew: DefaultMaxSkew, now: time.Now}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	auth, err := ParseAuthorizationHeader(req.Header.Get("Authorization"))
+	if err != nil {
+		return Authorization{}, err
+	}
+
+	now := cfg.now()
+	if skew := now.Sub(auth.Timestamp).Abs(); skew > cfg.maxSkew {
+		return auth, fmt.Errorf("%w: timestamp %s differs by %s", ErrTimestampSkew, auth.Timestamp.UTC().Format(time.RFC3339), skew.Round(time.Second))
+	}
+
+	apiKeySecret, err := keyLookup(auth.ID)
+	if err != nil {
+		return auth, err
+	}
+
+	secret, err := hex.DecodeString(removeRegion(apiKeySecret))
+	if err != nil {
+		return auth, fmt.Errorf("API key secret of %s is not hex encoded: %w", auth.ID, err)
+	}
+
+	timestamp := strconv.FormatInt(auth.Timestamp.UnixMilli(), 10)
+	data := fmt.Sprintf(dataFormat, auth.ID, requestHost(req), req.URL.RequestURI(), req.Method)
+
+	if !hmac.Equal(auth.Signature, calculateSignature(secret, auth.Nonce, []byte(timestamp), []byte(data))) {
+		return auth, ErrSignatureMismatch
+	}
+
+	// The nonce is only recorded for valid signatures, so that unauthenticated requests cannot fill the cache.
+	if cfg.nonces != nil && !cfg.nonces.Add(auth.ID, hex.EncodeToString(auth.Nonce), now, auth.Timestamp.Add(cfg.maxSkew)) {
+		return auth, ErrNonceReused
+	}
+
+	return auth, nil
+}
+
+// requestHost returns the host name, without the port, that the signature of req covers.
+func requestHost(req *http.Request) string {
+	if host := req.URL.Hostname(); host != "" {
+		return host
+	}
+
+	if host, _, err := net.SplitHostPort(req.Host); err == nil {
+		return host
+	}
+	return req.Host
+}
+
+// MemoryNonceCache is a NonceCache that keeps the nonces in memory. It is safe for concurrent use.
+type MemoryNonceCache struct {
+	mu      sync.Mutex
+	nonces  map[string]time.Time
+	lastGC  time.Time
+	gcEvery time.Duration
+}
+
+// NewMemoryNonceCache returns a new MemoryNonceCache.
+func NewMemoryNonceCache() *MemoryNonceCache {
+	return &MemoryNonceCache{
+		nonces:  make(map[string]time.Time),
+		gcEvery: time.Minute,
+	}
+}
+
+// Add is required to implement the NonceCache interface.
+func (c *MemoryNonceCache) Add(apiKeyID, nonce string, now, expires time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Expired nonces are removed at most every gcEvery, so that Add does not scan the cache on every call.
+	if now.Sub(c.lastGC) >= c.gcEvery {
+		for key, exp := range c.nonces {
+			if now.After(exp) {
+				delete(c.nonces, key)
+			}
+		}
+		c.lastGC = now
+	}
+
+	key := apiKeyID + ":" + nonce
+	if exp, ok := c.nonces[key]; ok && !now.After(exp) {
+		return false
+	}
+
+	c.nonces[key] = expires
+	return true
+}
+
+// Len returns the number of nonces in the cache, including expired nonces that have not been removed yet.
+func (c *MemoryNonceCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.nonces)
+}
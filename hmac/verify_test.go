@@ -0,0 +1,214 @@
+package hmac
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testKeyID  = "3ddaeeb10ca690df3fee5e3bd1c329fa"
+	testSecret = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+)
+
+func testLookup(apiKeyID string) (string, error) {
+	if apiKeyID != testKeyID {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, apiKeyID)
+	}
+	return testSecret, nil
+}
+
+// signedRequest returns a request that is signed with the credentials.
+func signedRequest(t *testing.T, method, target, keyID, secret string) *http.Request {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, nil)
+
+	header, err := CalculateAuthorizationHeader(req.URL, req.Method, keyID, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Authorization", header)
+	return req
+}
+
+func TestVerify(t *testing.T) {
+	tampered := func(req *http.Request) { req.URL.RawQuery = "page=2" }
+
+	tests := []struct {
+		name    string
+		keyID   string
+		secret  string
+		modify  func(req *http.Request)
+		opts    []VerifyOption
+		wantErr error
+	}{
+		{name: "valid", keyID: testKeyID, secret: testSecret},
+		{name: "valid with region prefix", keyID: "vera01ei-" + testKeyID, secret: "vera01ei-" + testSecret},
+		{name: "wrong secret", keyID: testKeyID, secret: strings.Repeat("0", 128), wantErr: ErrSignatureMismatch},
+		{name: "tampered query", keyID: testKeyID, secret: testSecret, modify: tampered, wantErr: ErrSignatureMismatch},
+		{name: "tampered method", keyID: testKeyID, secret: testSecret, modify: func(req *http.Request) { req.Method = http.MethodDelete }, wantErr: ErrSignatureMismatch},
+		{name: "unknown key", keyID: "00000000000000000000000000000000", secret: testSecret, wantErr: ErrUnknownKey},
+		{name: "missing header", modify: func(req *http.Request) { req.Header.Del("Authorization") }, keyID: testKeyID, secret: testSecret, wantErr: ErrInvalidAuthorization},
+		{
+			name:    "clock skew",
+			keyID:   testKeyID,
+			secret:  testSecret,
+			opts:    []VerifyOption{WithClock(func() time.Time { return time.Now().Add(10 * time.Minute) })},
+			wantErr: ErrTimestampSkew,
+		},
+		{
+			name:   "clock skew within window",
+			keyID:  testKeyID,
+			secret: testSecret,
+			opts:   []VerifyOption{WithClock(func() time.Time { return time.Now().Add(10 * time.Minute) }), WithMaxSkew(time.Hour)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := signedRequest(t, http.MethodGet, "https://api.veracode.com/api/authn/v2/users?page=1", tt.keyID, tt.secret)
+			if tt.modify != nil {
+				tt.modify(req)
+			}
+
+			auth, err := Verify(req, testLookup, tt.opts...)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Verify returned %v, expected %v", err, tt.wantErr)
+			}
+
+			if err == nil && auth.ID != testKeyID {
+				t.Errorf("got API key ID %q, expected %q", auth.ID, testKeyID)
+			}
+		})
+	}
+}
+
+func TestVerify_Nonce(t *testing.T) {
+	cache := NewMemoryNonceCache()
+	req := signedRequest(t, http.MethodGet, "https://api.veracode.com/api/authn/v2/roles", testKeyID, testSecret)
+
+	if _, err := Verify(req, testLookup, WithNonceCache(cache)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Verify(req, testLookup, WithNonceCache(cache)); !errors.Is(err, ErrNonceReused) {
+		t.Fatalf("expected ErrNonceReused for a replayed request, got: %v", err)
+	}
+
+	// Requests with invalid signatures do not use up nonces.
+	forged := signedRequest(t, http.MethodGet, "https://api.veracode.com/api/authn/v2/roles", testKeyID, strings.Repeat("0", 128))
+	if _, err := Verify(forged, testLookup, WithNonceCache(cache)); !errors.Is(err, ErrSignatureMismatch) {
+		t.Fatalf("expected ErrSignatureMismatch, got: %v", err)
+	}
+
+	if cache.Len() != 1 {
+		t.Errorf("cache contains %d nonces, expected 1", cache.Len())
+	}
+}
+
+func TestMemoryNonceCache_Expiry(t *testing.T) {
+	cache := NewMemoryNonceCache()
+	cache.gcEvery = 0
+
+	now := time.Now()
+
+	if !cache.Add(testKeyID, "abcd", now, now.Add(-time.Second)) {
+		t.Fatal("expected the nonce to be added")
+	}
+
+	// The expired nonce is removed and can be added again.
+	if !cache.Add(testKeyID, "abcd", now, now.Add(time.Minute)) {
+		t.Fatal("expected the expired nonce to be added again")
+	}
+	if cache.Add(testKeyID, "abcd", now, now.Add(time.Minute)) {
+		t.Fatal("expected the nonce to be rejected")
+	}
+	if cache.Len() != 1 {
+		t.Errorf("cache contains %d nonces, expected 1", cache.Len())
+	}
+}
+
+func TestVerify_NonceWithClock(t *testing.T) {
+	// The clock of the verifier and the signer is an hour behind the wall clock.
+	now := func() time.Time { return time.Now().Add(-time.Hour) }
+
+	signer, err := NewSigner(testKeyID, testSecret, WithSignerClock(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "https://api.veracode.com/api/authn/v2/roles", nil)
+	if err := signer.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewMemoryNonceCache()
+
+	if _, err := Verify(req, testLookup, WithNonceCache(cache), WithClock(now)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Verify(req, testLookup, WithNonceCache(cache), WithClock(now)); !errors.Is(err, ErrNonceReused) {
+		t.Fatalf("expected ErrNonceReused for a replayed request, got: %v", err)
+	}
+}
+
+func TestVerify_Server(t *testing.T) {
+	var verifyErr error
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, verifyErr = Verify(r, testLookup)
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL + "/api/authn/v2/users?user_name=a%20b")
+
+	header, err := CalculateAuthorizationHeader(u, http.MethodGet, testKeyID, testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, u.String(), nil)
+	req.Header.Set("Authorization", header)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if verifyErr != nil {
+		t.Errorf("server failed to verify the request: %v", verifyErr)
+	}
+}
+
+func TestParseAuthorizationHeader(t *testing.T) {
+	auth, err := ParseAuthorizationHeader("VERACODE-HMAC-SHA-256 id=abc,ts=1700000000000,nonce=0A0B,sig=FF00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if auth.ID != "abc" || auth.Timestamp.UnixMilli() != 1700000000000 || string(auth.Nonce) != "\x0a\x0b" || string(auth.Signature) != "\xff\x00" {
+		t.Errorf("unexpected authorization: %+v", auth)
+	}
+
+	for _, header := range []string{
+		"",
+		"Bearer abc",
+		"VERACODE-HMAC-SHA-256 id=abc,ts=1700000000000,nonce=0A0B",
+		"VERACODE-HMAC-SHA-256 id=abc,ts=now,nonce=0A0B,sig=FF00",
+		"VERACODE-HMAC-SHA-256 id=abc,ts=1700000000000,nonce=XYZ,sig=FF00",
+		"VERACODE-HMAC-SHA-256 id=abc,ts,nonce=0A0B,sig=FF00",
+	} {
+		if _, err := ParseAuthorizationHeader(header); !errors.Is(err, ErrInvalidAuthorization) {
+			t.Errorf("ParseAuthorizationHeader(%q) returned %v, expected ErrInvalidAuthorization", header, err)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package veracode
 
 import (
 	"context"
+	"log/slog"
 	"net/http"
 	"time"
 )
@@ -20,6 +21,17 @@ type APICredentials struct {
 	Links          NavLinks `json:"_links"`
 }
 
+// LogValue implements the [slog.LogValuer] interface, so that the API secret is never logged.
+func (a APICredentials) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("api_id", a.ApiId),
+		slog.String("api_secret", redacted),
+		slog.Time("expiration_ts", a.ExpirationTs.Time),
+		slog.String("revocation_user", a.RevocationUser),
+		slog.Time("revocation_ts", a.RevocationTs.Time),
+	)
+}
+
 func (ct *ctime) UnmarshalJSON(b []byte) (err error) {
 	if len(string(b)) < 3 {
 		return nil
@@ -3,10 +3,25 @@ package veracode
 import (
 	"context"
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"time"
 )
 
+// ErrBuildFailed is returned by [UploadXMLService.WaitForBuild] if the analysis of the build did not complete successfully.
+var ErrBuildFailed = errors.New("build analysis failed")
+
+// failedAnalysisStatuses contains the analysis unit statuses after which the results of a build will never be ready.
+var failedAnalysisStatuses = []string{
+	"Pre-Scan Failed",
+	"Pre-Scan Canceled",
+	"Scan Errors",
+	"Scan Canceled",
+	"No Modules Defined",
+}
+
 type BuildList struct {
 	XMLName          xml.Name       `xml:"buildlist"`
 	BuildListVersion string         `xml:"buildlist_version,attr"`
@@ -94,6 +109,53 @@ func (u *UploadXMLService) GetBuildInfo(ctx context.Context, options BuildInfoOp
 	return result, resp, nil
 }
 
+// WaitForBuild polls GetBuildInfo every interval until the results of the build are ready. It returns an error that
+// wraps [ErrBuildFailed] if the analysis of the build failed and the context's error if ctx is done.
+//
+// The returned Response is the Response of the last poll. The interval must be positive.
+func (u *UploadXMLService) WaitForBuild(ctx context.Context, options BuildInfoOptions, interval time.Duration) (BuildInfo, *Response, error) {
+	if interval <= 0 {
+		return BuildInfo{}, nil, fmt.Errorf("poll interval must be positive, got: %s", interval)
+	}
+
+	ctx, span := u.Client.tracer.StartSpan(ctx, "UploadXML.WaitForBuild",
+		Attr("veracode.service", "UploadXML"),
+		Attr("veracode.endpoint", "UploadXML.WaitForBuild"),
+		Attr("veracode.app_id", options.AppId),
+		Attr("veracode.build_id", options.BuildId),
+	)
+	defer span.End()
+
+	for polls := 1; ; polls++ {
+		info, resp, err := u.GetBuildInfo(ctx, options)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				err = ctxErr
+			}
+			span.RecordError(err)
+			return BuildInfo{}, resp, err
+		}
+
+		status := info.Build.AnalysisUnit.Status
+		span.SetAttributes(Attr("veracode.polls", polls), Attr("veracode.build.status", status))
+
+		if info.Build.ResultsReady {
+			return info, resp, nil
+		}
+
+		if slices.Contains(failedAnalysisStatuses, status) {
+			err = fmt.Errorf("%w: build %s has status: %s", ErrBuildFailed, info.BuildId, status)
+			span.RecordError(err)
+			return info, resp, err
+		}
+
+		if err := sleepContext(ctx, interval); err != nil {
+			span.RecordError(err)
+			return info, resp, err
+		}
+	}
+}
+
 func (u *UploadXMLService) GetBuildList(ctx context.Context, options BuildListOptions) (BuildList, *Response, error) {
 	req, err := u.Client.NewRequest(ctx, "/api/5.0/getbuildlist.do", http.MethodGet, nil, true)
 	if err != nil {
@@ -0,0 +1,113 @@
+package veracode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUploadXMLService_WaitForBuild(t *testing.T) {
+	tests := []struct {
+		name      string
+		statuses  []string // Analysis unit status of every poll. The last status is repeated.
+		ready     int      // Poll after which the results are ready, or 0 if they never are.
+		cancel    int      // Poll during which the context is canceled, or 0 if it never is.
+		wantErr   error
+		wantPolls int32
+	}{
+		{
+			name:      "results ready",
+			statuses:  []string{"Scan In Process", "Scan In Process", "Results Ready"},
+			ready:     3,
+			wantPolls: 3,
+		},
+		{
+			name:      "analysis failed",
+			statuses:  []string{"Pre-Scan Submitted", "Pre-Scan Failed"},
+			wantErr:   ErrBuildFailed,
+			wantPolls: 2,
+		},
+		{
+			name:      "context done",
+			statuses:  []string{"Scan In Process"},
+			cancel:    2,
+			wantErr:   context.Canceled,
+			wantPolls: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var polls atomic.Int32
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/5.0/getbuildinfo.do" {
+					http.NotFound(w, r)
+					return
+				}
+
+				poll := int(polls.Add(1))
+				if poll == tt.cancel {
+					cancel()
+				}
+				status := tt.statuses[min(poll, len(tt.statuses))-1]
+
+				w.Header().Set("Content-Type", "text/xml")
+				fmt.Fprintf(w, `<buildinfo app_id="1" build_id="2"><build build_id="2" results_ready="%t"><analysis_unit status="%s"/></build></buildinfo>`,
+					tt.ready != 0 && poll >= tt.ready, status)
+			}))
+			defer server.Close()
+
+			c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			info, _, err := c.UploadXML.WaitForBuild(ctx, BuildInfoOptions{AppId: 1, BuildId: 2}, 5*time.Millisecond)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UploadXMLService.WaitForBuild() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if polls.Load() != tt.wantPolls {
+				t.Errorf("UploadXMLService.WaitForBuild() polled %d times, want %d", polls.Load(), tt.wantPolls)
+			}
+
+			if tt.cancel == 0 {
+				if want := tt.statuses[len(tt.statuses)-1]; info.Build.AnalysisUnit.Status != want {
+					t.Errorf("UploadXMLService.WaitForBuild() status = %q, want %q", info.Build.AnalysisUnit.Status, want)
+				}
+			}
+		})
+	}
+}
+
+func TestUploadXMLService_WaitForBuild_Interval(t *testing.T) {
+	var polls atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		polls.Add(1)
+	}))
+	defer server.Close()
+
+	c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if _, _, err := c.UploadXML.WaitForBuild(context.Background(), BuildInfoOptions{AppId: 1, BuildId: 2}, interval); err == nil {
+			t.Errorf("UploadXMLService.WaitForBuild() with poll interval %s error = nil, want an error", interval)
+		}
+	}
+
+	if n := polls.Load(); n != 0 {
+		t.Errorf("UploadXMLService.WaitForBuild() polled %d times, want 0", n)
+	}
+}
@@ -0,0 +1,526 @@
+package veracode
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheStorage stores the responses that are cached by the Client. See [WithCache].
+//
+// Implementations must be safe for concurrent use. Set is allowed to drop entries, for example to limit the size of
+// the cache.
+type CacheStorage interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+	Delete(key string)
+}
+
+// DefaultCachedEndpoints are the logical endpoint names (see [EndpointName]) that are cached by default. Their data
+// rarely changes.
+//
+// Responses of UploadXML.GetBuildInfo are only cached if they are for a specific build and its results are ready.
+var DefaultCachedEndpoints = []string{
+	"Identity.ListRoles",
+	"Identity.ListBusinessUnits",
+	"Application.ListCustomFields",
+	"UploadXML.GetBuildInfo",
+}
+
+// CacheOptions configures the cache. See [WithCache].
+type CacheOptions struct {
+	// Storage stores the cached responses. The default is an in-memory LRU cache with 1000 entries.
+	Storage CacheStorage
+
+	// TTL is how long responses without an ETag or Last-Modified header are cached. The default is 10 minutes.
+	TTL time.Duration
+
+	// Endpoints are the logical endpoint names of the GET calls that are cached. The default is [DefaultCachedEndpoints].
+	Endpoints []string
+}
+
+// WithCache enables caching of GET calls for endpoints whose data rarely changes.
+//
+// Responses are fresh for the lifetime in their Cache-Control max-age or Expires header. Responses without a lifetime
+// that have an ETag or Last-Modified header are revalidated with a conditional request every time they are used.
+// Other responses are cached for opts.TTL. A 304 Not Modified response to a revalidation updates the headers and the
+// lifetime of the cached response. Responses are cached per API key, so that clients with different credentials never
+// share cached data.
+//
+// A POST, PUT, PATCH or DELETE request invalidates the cached responses of the same resource. The resource of a
+// path is everything before its first ID. For example: a PUT to "/api/authn/v2/roles/{id}" invalidates all cached
+// responses of paths that start with "/api/authn/v2/roles". A request to the XML APIs invalidates all cached
+// responses of the XML APIs.
+func WithCache(opts CacheOptions) ClientOption {
+	return func(cfg *clientConfig) error {
+		if opts.TTL < 0 {
+			return fmt.Errorf("cache ttl must not be negative, got: %s", opts.TTL)
+		}
+
+		if opts.Storage == nil {
+			opts.Storage = NewMemoryCache(1000)
+		}
+		if opts.TTL == 0 {
+			opts.TTL = 10 * time.Minute
+		}
+		if opts.Endpoints == nil {
+			opts.Endpoints = DefaultCachedEndpoints
+		}
+
+		cfg.cache = &opts
+		return nil
+	}
+}
+
+// cacheConditions contains additional conditions that a response of an endpoint has to meet to be cached.
+var cacheConditions = map[string]func(req *http.Request, body []byte) bool{
+	"UploadXML.GetBuildInfo": publishedBuildInfo,
+}
+
+var resultsReadyAttr = regexp.MustCompile(`\sresults_ready="true"`)
+
+// publishedBuildInfo reports whether a getbuildinfo.do response is for a specific build whose results are ready.
+// The information of such builds no longer changes.
+func publishedBuildInfo(req *http.Request, body []byte) bool {
+	return req.URL.Query().Get("build_id") != "" && resultsReadyAttr.Match(body)
+}
+
+// cacheEntry is a cached response, as it is stored in the CacheStorage.
+type cacheEntry struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	Stored     time.Time   `json:"stored"`  // Time at which the request of the response was sent.
+	Expires    time.Time   `json:"expires"` // Zero if the response has to be revalidated.
+}
+
+func (e *cacheEntry) hasValidators() bool {
+	return e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != ""
+}
+
+// update merges the headers of a 304 Not Modified response into the entry and recalculates its expiration time for a
+// request that was sent at start. The Content-Length of the entry is kept, because a 304 response has no body.
+func (e *cacheEntry) update(header http.Header, start time.Time, ttl time.Duration) {
+	for name, values := range header {
+		if name != "Content-Length" {
+			e.Header[name] = slices.Clone(values)
+		}
+	}
+
+	e.Stored = start
+	e.Expires = time.Time{}
+
+	if lifetime, ok := freshnessLifetime(e.Header); ok {
+		e.Expires = start.Add(lifetime)
+	} else if !e.hasValidators() {
+		e.Expires = start.Add(ttl)
+	}
+}
+
+var maxAgeDirective = regexp.MustCompile(`(?:^|,)\s*max-age\s*=\s*"?(\d+)"?`)
+
+// freshnessLifetime returns how long a response with header is fresh, based on its Cache-Control max-age directive or
+// its Expires header. It returns false if the header does not specify a lifetime or if the response must always be
+// revalidated.
+func freshnessLifetime(header http.Header) (time.Duration, bool) {
+	cacheControl := strings.ToLower(strings.Join(header.Values("Cache-Control"), ","))
+	if strings.Contains(cacheControl, "no-cache") {
+		return 0, false
+	}
+
+	if m := maxAgeDirective.FindStringSubmatch(cacheControl); m != nil {
+		seconds, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if expires := header.Get("Expires"); expires != "" {
+		at, err := http.ParseTime(expires)
+		if err != nil {
+			// An invalid Expires header means that the response is already stale.
+			return 0, true
+		}
+
+		// The lifetime is relative to the Date header, so that the clocks of the client and the server do not need to
+		// be in sync.
+		date, err := http.ParseTime(header.Get("Date"))
+		if err != nil {
+			date = time.Now()
+		}
+		return max(at.Sub(date), 0), true
+	}
+
+	return 0, false
+}
+
+// response returns a new http.Response for req with the contents of the entry.
+func (e *cacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// cacheTransport implements the http.RoundTripper interface. It serves cached responses and passes all other
+// requests to the next http.RoundTripper.
+type cacheTransport struct {
+	next      http.RoundTripper
+	keyID     func(context.Context) string // Returns the ID of the API key that requests are signed with.
+	storage   CacheStorage
+	ttl       time.Duration
+	endpoints []string
+
+	mu            sync.Mutex
+	invalidations map[string]time.Time // Invalidation time per resource. Unlike the storage, it never drops entries.
+}
+
+func newCacheTransport(next http.RoundTripper, keyID func(context.Context) string, opts CacheOptions) *cacheTransport {
+	return &cacheTransport{
+		next:          next,
+		keyID:         keyID,
+		storage:       opts.Storage,
+		ttl:           opts.TTL,
+		endpoints:     opts.Endpoints,
+		invalidations: make(map[string]time.Time),
+	}
+}
+
+// RoundTrip is required to implement the http.RoundTripper interface.
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		resp, err := t.next.RoundTrip(req)
+		if req.Method != http.MethodHead && req.Method != http.MethodOptions {
+			t.invalidate(req)
+		}
+		return resp, err
+	}
+
+	endpoint := EndpointName(req.Context())
+	if !slices.Contains(t.endpoints, endpoint) {
+		return t.next.RoundTrip(req)
+	}
+
+	key := t.key(req)
+	start := time.Now()
+
+	entry, ok := t.load(req, key)
+	if ok && start.Before(entry.Expires) {
+		t.markCached(req)
+		return entry.response(req), nil
+	}
+
+	r := req
+	if ok && entry.hasValidators() {
+		r = req.Clone(req.Context())
+		if etag := entry.Header.Get("ETag"); etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		if modified := entry.Header.Get("Last-Modified"); modified != "" {
+			r.Header.Set("If-Modified-Since", modified)
+		}
+	}
+
+	resp, err := t.next.RoundTrip(r)
+	if err != nil {
+		return resp, err
+	}
+
+	if ok && resp.StatusCode == http.StatusNotModified {
+		discardResponse(resp)
+
+		entry.update(resp.Header, start, t.ttl)
+		t.store(key, entry)
+		t.markCached(req)
+		return entry.response(req), nil
+	}
+
+	if resp.StatusCode != http.StatusOK || strings.Contains(resp.Header.Get("Cache-Control"), "no-store") {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if condition, ok := cacheConditions[endpoint]; ok && !condition(req, body) {
+		return resp, nil
+	}
+
+	entry = &cacheEntry{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       body,
+	}
+	entry.update(nil, start, t.ttl)
+
+	t.store(key, entry)
+	return resp, nil
+}
+
+// key returns the storage key of req. The key contains the API key ID, so that cached responses are never shared
+// between different credentials.
+func (t *cacheTransport) key(req *http.Request) string {
+	return hashKey("response", t.keyID(req.Context()), req.URL.String())
+}
+
+// load returns the cached entry of key, unless it was invalidated after it was stored.
+func (t *cacheTransport) load(req *http.Request, key string) (*cacheEntry, bool) {
+	buf, ok := t.storage.Get(key)
+	if !ok {
+		return nil, false
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(buf, &entry); err != nil {
+		t.storage.Delete(key)
+		return nil, false
+	}
+
+	if invalidated, ok := t.invalidatedAt(req); ok && !entry.Stored.After(invalidated) {
+		t.storage.Delete(key)
+		return nil, false
+	}
+
+	return &entry, true
+}
+
+func (t *cacheTransport) store(key string, entry *cacheEntry) {
+	if buf, err := json.Marshal(entry); err == nil {
+		t.storage.Set(key, buf)
+	}
+}
+
+// invalidate invalidates all cached responses of the resource of req that were requested before now.
+//
+// Instead of deleting the entries, the time of the invalidation is stored per resource. The time is kept by the
+// transport, so that it is never dropped, and is also stored in the CacheStorage, so that it reaches other processes
+// that share the CacheStorage.
+func (t *cacheTransport) invalidate(req *http.Request) {
+	key := invalidationKey(req)
+	now := time.Now()
+
+	t.mu.Lock()
+	t.invalidations[key] = now
+	t.mu.Unlock()
+
+	t.storage.Set(key, []byte(strconv.FormatInt(now.UnixNano(), 10)))
+}
+
+// invalidatedAt returns the time at which the resource of req was last invalidated, by this transport or by another
+// process that shares the CacheStorage.
+func (t *cacheTransport) invalidatedAt(req *http.Request) (time.Time, bool) {
+	key := invalidationKey(req)
+
+	t.mu.Lock()
+	invalidated, ok := t.invalidations[key]
+	t.mu.Unlock()
+
+	if buf, stored := t.storage.Get(key); stored {
+		if nanos, err := strconv.ParseInt(string(buf), 10, 64); err == nil {
+			if at := time.Unix(0, nanos); at.After(invalidated) {
+				invalidated, ok = at, true
+			}
+		}
+	}
+
+	return invalidated, ok
+}
+
+// markCached records on the callInfo of req that the response was served from the cache.
+func (t *cacheTransport) markCached(req *http.Request) {
+	if info := callInfoFromContext(req.Context()); info != nil {
+		info.cached = true
+	}
+}
+
+// invalidationKey returns the storage key of the invalidation time of the resource of req.
+func invalidationKey(req *http.Request) string {
+	return hashKey("invalidated", req.URL.Host, resourceRoot(req.URL.Path))
+}
+
+// resourceRoot returns the part of path before its first ID. For the XML APIs, it returns the directory of the
+// ".do" file.
+//
+// For example: "/api/authn/v2/roles/{id}" returns "/api/authn/v2/roles" and "/api/5.0/getbuildinfo.do" returns
+// "/api/5.0".
+func resourceRoot(path string) string {
+	if strings.HasSuffix(path, ".do") {
+		return path[:strings.LastIndex(path, "/")]
+	}
+
+	segments := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	for i, segment := range segments {
+		if isIdSegment(segment) {
+			return strings.Join(segments[:i], "/")
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// hashKey returns a storage key for parts that is safe to use as a file name.
+func hashKey(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// MemoryCache is an in-memory CacheStorage that evicts the least recently used entries.
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List // Most recently used first.
+}
+
+type memoryCacheItem struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryCache returns a new MemoryCache that holds up to maxEntries entries.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Get implements the CacheStorage interface.
+func (m *MemoryCache) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	m.order.MoveToFront(e)
+	return e.Value.(*memoryCacheItem).value, true
+}
+
+// Set implements the CacheStorage interface.
+func (m *MemoryCache) Set(key string, value []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.entries[key]; ok {
+		e.Value.(*memoryCacheItem).value = value
+		m.order.MoveToFront(e)
+		return
+	}
+
+	m.entries[key] = m.order.PushFront(&memoryCacheItem{key: key, value: value})
+
+	for m.maxEntries > 0 && m.order.Len() > m.maxEntries {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoryCacheItem).key)
+	}
+}
+
+// Delete implements the CacheStorage interface.
+func (m *MemoryCache) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.entries[key]; ok {
+		m.order.Remove(e)
+		delete(m.entries, key)
+	}
+}
+
+// Len returns the number of entries in the cache.
+func (m *MemoryCache) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.order.Len()
+}
+
+// DiskCache is a CacheStorage that stores every entry in a file in a directory. The directory can be shared by
+// multiple processes.
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache returns a new DiskCache that stores its entries in dir. The directory is created if it does not exist.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	return &DiskCache{dir: dir}, nil
+}
+
+// Get implements the CacheStorage interface.
+func (d *DiskCache) Get(key string) ([]byte, bool) {
+	buf, err := os.ReadFile(d.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return buf, true
+}
+
+// Set implements the CacheStorage interface. The entry is written to a temporary file first, so that readers never
+// see a partially written entry.
+func (d *DiskCache) Set(key string, value []byte) {
+	f, err := os.CreateTemp(d.dir, ".tmp-*")
+	if err != nil {
+		return
+	}
+
+	_, err = f.Write(value)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), d.path(key))
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// Delete implements the CacheStorage interface.
+func (d *DiskCache) Delete(key string) {
+	os.Remove(d.path(key))
+}
+
+// path returns the file path of key. Keys that are not safe to use as a file name are hashed.
+func (d *DiskCache) path(key string) string {
+	if !safeFileName.MatchString(key) {
+		key = hashKey(key)
+	}
+	return filepath.Join(d.dir, key)
+}
+
+var safeFileName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,128}$`)
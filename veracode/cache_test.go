@@ -0,0 +1,350 @@
+package veracode
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const rolesBody = `{"_embedded":{"roles":[{"role_name":"Reviewer"}]},"page":{"number":0,"size":1,"total_elements":1,"total_pages":1}}`
+
+func TestClient_Cache(t *testing.T) {
+	var requests, conditional atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			return
+		}
+
+		requests.Add(1)
+
+		if r.URL.Path == "/api/authn/v2/business_units" {
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				conditional.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"_embedded":{"business_units":[{"bu_name":"Finance"}]},"page":{}}`))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(rolesBody))
+	}))
+	defer server.Close()
+
+	storage := NewMemoryCache(10)
+
+	c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithCache(CacheOptions{Storage: storage}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	t.Run("ttl", func(t *testing.T) {
+		requests.Store(0)
+
+		for i := range 2 {
+			roles, resp, err := c.Identity.ListRoles(ctx, PageOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(roles) != 1 || roles[0].RoleName != "Reviewer" {
+				t.Errorf("IdentityService.ListRoles() = %v, want the Reviewer role", roles)
+			}
+			if resp.Cached != (i == 1) {
+				t.Errorf("call %d: Response.Cached = %v, want %v", i, resp.Cached, i == 1)
+			}
+		}
+
+		if n := requests.Load(); n != 1 {
+			t.Errorf("server received %d requests, want 1", n)
+		}
+	})
+
+	t.Run("invalidated by write to the same resource", func(t *testing.T) {
+		requests.Store(0)
+
+		req, err := c.NewRequest(ctx, "/api/authn/v2/roles/0b8a2f3e-1c4d-4e5f-8a9b-0c1d2e3f4a5b", http.MethodPut, strings.NewReader("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Do(req, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		_, resp, err := c.Identity.ListRoles(ctx, PageOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Cached || requests.Load() != 1 {
+			t.Errorf("IdentityService.ListRoles() was served from the cache after the roles were modified")
+		}
+	})
+
+	t.Run("revalidation", func(t *testing.T) {
+		requests.Store(0)
+
+		for i := range 2 {
+			units, resp, err := c.Identity.ListBusinessUnits(ctx, ListBuOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(units) != 1 {
+				t.Errorf("IdentityService.ListBusinessUnits() returned %d business units, want 1", len(units))
+			}
+			if resp.Cached != (i == 1) {
+				t.Errorf("call %d: Response.Cached = %v, want %v", i, resp.Cached, i == 1)
+			}
+		}
+
+		if requests.Load() != 2 || conditional.Load() != 1 {
+			t.Errorf("server received %d requests of which %d conditional, want 2 and 1", requests.Load(), conditional.Load())
+		}
+	})
+
+	t.Run("not shared between api keys", func(t *testing.T) {
+		requests.Store(0)
+
+		other, err := New("vera01ei-"+strings.Repeat("a", 32), testApiSecret, WithBaseURLs(server.URL, server.URL), WithCache(CacheOptions{Storage: storage}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, resp, err := other.Identity.ListRoles(ctx, PageOptions{}); err != nil || resp.Cached {
+			t.Errorf("IdentityService.ListRoles() = %v, cached %v, want a response from the server", err, resp.Cached)
+		}
+	})
+}
+
+func TestClient_Cache_NotModifiedRefreshesLifetime(t *testing.T) {
+	var requests, conditional atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional.Add(1)
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(rolesBody))
+	}))
+	defer server.Close()
+
+	c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithCache(CacheOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first call is stored, the second call is revalidated and the third call is served from the cache, because
+	// the 304 response made the cached response fresh for another minute.
+	for i := range 3 {
+		roles, resp, err := c.Identity.ListRoles(context.Background(), PageOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(roles) != 1 {
+			t.Errorf("call %d: IdentityService.ListRoles() returned %d roles, want 1", i, len(roles))
+		}
+		if resp.Cached != (i > 0) {
+			t.Errorf("call %d: Response.Cached = %v, want %v", i, resp.Cached, i > 0)
+		}
+	}
+
+	if requests.Load() != 2 || conditional.Load() != 1 {
+		t.Errorf("server received %d requests of which %d conditional, want 2 and 1", requests.Load(), conditional.Load())
+	}
+}
+
+func TestFreshnessLifetime(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+		wantOk bool
+	}{
+		{name: "max-age", header: http.Header{"Cache-Control": {"private, max-age=60"}}, want: time.Minute, wantOk: true},
+		{name: "max-age takes precedence over expires", header: http.Header{"Cache-Control": {"max-age=60"}, "Expires": {"Thu, 01 Jan 1970 00:00:00 GMT"}}, want: time.Minute, wantOk: true},
+		{name: "expires relative to date", header: http.Header{"Date": {"Mon, 02 Jan 2006 15:04:05 GMT"}, "Expires": {"Mon, 02 Jan 2006 15:14:05 GMT"}}, want: 10 * time.Minute, wantOk: true},
+		{name: "invalid expires", header: http.Header{"Expires": {"0"}}, want: 0, wantOk: true},
+		{name: "no-cache", header: http.Header{"Cache-Control": {"no-cache, max-age=60"}}},
+		{name: "no lifetime", header: http.Header{"ETag": {`"v1"`}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := freshnessLifetime(tt.header)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("freshnessLifetime() = %s, %v, want %s, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestClient_Cache_InvalidationEvicted(t *testing.T) {
+	var requests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			return
+		}
+
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(rolesBody))
+	}))
+	defer server.Close()
+
+	storage := NewMemoryCache(10)
+
+	c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithCache(CacheOptions{Storage: storage}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	if _, _, err := c.Identity.ListRoles(ctx, PageOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := c.NewRequest(ctx, "/api/authn/v2/roles/0b8a2f3e-1c4d-4e5f-8a9b-0c1d2e3f4a5b", http.MethodPut, strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do(req, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The storage drops the invalidation marker, but keeps the invalidated entry.
+	storage.Delete(invalidationKey(req))
+
+	requests.Store(0)
+
+	_, resp, err := c.Identity.ListRoles(ctx, PageOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Cached || requests.Load() != 1 {
+		t.Errorf("IdentityService.ListRoles() was served from the cache after its invalidation marker was evicted")
+	}
+}
+
+func TestClient_Cache_BuildInfo(t *testing.T) {
+	var requests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		ready := r.URL.Query().Get("build_id") == "1"
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<buildinfo app_id="1"><build build_id="1" sca_results_ready="true" results_ready="%t"></build></buildinfo>`, ready)
+	}))
+	defer server.Close()
+
+	c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithCache(CacheOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		options      BuildInfoOptions
+		wantRequests int32
+	}{
+		{name: "published build", options: BuildInfoOptions{AppId: 1, BuildId: 1}, wantRequests: 1},
+		{name: "unpublished build", options: BuildInfoOptions{AppId: 1, BuildId: 2}, wantRequests: 2},
+		{name: "latest build", options: BuildInfoOptions{AppId: 1}, wantRequests: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests.Store(0)
+
+			for range 2 {
+				if _, _, err := c.UploadXML.GetBuildInfo(context.Background(), tt.options); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if n := requests.Load(); n != tt.wantRequests {
+				t.Errorf("server received %d requests, want %d", n, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestResourceRoot(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/api/authn/v2/roles", want: "/api/authn/v2/roles"},
+		{path: "/api/authn/v2/roles/", want: "/api/authn/v2/roles"},
+		{path: "/api/authn/v2/roles/0b8a2f3e-1c4d-4e5f-8a9b-0c1d2e3f4a5b", want: "/api/authn/v2/roles"},
+		{path: "/appsec/v1/applications/0b8a2f3e-1c4d-4e5f-8a9b-0c1d2e3f4a5b/sandboxes", want: "/appsec/v1/applications"},
+		{path: "/api/5.0/getbuildinfo.do", want: "/api/5.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := resourceRoot(tt.path); got != tt.want {
+				t.Errorf("resourceRoot() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryCache_Evicts(t *testing.T) {
+	m := NewMemoryCache(2)
+	m.Set("a", []byte("1"))
+	m.Set("b", []byte("2"))
+	m.Get("a")
+	m.Set("c", []byte("3"))
+
+	if _, ok := m.Get("b"); ok {
+		t.Errorf("least recently used entry was not evicted")
+	}
+	if _, ok := m.Get("a"); !ok {
+		t.Errorf("recently used entry was evicted")
+	}
+	if m.Len() != 2 {
+		t.Errorf("MemoryCache.Len() = %d, want 2", m.Len())
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	d, err := NewDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{hashKey("key"), "not/a file:name"} {
+		d.Set(key, []byte("value"))
+		if got, ok := d.Get(key); !ok || string(got) != "value" {
+			t.Errorf("DiskCache.Get(%q) = %q, %v, want value", key, got, ok)
+		}
+
+		d.Delete(key)
+		if _, ok := d.Get(key); ok {
+			t.Errorf("DiskCache.Get(%q) found a deleted entry", key)
+		}
+	}
+
+	// Entries can be read by another DiskCache for the same directory.
+	d.Set("shared", []byte("value"))
+	other, _ := NewDiskCache(d.dir)
+	if _, ok := other.Get("shared"); !ok {
+		t.Errorf("entry was not found by another DiskCache for the same directory")
+	}
+}
@@ -0,0 +1,247 @@
+package veracode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned for calls that are made while the circuit breaker is open. See [WithCircuitBreaker].
+var ErrCircuitOpen = errors.New("circuit breaker is open: the veracode platform appears to be degraded")
+
+// CircuitState is the state of the circuit breaker.
+type CircuitState int
+
+const (
+	CircuitClosed   CircuitState = iota // Requests are sent as usual.
+	CircuitOpen                         // Requests fail immediately with ErrCircuitOpen.
+	CircuitHalfOpen                     // The platform is being probed. Requests fail immediately with ErrCircuitOpen.
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// CircuitBreakerOptions configures the circuit breaker. See [WithCircuitBreaker].
+type CircuitBreakerOptions struct {
+	// FailureThreshold is the number of consecutive 5xx responses or timeouts after which the circuit opens.
+	// The default is 5.
+	FailureThreshold int
+
+	// OpenDuration is how long the circuit stays open before the platform is probed. The default is 30 seconds.
+	OpenDuration time.Duration
+
+	// ProbeTimeout is the timeout of the probe. The default is 10 seconds.
+	ProbeTimeout time.Duration
+}
+
+// WithCircuitBreaker enables the circuit breaker, which fails fast while the Veracode platform is degraded.
+//
+// The circuit opens after opts.FailureThreshold consecutive attempts failed with a 5xx response or a timeout. While
+// the circuit is open, calls fail immediately with an error that wraps [ErrCircuitOpen]. Once opts.OpenDuration has
+// passed, the next call probes the platform using [HealthCheckService.GetStatus]. If the probe succeeds, the circuit
+// closes and the call is sent; otherwise the circuit opens again.
+//
+// State changes are logged and reported to the OnCircuitStateChange function of the Client's [Hooks].
+func WithCircuitBreaker(opts CircuitBreakerOptions) ClientOption {
+	return func(cfg *clientConfig) error {
+		if opts.FailureThreshold < 0 || opts.OpenDuration < 0 || opts.ProbeTimeout < 0 {
+			return fmt.Errorf("circuit breaker options must not be negative")
+		}
+
+		if opts.FailureThreshold == 0 {
+			opts.FailureThreshold = 5
+		}
+		if opts.OpenDuration == 0 {
+			opts.OpenDuration = 30 * time.Second
+		}
+		if opts.ProbeTimeout == 0 {
+			opts.ProbeTimeout = 10 * time.Second
+		}
+
+		cfg.circuitBreaker = &opts
+		return nil
+	}
+}
+
+type circuitProbeKey struct{}
+
+// circuitBreaker tracks the failures of the attempts sent by the veracodeTransport.
+type circuitBreaker struct {
+	opts CircuitBreakerOptions
+
+	// probe checks whether the platform is available again. It is called with a context that bypasses the breaker.
+	probe func(ctx context.Context) error
+
+	// onChange is called after every state change, without holding mu.
+	onChange func(from, to CircuitState)
+
+	mu        sync.Mutex
+	state     CircuitState
+	failures  int
+	openUntil time.Time
+}
+
+// allow returns nil if a request with ctx can be sent and an error that wraps ErrCircuitOpen otherwise.
+// If the circuit has been open for long enough, allow probes the platform before returning.
+func (b *circuitBreaker) allow(ctx context.Context) error {
+	if b == nil || ctx.Value(circuitProbeKey{}) != nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	switch {
+	case b.state == CircuitClosed:
+		b.mu.Unlock()
+		return nil
+	case b.state == CircuitOpen && !time.Now().Before(b.openUntil):
+		b.setState(CircuitHalfOpen)
+	default:
+		openUntil := b.openUntil
+		b.mu.Unlock()
+		return fmt.Errorf("%w (until %s)", ErrCircuitOpen, openUntil.Format(time.RFC3339))
+	}
+	b.mu.Unlock()
+
+	b.notify(CircuitOpen, CircuitHalfOpen)
+
+	// The probe is not canceled with the request that triggered it, since its outcome affects all requests.
+	probeCtx := context.WithValue(context.WithoutCancel(ctx), circuitProbeKey{}, true)
+	probeCtx, cancel := context.WithTimeout(WithEndpointName(probeCtx, ""), b.opts.ProbeTimeout)
+	defer cancel()
+
+	if err := b.probe(probeCtx); err != nil {
+		b.transition(CircuitOpen)
+		return fmt.Errorf("%w: probe failed: %w", ErrCircuitOpen, err)
+	}
+
+	b.transition(CircuitClosed)
+	return nil
+}
+
+// record counts the outcome of an attempt that was sent with ctx.
+func (b *circuitBreaker) record(ctx context.Context, resp *http.Response, err error) {
+	if b == nil || ctx.Value(circuitProbeKey{}) != nil {
+		return
+	}
+
+	failed := isTimeout(ctx, err) || (err == nil && resp.StatusCode >= 500)
+	if err != nil && !failed {
+		// Other errors, such as a canceled context, say nothing about the state of the platform.
+		return
+	}
+
+	b.mu.Lock()
+	if !failed {
+		b.failures = 0
+		b.mu.Unlock()
+		return
+	}
+
+	b.failures++
+	if b.state != CircuitClosed || b.failures < b.opts.FailureThreshold {
+		b.mu.Unlock()
+		return
+	}
+	b.mu.Unlock()
+
+	b.transition(CircuitOpen)
+}
+
+// transition changes the state to to and notifies the listeners.
+func (b *circuitBreaker) transition(to CircuitState) {
+	b.mu.Lock()
+	from := b.state
+	b.setState(to)
+	b.mu.Unlock()
+
+	if from != to {
+		b.notify(from, to)
+	}
+}
+
+// setState changes the state. The caller must hold b.mu.
+func (b *circuitBreaker) setState(to CircuitState) {
+	b.state = to
+	b.failures = 0
+
+	if to == CircuitOpen {
+		b.openUntil = time.Now().Add(b.opts.OpenDuration)
+	}
+}
+
+func (b *circuitBreaker) notify(from, to CircuitState) {
+	if b.onChange != nil {
+		b.onChange(from, to)
+	}
+}
+
+// currentState returns the current state of the circuit breaker.
+func (b *circuitBreaker) currentState() CircuitState {
+	if b == nil {
+		return CircuitClosed
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// isTimeout reports whether err is caused by a timeout of a request made with ctx. The caller's own deadline expiring
+// is not a timeout of the platform, so errors are not reported as timeouts once ctx is done.
+func isTimeout(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var nerr net.Error
+	return errors.As(err, &nerr) && nerr.Timeout()
+}
+
+// CircuitState returns the current state of the circuit breaker. It returns CircuitClosed if the circuit breaker
+// is not enabled.
+func (c *Client) CircuitState() CircuitState {
+	return c.transport.breaker.currentState()
+}
+
+// circuitStateChanged logs a state change of the circuit breaker and reports it to the hooks.
+func (c *Client) circuitStateChanged(from, to CircuitState) {
+	level := slog.LevelInfo
+	if to == CircuitOpen {
+		level = slog.LevelWarn
+	}
+
+	c.logger.LogAttrs(context.Background(), level, "veracode circuit breaker state changed",
+		slog.String("from", from.String()),
+		slog.String("to", to.String()),
+	)
+
+	c.rwMu.RLock()
+	hooks := c.hooks
+	c.rwMu.RUnlock()
+
+	for _, h := range hooks {
+		if h.OnCircuitStateChange != nil {
+			h.OnCircuitStateChange(from, to)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package veracode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient_CircuitBreaker(t *testing.T) {
+	var healthy atomic.Bool
+	var calls atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	var changes []string
+
+	c, err := New(testApiKey, testApiSecret,
+		WithBaseURLs(server.URL, server.URL),
+		WithRetryPolicy(NoRetryPolicy),
+		WithCircuitBreaker(CircuitBreakerOptions{FailureThreshold: 2, OpenDuration: 20 * time.Millisecond}),
+		WithHooks(Hooks{OnCircuitStateChange: func(from, to CircuitState) {
+			mu.Lock()
+			defer mu.Unlock()
+			changes = append(changes, fmt.Sprintf("%s->%s", from, to))
+		}}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	for range 2 {
+		if resp, err := c.Healthcheck.GetStatus(ctx); err != nil || resp.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("HealthCheckService.GetStatus() = %v, want status %d", err, http.StatusServiceUnavailable)
+		}
+	}
+
+	if state := c.CircuitState(); state != CircuitOpen {
+		t.Fatalf("Client.CircuitState() = %s, want %s", state, CircuitOpen)
+	}
+
+	// While the circuit is open, calls fail fast.
+	sent := calls.Load()
+	if _, err := c.Healthcheck.GetStatus(ctx); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("HealthCheckService.GetStatus() error = %v, want %v", err, ErrCircuitOpen)
+	}
+	if calls.Load() != sent {
+		t.Errorf("a request was sent while the circuit was open")
+	}
+
+	// A failed probe opens the circuit again.
+	time.Sleep(30 * time.Millisecond)
+	if _, err := c.Healthcheck.GetStatus(ctx); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("HealthCheckService.GetStatus() error = %v, want %v", err, ErrCircuitOpen)
+	}
+
+	// A successful probe closes the circuit and the call is sent.
+	healthy.Store(true)
+	time.Sleep(30 * time.Millisecond)
+	if _, err := c.Healthcheck.GetStatus(ctx); err != nil {
+		t.Errorf("HealthCheckService.GetStatus() error = %v after the platform recovered", err)
+	}
+
+	want := []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("state changes = %v, want %v", changes, want)
+	}
+}
+
+func TestClient_CircuitBreaker_CallerDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	var mode string
+
+	c, err := New(testApiKey, testApiSecret,
+		WithBaseURLs(server.URL, server.URL),
+		WithRetryPolicy(NoRetryPolicy),
+		WithCircuitBreaker(CircuitBreakerOptions{FailureThreshold: 1, OpenDuration: time.Hour}),
+		WithMiddleware(func(next http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				switch mode {
+				case "unsent":
+					<-req.Context().Done()
+					return nil, req.Context().Err()
+				case "timeout":
+					return nil, &net.DNSError{Err: "i/o timeout", Name: req.URL.Hostname(), IsTimeout: true}
+				}
+				return next.RoundTrip(req)
+			})
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode = range []string{"unsent", "sent"} {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err := c.Healthcheck.GetStatus(ctx)
+		cancel()
+
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("HealthCheckService.GetStatus() error = %v in mode %s, want %v", err, mode, context.DeadlineExceeded)
+		}
+		if state := c.CircuitState(); state != CircuitClosed {
+			t.Fatalf("Client.CircuitState() = %s after the deadline of the caller expired in mode %s, want %s", state, mode, CircuitClosed)
+		}
+	}
+
+	// A timeout of the transport while the caller is still waiting opens the circuit.
+	mode = "timeout"
+	if _, err := c.Healthcheck.GetStatus(context.Background()); err == nil {
+		t.Fatal("HealthCheckService.GetStatus() error = nil, want a timeout")
+	}
+
+	if state := c.CircuitState(); state != CircuitOpen {
+		t.Errorf("Client.CircuitState() = %s after a timeout of the transport, want %s", state, CircuitOpen)
+	}
+}
@@ -0,0 +1,183 @@
+package veracode
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WithCoalescing makes the Client coalesce identical GET requests that are in flight at the same time. Requests are
+// identical if they have the same URL and are sent with the same credentials. Conditional requests, such as the
+// revalidation requests of [WithCache], are never coalesced.
+//
+// Only the first request is signed and sent. The other callers wait for its response and every caller decodes its
+// own copy of the response body. Coalesced calls are reported to the MetricsCollector with
+// [RequestMetric.Coalesced] set and have [Response.Coalesced] set.
+func WithCoalescing() ClientOption {
+	return func(cfg *clientConfig) error {
+		cfg.coalesce = true
+		return nil
+	}
+}
+
+// coalesceTransport implements the http.RoundTripper interface. It sends a single request for identical GET
+// requests that are in flight at the same time.
+type coalesceTransport struct {
+	next    http.RoundTripper
+	keyID   func(context.Context) string
+	metrics MetricsCollector
+
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+// coalescedCall is a request that is shared by one or more callers.
+type coalescedCall struct {
+	done    chan struct{} // Closed once the response has been read.
+	cancel  context.CancelFunc
+	waiters int // Number of callers that are waiting for the response. Guarded by coalesceTransport.mu.
+
+	resp     *http.Response
+	body     []byte
+	err      error
+	attempts int // Number of attempts made by the veracodeTransport.
+}
+
+func newCoalesceTransport(next http.RoundTripper, keyID func(context.Context) string, metrics MetricsCollector) *coalesceTransport {
+	return &coalesceTransport{
+		next:    next,
+		keyID:   keyID,
+		metrics: metrics,
+		calls:   make(map[string]*coalescedCall),
+	}
+}
+
+// RoundTrip is required to implement the http.RoundTripper interface.
+func (t *coalesceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || (req.Body != nil && req.Body != http.NoBody) || isConditional(req) {
+		return t.next.RoundTrip(req)
+	}
+
+	key := t.keyID(req.Context()) + " " + req.URL.String()
+	start := time.Now()
+
+	t.mu.Lock()
+	call, coalesced := t.calls[key]
+	if !coalesced {
+		// The shared request is not canceled when the caller that started it gives up, but only once all callers
+		// have given up.
+		ctx, cancel := context.WithCancel(context.WithoutCancel(req.Context()))
+		ctx = withCallInfo(ctx, &callInfo{})
+
+		call = &coalescedCall{done: make(chan struct{}), cancel: cancel}
+		t.calls[key] = call
+
+		go t.send(key, call, req.WithContext(ctx))
+	}
+	call.waiters++
+	t.mu.Unlock()
+
+	select {
+	case <-call.done:
+	case <-req.Context().Done():
+		t.leave(key, call)
+		return nil, req.Context().Err()
+	}
+
+	if coalesced {
+		t.report(req, call, start)
+	}
+
+	return call.response(req, coalesced)
+}
+
+// conditionalHeaders are the request headers that can make the response differ between requests for the same URL.
+var conditionalHeaders = []string{"If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range", "Range"}
+
+// isConditional reports whether req is a conditional or range request, whose response cannot be shared with a plain
+// GET request for the same URL.
+func isConditional(req *http.Request) bool {
+	for _, h := range conditionalHeaders {
+		if req.Header.Get(h) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// send sends the shared request and reads the response body, so that it can be returned to every caller.
+func (t *coalesceTransport) send(key string, call *coalescedCall, req *http.Request) {
+	defer call.cancel()
+
+	call.resp, call.err = t.next.RoundTrip(req)
+	call.attempts = callInfoFromContext(req.Context()).attempts
+
+	if call.err == nil {
+		call.body, call.err = io.ReadAll(call.resp.Body)
+		call.resp.Body.Close()
+	}
+
+	t.mu.Lock()
+	if t.calls[key] == call {
+		delete(t.calls, key)
+	}
+	t.mu.Unlock()
+
+	close(call.done)
+}
+
+// leave removes a caller that gave up waiting. The shared request is canceled if no callers are left, in which
+// case later callers start a new request.
+func (t *coalesceTransport) leave(key string, call *coalescedCall) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	call.waiters--
+	if call.waiters == 0 {
+		call.cancel()
+		if t.calls[key] == call {
+			delete(t.calls, key)
+		}
+	}
+}
+
+// report sends the metric of a coalesced call to the MetricsCollector.
+func (t *coalesceTransport) report(req *http.Request, call *coalescedCall, start time.Time) {
+	if t.metrics == nil {
+		return
+	}
+
+	t.metrics.ObserveRequest(RequestMetric{
+		Endpoint:    endpointTemplate(req.URL.Path),
+		Method:      req.Method,
+		StatusClass: statusClass(call.resp, call.err),
+		Latency:     time.Since(start),
+		Coalesced:   true,
+	})
+}
+
+// response returns a copy of the shared response for req, with its own body.
+func (c *coalescedCall) response(req *http.Request, coalesced bool) (*http.Response, error) {
+	if info := callInfoFromContext(req.Context()); info != nil {
+		if coalesced {
+			info.coalesced = true
+		} else {
+			info.attempts = c.attempts
+		}
+	}
+
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	resp := *c.resp
+	resp.Header = c.resp.Header.Clone()
+	resp.Body = io.NopCloser(bytes.NewReader(c.body))
+	resp.ContentLength = int64(len(c.body))
+	resp.Request = req
+
+	return &resp, nil
+}
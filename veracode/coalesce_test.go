@@ -0,0 +1,202 @@
+package veracode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient_Coalescing(t *testing.T) {
+	const workers = 20
+	const guid = "0b8a2f3e-1c4d-4e5f-8a9b-0c1d2e3f4a5b"
+
+	var requests atomic.Int32
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"guid":"` + guid + `","profile":{"name":"App"}}`))
+	}))
+	defer server.Close()
+
+	metrics := NewInMemoryMetrics()
+
+	c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithCoalescing(), WithMetrics(metrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apps := make([]*Application, workers)
+	resps := make([]*Response, workers)
+
+	var wg sync.WaitGroup
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var err error
+			apps[i], resps[i], err = c.Application.GetApplication(context.Background(), guid)
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	// Wait until all workers are waiting for the shared request.
+	coalescer := c.HttpClient.Transport.(*coalesceTransport)
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		coalescer.mu.Lock()
+		var waiters int
+		for _, call := range coalescer.calls {
+			waiters += call.waiters
+		}
+		coalescer.mu.Unlock()
+
+		if waiters == workers {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of %d workers are waiting for the shared request", waiters, workers)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+	wg.Wait()
+
+	if n := requests.Load(); n != 1 {
+		t.Errorf("server received %d requests, want 1", n)
+	}
+
+	var coalesced int
+	for i := range workers {
+		if apps[i] == nil || apps[i].Guid != guid || apps[i].Profile.Name != "App" {
+			t.Errorf("worker %d got application %+v", i, apps[i])
+		}
+		if resps[i].Coalesced {
+			coalesced++
+		}
+		for j := range i {
+			if apps[i] == apps[j] {
+				t.Errorf("workers %d and %d share the same decoded application", i, j)
+			}
+		}
+	}
+	if coalesced != workers-1 {
+		t.Errorf("%d responses are coalesced, want %d", coalesced, workers-1)
+	}
+
+	snapshot := metrics.Snapshot()
+	if len(snapshot) != 1 || snapshot[0].Count != 1 || snapshot[0].Coalesced != workers-1 {
+		t.Errorf("InMemoryMetrics.Snapshot() = %+v, want 1 request and %d coalesced", snapshot, workers-1)
+	}
+}
+
+func TestClient_Coalescing_Cancel(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithCoalescing())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := c.Healthcheck.GetStatus(ctx); err == nil {
+		t.Fatal("HealthCheckService.GetStatus() did not return an error after the context was canceled")
+	}
+
+	coalescer := c.HttpClient.Transport.(*coalesceTransport)
+	coalescer.mu.Lock()
+	defer coalescer.mu.Unlock()
+
+	if len(coalescer.calls) != 0 {
+		t.Errorf("shared request was not removed after all callers gave up")
+	}
+}
+
+func TestClient_Coalescing_Conditional(t *testing.T) {
+	const etag = `"v1"`
+
+	arrived := make(chan struct{})
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			close(arrived)
+			<-release
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", etag)
+		w.Write([]byte("body"))
+	}))
+	defer server.Close()
+
+	coalescer := newCoalesceTransport(http.DefaultTransport, func(context.Context) string { return testApiKey }, nil)
+
+	revalidated := make(chan int, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		req.Header.Set("If-None-Match", etag)
+
+		resp, err := coalescer.RoundTrip(req)
+		if err != nil {
+			t.Error(err)
+			revalidated <- 0
+			return
+		}
+		resp.Body.Close()
+		revalidated <- resp.StatusCode
+	}()
+
+	<-arrived
+
+	plain := make(chan *http.Response, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+
+		resp, err := coalescer.RoundTrip(req)
+		if err != nil {
+			t.Error(err)
+		}
+		plain <- resp
+	}()
+
+	select {
+	case resp := <-plain:
+		if resp != nil {
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("plain GET status = %d, want %d", resp.StatusCode, http.StatusOK)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("plain GET was coalesced with the revalidation request")
+	}
+
+	close(release)
+
+	if status := <-revalidated; status != http.StatusNotModified {
+		t.Errorf("revalidation status = %d, want %d", status, http.StatusNotModified)
+	}
+}
@@ -1,10 +1,15 @@
 package veracode
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 
 	"gopkg.in/ini.v1"
 )
@@ -15,6 +20,15 @@ type Profile struct {
 	VeracodeApiKeySecret string
 }
 
+// LogValue implements the [slog.LogValuer] interface, so that the API key secret is never logged.
+func (p Profile) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", p.Name),
+		slog.String("veracode_api_key_id", p.VeracodeApiKeyId),
+		slog.String("veracode_api_key_secret", redacted),
+	)
+}
+
 // GetCredentialsFilePath gets the Veracode API credentials file path.
 func GetCredentialsFilePath() (string, error) {
 	homeDir, err := os.UserHomeDir()
@@ -66,10 +80,9 @@ func sectionToValidProfile(section *ini.Section) (Profile, bool) {
 	return p, true
 }
 
-// GetProfile returns a pointer to the section of the credentials file that the user is using.
-func getProfile(filePath string) (*ini.Section, error) {
-	profile := os.Getenv("VERACODE_API_PROFILE")
-
+// getProfile returns a pointer to the section of the credentials file for profile. If profile is empty, the
+// "default" profile is used.
+func getProfile(filePath, profile string) (*ini.Section, error) {
 	cfg, err := ini.Load(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("error loading ini file. Message: %s", err.Error())
@@ -103,22 +116,254 @@ func getProfile(filePath string) (*ini.Section, error) {
 // profile with name "default" will be used. If there is only one profile with no name it will be used.
 // The credentials file should be in the .ini format and should be present in the /.veracode/ folder in the user's home
 // directory. Please refer to the documentation for more information: https://docs.veracode.com/r/c_httpie_tool.
+//
+// Use a [CredentialsProvider], such as [DefaultCredentialsProvider], to load the credentials from other sources.
 func LoadVeracodeCredentials() (string, string, error) {
-	credsPath, err := GetCredentialsFilePath()
+	creds, err := (&FileCredentialsProvider{}).Credentials(context.Background())
 	if err != nil {
 		return "", "", err
 	}
 
-	profile, err := getProfile(credsPath)
+	return creds.APIKeyID, creds.APIKeySecret, nil
+}
+
+var (
+	// ErrProfileNotFound is returned if a profile does not exist in the credentials file.
+	ErrProfileNotFound = errors.New("profile not found")
+
+	// ErrProfileExists is returned by RenameProfile if a profile with the new name already exists.
+	ErrProfileExists = errors.New("profile already exists")
+
+	// ErrInsecureCredentialsFile is returned if the credentials file can be read or written by users other than its
+	// owner. The permissions of the file should be 0600.
+	ErrInsecureCredentialsFile = errors.New("credentials file permissions are too open")
+
+	// ErrInvalidProfileName is returned if a profile name is empty or contains characters that cannot be written to
+	// the credentials file.
+	ErrInvalidProfileName = errors.New("invalid profile name")
+)
+
+// SaveProfile adds the profile to the Veracode credentials file at filePath, or updates its API key ID and secret if
+// it already exists. The file and its directory are created if they do not exist.
+//
+// Comments, other keys of the profile and other profiles are kept. The file is replaced atomically and is written
+// with 0600 permissions. If filePath is a symbolic link, the file that it points to is replaced. SaveProfile returns an
+// error that wraps ErrInsecureCredentialsFile if the existing file can be accessed by other users, or
+// ErrInvalidProfileName if the name of the profile contains "[", "]" or a line break.
+func SaveProfile(filePath string, profile Profile) error {
+	if err := validateProfileName(profile.Name); err != nil {
+		return err
+	}
+
+	if profile.VeracodeApiKeyId == "" || profile.VeracodeApiKeySecret == "" {
+		return errors.New("API key ID and API key secret must not be empty")
+	}
+
+	cfg, err := loadCredentialsFile(filePath)
 	if err != nil {
-		return "", "", err
+		return err
 	}
 
-	key, secret := profile.Key("veracode_api_key_id").String(), profile.Key("veracode_api_key_secret").String()
-	if key == "" || secret == "" {
-		err := errors.New("failed to load Veracode API credentials from file. Please refer to documentation: https://docs.veracode.com/r/c_httpie_tool")
-		return "", "", err
+	section, err := cfg.NewSection(profile.Name)
+	if err != nil {
+		return err
+	}
+
+	section.Key("veracode_api_key_id").SetValue(profile.VeracodeApiKeyId)
+	section.Key("veracode_api_key_secret").SetValue(profile.VeracodeApiKeySecret)
+
+	return writeCredentialsFile(filePath, cfg)
+}
+
+// DeleteProfile removes the profile with name from the Veracode credentials file at filePath. It returns an error that
+// wraps ErrProfileNotFound if the profile does not exist.
+//
+// See [SaveProfile] for how the file is written.
+func DeleteProfile(filePath, name string) error {
+	cfg, err := loadCredentialsFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	if !hasProfile(cfg, name) {
+		return fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+	}
+
+	cfg.DeleteSection(name)
+
+	return writeCredentialsFile(filePath, cfg)
+}
+
+// RenameProfile renames the profile with name oldName in the Veracode credentials file at filePath to newName. It
+// returns an error that wraps ErrProfileNotFound if the profile does not exist, ErrProfileExists if a profile with
+// newName already exists or ErrInvalidProfileName if newName is not a valid profile name.
+//
+// See [SaveProfile] for how the file is written.
+func RenameProfile(filePath, oldName, newName string) error {
+	if err := validateProfileName(newName); err != nil {
+		return err
+	}
+
+	cfg, err := loadCredentialsFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	if !hasProfile(cfg, oldName) {
+		return fmt.Errorf("%w: %s", ErrProfileNotFound, oldName)
+	}
+
+	if hasProfile(cfg, newName) {
+		return fmt.Errorf("%w: %s", ErrProfileExists, newName)
+	}
+
+	// The ini package cannot rename sections, so the section is copied, including its comments, and the old section is
+	// removed. The renamed profile is moved to the end of the file.
+	old := cfg.Section(oldName)
+
+	section, err := cfg.NewSection(newName)
+	if err != nil {
+		return err
+	}
+	section.Comment = old.Comment
+
+	for _, key := range old.Keys() {
+		newKey, err := section.NewKey(key.Name(), key.Value())
+		if err != nil {
+			return err
+		}
+		newKey.Comment = key.Comment
+	}
+
+	cfg.DeleteSection(oldName)
+
+	return writeCredentialsFile(filePath, cfg)
+}
+
+// validateProfileName checks that name can be written as the header of a section of the credentials file.
+func validateProfileName(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: the name must not be empty", ErrInvalidProfileName)
+	}
+
+	if strings.ContainsAny(name, "[]\r\n") {
+		return fmt.Errorf("%w: %q must not contain \"[\", \"]\" or line breaks", ErrInvalidProfileName, name)
+	}
+
+	return nil
+}
+
+// hasProfile reports whether cfg contains a profile with name.
+func hasProfile(cfg *ini.File, name string) bool {
+	if name == "" {
+		return false
+	}
+
+	section, err := cfg.GetSection(name)
+	return err == nil && (name != ini.DefaultSection || len(section.Keys()) > 0)
+}
+
+// loadCredentialsFile loads the credentials file at filePath so that it can be modified. A file that does not exist is
+// treated as an empty file.
+func loadCredentialsFile(filePath string) (*ini.File, error) {
+	info, err := os.Stat(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ini.Empty(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Windows does not use Unix permission bits, so they cannot be checked.
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		return nil, fmt.Errorf("%w: %s has permissions %#o, expected 0600", ErrInsecureCredentialsFile, filePath, info.Mode().Perm())
+	}
+
+	cfg, err := ini.Load(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error loading ini file. Message: %s", err.Error())
+	}
+
+	return cfg, nil
+}
+
+// writeCredentialsFile atomically replaces the credentials file at filePath with cfg. The file is first written to
+// a temporary file in the same directory, which is then renamed, so that readers never see a partially written file.
+//
+// If filePath is a symbolic link, the file that it points to is replaced, so that the link is kept.
+func writeCredentialsFile(filePath string, cfg *ini.File) (err error) {
+	filePath, err = resolveSymlinks(filePath)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".credentials-*")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err := tmp.Chmod(0o600); err != nil {
+		return err
+	}
+
+	if _, err := cfg.WriteTo(tmp); err != nil {
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filePath)
+}
+
+// maxSymlinks is the maximum number of symbolic links that resolveSymlinks follows.
+const maxSymlinks = 40
+
+// resolveSymlinks returns the path of the file that filePath points to if it is a symbolic link. Unlike
+// filepath.EvalSymlinks, it also resolves links whose target does not exist yet.
+func resolveSymlinks(filePath string) (string, error) {
+	for range maxSymlinks {
+		resolved, err := filepath.EvalSymlinks(filePath)
+		if err == nil {
+			return resolved, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+
+		// The file does not exist, but filePath can still be a link to it.
+		info, err := os.Lstat(filePath)
+		if err != nil || info.Mode()&fs.ModeSymlink == 0 {
+			return filePath, nil
+		}
+
+		target, err := os.Readlink(filePath)
+		if err != nil {
+			return "", err
+		}
+
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(filePath), target)
+		}
+		filePath = target
 	}
 
-	return key, secret, nil
+	return "", fmt.Errorf("too many symbolic links in %s", filePath)
 }
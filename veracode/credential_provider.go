@@ -0,0 +1,261 @@
+package veracode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Environment variables that are read by the EnvCredentialsProvider and the FileCredentialsProvider.
+const (
+	EnvAPIKeyID     = "VERACODE_API_KEY_ID"
+	EnvAPIKeySecret = "VERACODE_API_KEY_SECRET"
+	EnvAPIProfile   = "VERACODE_API_PROFILE"
+)
+
+// ErrNoCredentials is returned by a CredentialsProvider if its source does not contain any credentials, for example
+// because the environment variables are not set or the credentials file does not exist.
+var ErrNoCredentials = errors.New("no Veracode API credentials found")
+
+// Credentials is a pair of Veracode API credentials.
+type Credentials struct {
+	APIKeyID     string
+	APIKeySecret string
+
+	// Source describes where the credentials were loaded from, for example "environment" or
+	// "file /home/user/.veracode/credentials (profile default)".
+	Source string
+}
+
+// LogValue implements the [slog.LogValuer] interface, so that the API key secret is never logged.
+func (c Credentials) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("api_key_id", c.APIKeyID),
+		slog.String("api_key_secret", redacted),
+		slog.String("source", c.Source),
+	)
+}
+
+// CredentialsProvider provides Veracode API credentials.
+//
+// Credentials should return an error that wraps ErrNoCredentials if its source does not contain any credentials.
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// CredentialsProviderFunc is an adapter that allows a function, for example one that reads the credentials from a
+// secrets vault, to be used as a CredentialsProvider.
+type CredentialsProviderFunc func(ctx context.Context) (Credentials, error)
+
+// Credentials is required to implement the CredentialsProvider interface.
+func (f CredentialsProviderFunc) Credentials(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+// StaticCredentialsProvider is a CredentialsProvider that always returns the same credentials.
+type StaticCredentialsProvider struct {
+	APIKeyID     string
+	APIKeySecret string
+}
+
+// Credentials is required to implement the CredentialsProvider interface.
+func (p StaticCredentialsProvider) Credentials(ctx context.Context) (Credentials, error) {
+	if p.APIKeyID == "" || p.APIKeySecret == "" {
+		return Credentials{}, fmt.Errorf("%w: static credentials are empty", ErrNoCredentials)
+	}
+
+	return Credentials{APIKeyID: p.APIKeyID, APIKeySecret: p.APIKeySecret, Source: "static"}, nil
+}
+
+// staticCredentials returns a CredentialsProvider that always returns apiKey and apiSecret, even if they are empty.
+func staticCredentials(apiKey, apiSecret string) CredentialsProvider {
+	creds := Credentials{APIKeyID: apiKey, APIKeySecret: apiSecret, Source: "static"}
+
+	return CredentialsProviderFunc(func(ctx context.Context) (Credentials, error) {
+		return creds, nil
+	})
+}
+
+// EnvCredentialsProvider is a CredentialsProvider that reads the credentials from the VERACODE_API_KEY_ID and
+// VERACODE_API_KEY_SECRET environment variables.
+type EnvCredentialsProvider struct{}
+
+// Credentials is required to implement the CredentialsProvider interface.
+func (EnvCredentialsProvider) Credentials(ctx context.Context) (Credentials, error) {
+	key, secret := os.Getenv(EnvAPIKeyID), os.Getenv(EnvAPIKeySecret)
+
+	switch {
+	case key == "" && secret == "":
+		return Credentials{}, fmt.Errorf("%w: environment variables %s and %s are not set", ErrNoCredentials, EnvAPIKeyID, EnvAPIKeySecret)
+	case key == "":
+		return Credentials{}, fmt.Errorf("environment variable %s is set, but %s is not", EnvAPIKeySecret, EnvAPIKeyID)
+	case secret == "":
+		return Credentials{}, fmt.Errorf("environment variable %s is set, but %s is not", EnvAPIKeyID, EnvAPIKeySecret)
+	}
+
+	return Credentials{APIKeyID: key, APIKeySecret: secret, Source: "environment"}, nil
+}
+
+// FileCredentialsProvider is a CredentialsProvider that reads the credentials from a profile in a Veracode API
+// credentials file. Please refer to the documentation for more information: https://docs.veracode.com/r/c_httpie_tool.
+type FileCredentialsProvider struct {
+	// Path is the path of the credentials file. If it is empty, the path returned by [GetCredentialsFilePath] is used.
+	Path string
+
+	// Profile is the name of the profile. If it is empty, the profile is read from the VERACODE_API_PROFILE environment
+	// variable. If the variable is not set either, the profile with name "default" is used. If the file only contains
+	// credentials without a profile, those are used.
+	Profile string
+}
+
+// Credentials is required to implement the CredentialsProvider interface.
+func (p *FileCredentialsProvider) Credentials(ctx context.Context) (Credentials, error) {
+	path := p.Path
+	if path == "" {
+		var err error
+		if path, err = GetCredentialsFilePath(); err != nil {
+			return Credentials{}, err
+		}
+	}
+
+	profile := p.Profile
+	if profile == "" {
+		profile = os.Getenv(EnvAPIProfile)
+	}
+
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return Credentials{}, fmt.Errorf("%w: credentials file %s does not exist", ErrNoCredentials, path)
+	}
+
+	section, err := getProfile(path, profile)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("credentials file %s: %w", path, err)
+	}
+
+	key, secret := section.Key("veracode_api_key_id").String(), section.Key("veracode_api_key_secret").String()
+	if key == "" || secret == "" {
+		return Credentials{}, fmt.Errorf("credentials file %s: profile %s does not contain veracode_api_key_id and veracode_api_key_secret. Please refer to documentation: https://docs.veracode.com/r/c_httpie_tool", path, section.Name())
+	}
+
+	return Credentials{
+		APIKeyID:     key,
+		APIKeySecret: secret,
+		Source:       fmt.Sprintf("file %s (profile %s)", path, section.Name()),
+	}, nil
+}
+
+// ChainCredentialsProvider is a CredentialsProvider that tries a list of CredentialsProviders in order and returns
+// the credentials of the first one that succeeds.
+type ChainCredentialsProvider struct {
+	Providers []CredentialsProvider
+}
+
+// NewChainCredentialsProvider returns a ChainCredentialsProvider that tries providers in order.
+func NewChainCredentialsProvider(providers ...CredentialsProvider) *ChainCredentialsProvider {
+	return &ChainCredentialsProvider{Providers: providers}
+}
+
+// DefaultCredentialsProvider returns a ChainCredentialsProvider that reads the credentials from the environment
+// variables and then from the default profile of the credentials file.
+func DefaultCredentialsProvider() *ChainCredentialsProvider {
+	return NewChainCredentialsProvider(EnvCredentialsProvider{}, &FileCredentialsProvider{})
+}
+
+// Credentials is required to implement the CredentialsProvider interface.
+//
+// If none of the providers succeed, the returned error is a *CredentialsChainError that contains the error of each
+// provider. The chain stops early if ctx is cancelled.
+func (p *ChainCredentialsProvider) Credentials(ctx context.Context) (Credentials, error) {
+	chainErr := &CredentialsChainError{}
+
+	for _, provider := range p.Providers {
+		if err := ctx.Err(); err != nil {
+			return Credentials{}, err
+		}
+
+		creds, err := provider.Credentials(ctx)
+		if err == nil {
+			return creds, nil
+		}
+
+		chainErr.Errors = append(chainErr.Errors, err)
+	}
+
+	return Credentials{}, chainErr
+}
+
+// CredentialsChainError is returned by a ChainCredentialsProvider if none of its providers succeed. Errors contains the
+// error of each provider, in the order in which they were tried.
+//
+// If every provider returned an error that wraps ErrNoCredentials, errors.Is(err, ErrNoCredentials) is true.
+type CredentialsChainError struct {
+	Errors []error
+}
+
+func (e *CredentialsChainError) Error() string {
+	if len(e.Errors) == 0 {
+		return "no Veracode API credentials found: no credentials providers configured"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("no Veracode API credentials found, tried:")
+
+	for _, err := range e.Errors {
+		sb.WriteString("\n\t- ")
+		sb.WriteString(err.Error())
+	}
+
+	return sb.String()
+}
+
+// Is reports whether every provider of the chain returned an error that wraps target.
+func (e *CredentialsChainError) Is(target error) bool {
+	if len(e.Errors) == 0 {
+		return target == ErrNoCredentials
+	}
+
+	for _, err := range e.Errors {
+		if !errors.Is(err, target) {
+			return false
+		}
+	}
+	return true
+}
+
+// WithCredentialsProvider makes the Client get its credentials from provider for every request, instead of using the
+// credentials passed to [New]. It allows credentials to be rotated, or short-lived credentials to be read from a
+// secrets vault, without updating the Client.
+//
+// If the API key passed to [New] is empty, the region is derived from the credentials that provider returns when the
+// Client is created. The base URLs are not changed afterwards, so provider must keep returning credentials of the same
+// region.
+func WithCredentialsProvider(provider CredentialsProvider) ClientOption {
+	return func(cfg *clientConfig) error {
+		if provider == nil {
+			return fmt.Errorf("credentials provider must not be nil")
+		}
+
+		cfg.credentials = provider
+		return nil
+	}
+}
+
+type credentialsKey struct{}
+
+// WithCredentials returns a copy of ctx that makes the Client sign requests made with ctx using creds, instead of its
+// own credentials. It allows a single Client to make requests on behalf of multiple tenants.
+//
+// The base URLs of the Client are not changed, so creds must belong to the same region as the Client.
+func WithCredentials(ctx context.Context, creds Credentials) context.Context {
+	return context.WithValue(ctx, credentialsKey{}, creds)
+}
+
+// credentialsFromContext returns the credentials set on ctx using WithCredentials.
+func credentialsFromContext(ctx context.Context) (Credentials, bool) {
+	creds, ok := ctx.Value(credentialsKey{}).(Credentials)
+	return creds, ok
+}
@@ -0,0 +1,398 @@
+package veracode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/DanCreative/veracode-go/hmac"
+)
+
+const testCredentialsFile = `[default]
+veracode_api_key_id = default-id
+veracode_api_key_secret = default-secret
+
+[ci]
+veracode_api_key_id = ci-id
+veracode_api_key_secret = ci-secret
+
+[broken]
+veracode_api_key_id = broken-id
+`
+
+func writeTestCredentialsFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "credentials")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEnvCredentialsProvider(t *testing.T) {
+	tests := []struct {
+		name        string
+		key         string
+		secret      string
+		wantErr     bool
+		wantNoCreds bool
+	}{
+		{name: "set", key: "id", secret: "secret"},
+		{name: "not set", wantErr: true, wantNoCreds: true},
+		{name: "only key", key: "id", wantErr: true},
+		{name: "only secret", secret: "secret", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvAPIKeyID, tt.key)
+			t.Setenv(EnvAPIKeySecret, tt.secret)
+
+			creds, err := EnvCredentialsProvider{}.Credentials(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if errors.Is(err, ErrNoCredentials) != tt.wantNoCreds {
+				t.Errorf("errors.Is(err, ErrNoCredentials) = %t, expected %t", !tt.wantNoCreds, tt.wantNoCreds)
+			}
+
+			if err == nil && (creds.APIKeyID != tt.key || creds.APIKeySecret != tt.secret || creds.Source != "environment") {
+				t.Errorf("unexpected credentials: %+v", creds)
+			}
+		})
+	}
+}
+
+func TestFileCredentialsProvider(t *testing.T) {
+	path := writeTestCredentialsFile(t, testCredentialsFile)
+
+	tests := []struct {
+		name       string
+		path       string
+		profile    string
+		envProfile string
+		wantKey    string
+		wantErr    string
+	}{
+		{name: "default profile", path: path, wantKey: "default-id"},
+		{name: "named profile", path: path, profile: "ci", wantKey: "ci-id"},
+		{name: "profile from environment", path: path, envProfile: "ci", wantKey: "ci-id"},
+		{name: "profile overrides environment", path: path, profile: "default", envProfile: "ci", wantKey: "default-id"},
+		{name: "missing profile", path: path, profile: "prod", wantErr: `"prod"`},
+		{name: "incomplete profile", path: path, profile: "broken", wantErr: "profile broken does not contain"},
+		{name: "missing file", path: filepath.Join(t.TempDir(), "credentials"), wantErr: "does not exist"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvAPIProfile, tt.envProfile)
+
+			creds, err := (&FileCredentialsProvider{Path: tt.path, Profile: tt.profile}).Credentials(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error containing %q, got: %v", tt.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if creds.APIKeyID != tt.wantKey {
+				t.Errorf("got API key ID %q, expected %q", creds.APIKeyID, tt.wantKey)
+			}
+
+			if !strings.Contains(creds.Source, tt.path) {
+				t.Errorf("source %q does not contain the path of the file", creds.Source)
+			}
+		})
+	}
+}
+
+func TestFileCredentialsProvider_UnnamedProfile(t *testing.T) {
+	path := writeTestCredentialsFile(t, "veracode_api_key_id = id\nveracode_api_key_secret = secret\n")
+	t.Setenv(EnvAPIProfile, "")
+
+	creds, err := (&FileCredentialsProvider{Path: path}).Credentials(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if creds.APIKeyID != "id" || creds.APIKeySecret != "secret" {
+		t.Errorf("unexpected credentials: %+v", creds)
+	}
+}
+
+func TestChainCredentialsProvider(t *testing.T) {
+	t.Setenv(EnvAPIKeyID, "")
+	t.Setenv(EnvAPIKeySecret, "")
+
+	missing := &FileCredentialsProvider{Path: filepath.Join(t.TempDir(), "credentials")}
+	vault := CredentialsProviderFunc(func(ctx context.Context) (Credentials, error) {
+		return Credentials{APIKeyID: "vault-id", APIKeySecret: "vault-secret", Source: "vault"}, nil
+	})
+
+	t.Run("first success wins", func(t *testing.T) {
+		creds, err := NewChainCredentialsProvider(EnvCredentialsProvider{}, missing, vault, StaticCredentialsProvider{APIKeyID: "a", APIKeySecret: "b"}).Credentials(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if creds.Source != "vault" {
+			t.Errorf("got credentials from %q, expected vault", creds.Source)
+		}
+	})
+
+	t.Run("all fail", func(t *testing.T) {
+		_, err := NewChainCredentialsProvider(EnvCredentialsProvider{}, missing).Credentials(context.Background())
+
+		var chainErr *CredentialsChainError
+		if !errors.As(err, &chainErr) || len(chainErr.Errors) != 2 {
+			t.Fatalf("expected a CredentialsChainError with 2 errors, got: %v", err)
+		}
+
+		if !errors.Is(err, ErrNoCredentials) {
+			t.Error("expected the error to match ErrNoCredentials")
+		}
+
+		for _, want := range []string{EnvAPIKeyID, missing.Path} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("error does not explain why %s failed: %v", want, err)
+			}
+		}
+	})
+
+	t.Run("misconfigured source", func(t *testing.T) {
+		failing := CredentialsProviderFunc(func(ctx context.Context) (Credentials, error) {
+			return Credentials{}, errors.New("vault is sealed")
+		})
+
+		_, err := NewChainCredentialsProvider(EnvCredentialsProvider{}, failing).Credentials(context.Background())
+		if err == nil || errors.Is(err, ErrNoCredentials) {
+			t.Fatalf("expected an error that does not match ErrNoCredentials, got: %v", err)
+		}
+
+		if !strings.Contains(err.Error(), "vault is sealed") {
+			t.Errorf("error does not contain the error of the failing provider: %v", err)
+		}
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, err := NewChainCredentialsProvider(vault).Credentials(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got: %v", err)
+		}
+	})
+}
+
+// newVerifyingServer returns a server that verifies the signature of every request using keys and responds with the
+// API key ID that the request was signed with.
+func newVerifyingServer(t *testing.T, keys map[string]string) *httptest.Server {
+	t.Helper()
+
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		auth, err := hmac.Verify(r, func(apiKeyID string) (string, error) {
+			secret, ok := keys[apiKeyID]
+			if !ok {
+				return "", hmac.ErrUnknownKey
+			}
+			return secret, nil
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"api_id": %q}`, auth.ID)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// signedWith sends a request using c and returns the API key ID that the server received.
+func signedWith(ctx context.Context, c *Client) (string, error) {
+	req, err := c.NewRequest(ctx, "/api/authn/v2/api_credentials", http.MethodGet, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var creds APICredentials
+	if _, err := c.Do(req, &creds); err != nil {
+		return "", err
+	}
+	return creds.ApiId, nil
+}
+
+func TestClient_CredentialsProvider(t *testing.T) {
+	otherKey := strings.Repeat("b", 32)
+	server := newVerifyingServer(t, map[string]string{testApiKey: testApiSecret, otherKey: testApiSecret})
+
+	var current atomic.Pointer[Credentials]
+	current.Store(&Credentials{APIKeyID: testApiKey, APIKeySecret: testApiSecret})
+
+	provider := CredentialsProviderFunc(func(ctx context.Context) (Credentials, error) {
+		return *current.Load(), nil
+	})
+
+	c, err := New("", "", WithBaseURLs(server.URL, server.URL), WithCredentialsProvider(provider), WithRetryPolicy(NoRetryPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := signedWith(context.Background(), c); err != nil || got != testApiKey {
+		t.Fatalf("got %q, %v, expected %q", got, err, testApiKey)
+	}
+
+	// Rotated credentials are used for the next request.
+	current.Store(&Credentials{APIKeyID: otherKey, APIKeySecret: testApiSecret})
+
+	if got, err := signedWith(context.Background(), c); err != nil || got != otherKey {
+		t.Fatalf("got %q, %v, expected %q", got, err, otherKey)
+	}
+
+	// Credentials on the context take precedence over the provider.
+	ctx := WithCredentials(context.Background(), Credentials{APIKeyID: testApiKey, APIKeySecret: testApiSecret})
+
+	if got, err := signedWith(ctx, c); err != nil || got != testApiKey {
+		t.Fatalf("got %q, %v, expected %q", got, err, testApiKey)
+	}
+}
+
+func TestClient_SignerCache(t *testing.T) {
+	otherKey := strings.Repeat("b", 32)
+	server := newVerifyingServer(t, map[string]string{testApiKey: testApiSecret, otherKey: testApiSecret})
+
+	c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithRetryPolicy(NoRetryPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tenants := []context.Context{
+		WithCredentials(context.Background(), Credentials{APIKeyID: testApiKey, APIKeySecret: testApiSecret}),
+		WithCredentials(context.Background(), Credentials{APIKeyID: otherKey, APIKeySecret: testApiSecret}),
+	}
+
+	signers := make(map[*hmac.Signer]bool)
+	for range 3 {
+		for _, ctx := range tenants {
+			if _, err := signedWith(ctx, c); err != nil {
+				t.Fatal(err)
+			}
+
+			signer, err := c.transport.signerFor(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signers[signer] = true
+		}
+	}
+
+	// Calls that alternate between the tenants reuse the signer of each tenant.
+	if len(signers) != 2 || len(c.transport.signers.signers) != 2 {
+		t.Errorf("got %d signers and %d cached signers, expected 2", len(signers), len(c.transport.signers.signers))
+	}
+}
+
+func TestClient_CredentialsProvider_Error(t *testing.T) {
+	server := newVerifyingServer(t, nil)
+	calls := 0
+
+	provider := CredentialsProviderFunc(func(ctx context.Context) (Credentials, error) {
+		calls++
+		if calls == 1 {
+			return Credentials{APIKeyID: testApiKey, APIKeySecret: testApiSecret}, nil
+		}
+		return Credentials{}, errors.New("vault is sealed")
+	})
+
+	c, err := New("", "", WithCredentialsProvider(provider), WithRestBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := signedWith(context.Background(), c); err == nil || !strings.Contains(err.Error(), "vault is sealed") {
+		t.Errorf("expected the error of the provider, got: %v", err)
+	}
+
+	// The provider is not called when the Client is created if it does not need the API key.
+	if _, err := New("", "", WithCredentialsProvider(provider), WithRegion(Regions()["e"])); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New("", "", WithCredentialsProvider(provider)); err == nil {
+		t.Error("expected New to fail if the provider fails and the region cannot be derived")
+	}
+}
+
+func TestClient_CredentialsProvider_Region(t *testing.T) {
+	provider := StaticCredentialsProvider{APIKeyID: "vera01ei-" + testApiKey, APIKeySecret: "vera01ei-" + testApiSecret}
+
+	c, err := New("", "", WithCredentialsProvider(provider))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.baseRestURL.Host != "api.veracode.eu" {
+		t.Errorf("got base URL %s, expected the European region", c.baseRestURL)
+	}
+}
+
+// TestClient_UpdateCredentials_Concurrent is meant to be run with the race detector.
+func TestClient_UpdateCredentials_Concurrent(t *testing.T) {
+	otherKey := strings.Repeat("b", 32)
+	server := newVerifyingServer(t, map[string]string{testApiKey: testApiSecret, otherKey: testApiSecret})
+
+	c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithRetryPolicy(NoRetryPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+
+	for i := range 20 {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+			if _, err := signedWith(context.Background(), c); err != nil {
+				errs <- err
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+			key := testApiKey
+			if i%2 == 0 {
+				key = otherKey
+			}
+			c.UpdateCredentials(key, testApiSecret)
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
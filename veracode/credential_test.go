@@ -0,0 +1,244 @@
+package veracode
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const testCommentedCredentialsFile = `# Managed by the onboarding scripts.
+[default]
+; Rotated every 90 days.
+veracode_api_key_id = default-id
+veracode_api_key_secret = default-secret
+
+# CI pipelines
+[ci]
+veracode_api_key_id = ci-id
+veracode_api_key_secret = ci-secret
+region = eu
+`
+
+// readCredentialsFile returns the content of the credentials file at path and checks that it has 0600 permissions and
+// that no temporary files were left behind.
+func readCredentialsFile(t *testing.T, path string) string {
+	t.Helper()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+		t.Errorf("credentials file has permissions %#o, expected 0600", info.Mode().Perm())
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("expected only the credentials file in the directory, got %d entries", len(entries))
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestSaveProfile(t *testing.T) {
+	t.Run("new file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), ".veracode", "credentials")
+
+		if err := SaveProfile(path, Profile{Name: "default", VeracodeApiKeyId: "id", VeracodeApiKeySecret: "secret"}); err != nil {
+			t.Fatal(err)
+		}
+
+		readCredentialsFile(t, path)
+
+		profiles, err := GetProfiles(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p := profiles["default"]; p.VeracodeApiKeyId != "id" || p.VeracodeApiKeySecret != "secret" {
+			t.Errorf("unexpected profile: %+v", p)
+		}
+	})
+
+	t.Run("existing file", func(t *testing.T) {
+		path := writeTestCredentialsFile(t, testCommentedCredentialsFile)
+
+		if err := SaveProfile(path, Profile{Name: "ci", VeracodeApiKeyId: "new-id", VeracodeApiKeySecret: "new-secret"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := SaveProfile(path, Profile{Name: "prod", VeracodeApiKeyId: "prod-id", VeracodeApiKeySecret: "prod-secret"}); err != nil {
+			t.Fatal(err)
+		}
+
+		content := readCredentialsFile(t, path)
+
+		for _, want := range []string{"# Managed by the onboarding scripts.", "; Rotated every 90 days.", "# CI pipelines", "region", "default-secret"} {
+			if !strings.Contains(content, want) {
+				t.Errorf("credentials file does not contain %q:\n%s", want, content)
+			}
+		}
+
+		profiles, err := GetProfiles(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if profiles["ci"].VeracodeApiKeyId != "new-id" || profiles["prod"].VeracodeApiKeyId != "prod-id" || profiles["default"].VeracodeApiKeyId != "default-id" {
+			t.Errorf("unexpected profiles: %+v", profiles)
+		}
+	})
+
+	t.Run("empty profile", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "credentials")
+
+		if err := SaveProfile(path, Profile{Name: "default", VeracodeApiKeyId: "id"}); err == nil {
+			t.Error("expected an error for a profile without a secret")
+		}
+	})
+
+	t.Run("invalid name", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "credentials")
+
+		for _, name := range []string{"", "ci]\n[default", "[ci]", "ci\nveracode_api_key_id = other"} {
+			err := SaveProfile(path, Profile{Name: name, VeracodeApiKeyId: "id", VeracodeApiKeySecret: "secret"})
+			if !errors.Is(err, ErrInvalidProfileName) {
+				t.Errorf("expected ErrInvalidProfileName for %q, got: %v", name, err)
+			}
+		}
+
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Error("the credentials file was written")
+		}
+	})
+
+	t.Run("symbolic link", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("creating symbolic links requires privileges on Windows")
+		}
+
+		dir := t.TempDir()
+		target := writeTestCredentialsFile(t, testCommentedCredentialsFile)
+		link := filepath.Join(dir, "credentials")
+
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := SaveProfile(link, Profile{Name: "ci", VeracodeApiKeyId: "new-id", VeracodeApiKeySecret: "new-secret"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+			t.Fatalf("the symbolic link was replaced: %v", err)
+		}
+
+		if content := readCredentialsFile(t, target); !strings.Contains(content, "new-id") {
+			t.Errorf("the target of the link was not updated:\n%s", content)
+		}
+
+		// A link to a file that does not exist yet is kept as well.
+		dangling := filepath.Join(dir, "dangling")
+		if err := os.Symlink(filepath.Join(dir, "real", "credentials"), dangling); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := SaveProfile(dangling, Profile{Name: "default", VeracodeApiKeyId: "id", VeracodeApiKeySecret: "secret"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if profiles, err := GetProfiles(filepath.Join(dir, "real", "credentials")); err != nil || profiles["default"].VeracodeApiKeyId != "id" {
+			t.Errorf("the target of the dangling link was not written: %+v, %v", profiles, err)
+		}
+	})
+}
+
+func TestSaveProfile_InsecurePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows does not use Unix permission bits")
+	}
+
+	path := writeTestCredentialsFile(t, testCommentedCredentialsFile)
+	if err := os.Chmod(path, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := SaveProfile(path, Profile{Name: "ci", VeracodeApiKeyId: "new-id", VeracodeApiKeySecret: "new-secret"})
+	if !errors.Is(err, ErrInsecureCredentialsFile) {
+		t.Fatalf("expected ErrInsecureCredentialsFile, got: %v", err)
+	}
+
+	content, _ := os.ReadFile(path)
+	if string(content) != testCommentedCredentialsFile {
+		t.Error("the credentials file was modified")
+	}
+}
+
+func TestDeleteProfile(t *testing.T) {
+	path := writeTestCredentialsFile(t, testCommentedCredentialsFile)
+
+	if err := DeleteProfile(path, "ci"); err != nil {
+		t.Fatal(err)
+	}
+
+	content := readCredentialsFile(t, path)
+	if strings.Contains(content, "ci-id") || !strings.Contains(content, "default-id") {
+		t.Errorf("unexpected credentials file:\n%s", content)
+	}
+
+	if err := DeleteProfile(path, "ci"); !errors.Is(err, ErrProfileNotFound) {
+		t.Errorf("expected ErrProfileNotFound, got: %v", err)
+	}
+}
+
+func TestRenameProfile(t *testing.T) {
+	path := writeTestCredentialsFile(t, testCommentedCredentialsFile)
+
+	if err := RenameProfile(path, "ci", "pipelines"); err != nil {
+		t.Fatal(err)
+	}
+
+	content := readCredentialsFile(t, path)
+	for _, want := range []string{"[pipelines]", "# CI pipelines", "region"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("credentials file does not contain %q:\n%s", want, content)
+		}
+	}
+
+	profiles, err := GetProfiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := profiles["ci"]; ok {
+		t.Error("the old profile still exists")
+	}
+
+	if profiles["pipelines"].VeracodeApiKeySecret != "ci-secret" {
+		t.Errorf("unexpected profile: %+v", profiles["pipelines"])
+	}
+
+	if err := RenameProfile(path, "ci", "other"); !errors.Is(err, ErrProfileNotFound) {
+		t.Errorf("expected ErrProfileNotFound, got: %v", err)
+	}
+
+	if err := RenameProfile(path, "pipelines", "default"); !errors.Is(err, ErrProfileExists) {
+		t.Errorf("expected ErrProfileExists, got: %v", err)
+	}
+
+	if err := RenameProfile(path, "pipelines", "ci]\n[default"); !errors.Is(err, ErrInvalidProfileName) {
+		t.Errorf("expected ErrInvalidProfileName, got: %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package veracode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// CredentialStatus is the status of the API credentials of an API user in a [CredentialReport].
+type CredentialStatus int
+
+const (
+	CredentialsValid          CredentialStatus = iota // The credentials do not expire within CredentialReportOptions.ExpiringWithin, or do not expire at all.
+	CredentialsExpiring                               // The credentials expire within CredentialReportOptions.ExpiringWithin.
+	CredentialsExpired                                // The credentials have expired.
+	CredentialsNeverGenerated                         // The user does not have any credentials.
+	CredentialsUnknown                                // The credentials could not be retrieved. See CredentialReportEntry.Err.
+	CredentialsRevoked                                // The credentials have been revoked.
+)
+
+func (s CredentialStatus) String() string {
+	switch s {
+	case CredentialsValid:
+		return "valid"
+	case CredentialsExpiring:
+		return "expiring"
+	case CredentialsExpired:
+		return "expired"
+	case CredentialsNeverGenerated:
+		return "never generated"
+	case CredentialsUnknown:
+		return "unknown"
+	case CredentialsRevoked:
+		return "revoked"
+	default:
+		return fmt.Sprintf("CredentialStatus(%d)", int(s))
+	}
+}
+
+// CredentialReportOptions configures [IdentityService.APICredentialsReport].
+type CredentialReportOptions struct {
+	// ExpiringWithin is the period in which credentials that are about to expire are reported as CredentialsExpiring.
+	// The default is 30 days.
+	ExpiringWithin time.Duration
+
+	// Search filters the API users that are included in the report. UserType is always set to "api".
+	Search SearchUserOptions
+}
+
+// CredentialReportEntry is the status of the API credentials of a single API user.
+type CredentialReportEntry struct {
+	User        User
+	Credentials APICredentials // Zero if the user does not have any credentials or if they could not be retrieved.
+	Status      CredentialStatus
+	ExpiresIn   time.Duration // Time until the credentials expire. Negative if they have expired and zero if they do not have an expiration time.
+	Err         error         // Error that occurred while retrieving the credentials if Status is CredentialsUnknown.
+}
+
+// CredentialReport is a report of the expiry of the API credentials of the API users of an organization.
+type CredentialReport struct {
+	GeneratedAt    time.Time
+	ExpiringWithin time.Duration
+	Entries        []CredentialReportEntry
+}
+
+// ByStatus returns the entries with one of the provided statuses.
+func (r *CredentialReport) ByStatus(statuses ...CredentialStatus) []CredentialReportEntry {
+	var entries []CredentialReportEntry
+	for _, entry := range r.Entries {
+		for _, status := range statuses {
+			if entry.Status == status {
+				entries = append(entries, entry)
+				break
+			}
+		}
+	}
+	return entries
+}
+
+// Users returns the users of the entries with one of the provided statuses, for example to pass them to
+// [IdentityService.RegenerateAPICredentials].
+func (r *CredentialReport) Users(statuses ...CredentialStatus) []User {
+	var users []User
+	for _, entry := range r.ByStatus(statuses...) {
+		users = append(users, entry.User)
+	}
+	return users
+}
+
+// APICredentialsReport returns a report of the expiry of the API credentials of all API users. It searches the API users
+// using [IdentityService.SearchAllUsers] and gets the credentials of each user using
+// [IdentityService.GetCredentialsByUserId].
+//
+// An error is only returned if the users cannot be searched. Errors for individual users are reported in their entry
+// with status CredentialsUnknown.
+func (i *IdentityService) APICredentialsReport(ctx context.Context, options CredentialReportOptions) (*CredentialReport, error) {
+	if options.ExpiringWithin <= 0 {
+		options.ExpiringWithin = 30 * 24 * time.Hour
+	}
+
+	search := options.Search
+	search.UserType = "api"
+
+	users, _, err := i.SearchAllUsers(ctx, search)
+	if err != nil {
+		return nil, fmt.Errorf("could not search the API users: %w", err)
+	}
+
+	report := &CredentialReport{GeneratedAt: time.Now(), ExpiringWithin: options.ExpiringWithin}
+
+	for _, user := range users {
+		entry := CredentialReportEntry{User: user}
+
+		creds, _, err := i.GetCredentialsByUserId(ctx, user.UserId)
+
+		var verr Error
+		switch {
+		case errors.As(err, &verr) && verr.Code == http.StatusNotFound:
+			entry.Status = CredentialsNeverGenerated
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			entry.Status, entry.Err = CredentialsUnknown, err
+		case creds.ApiId == "":
+			entry.Status = CredentialsNeverGenerated
+		case !creds.RevocationTs.IsZero():
+			entry.Credentials = creds
+			entry.Status = CredentialsRevoked
+		case creds.ExpirationTs.IsZero():
+			// Credentials without an expiration time are not rotated by the CredentialRotator either.
+			entry.Credentials = creds
+			entry.Status = CredentialsValid
+		default:
+			entry.Credentials = creds
+			entry.ExpiresIn = creds.ExpirationTs.Sub(report.GeneratedAt)
+
+			switch {
+			case entry.ExpiresIn <= 0:
+				entry.Status = CredentialsExpired
+			case entry.ExpiresIn <= options.ExpiringWithin:
+				entry.Status = CredentialsExpiring
+			default:
+				entry.Status = CredentialsValid
+			}
+		}
+
+		report.Entries = append(report.Entries, entry)
+	}
+
+	return report, nil
+}
+
+// BulkCredentialsOptions configures [IdentityService.RegenerateAPICredentials] and
+// [IdentityService.RevokeAPICredentials].
+type BulkCredentialsOptions struct {
+	// DryRun reports the accounts that would be changed, without changing them.
+	DryRun bool
+}
+
+// BulkCredentialsResult is the result of a bulk action for a single API user.
+type BulkCredentialsResult struct {
+	User        User
+	Credentials APICredentials // The new credentials, if they were regenerated.
+	DryRun      bool           // Whether the action was skipped because of BulkCredentialsOptions.DryRun.
+	Err         error
+}
+
+// RegenerateAPICredentials generates new API credentials for each of the users using
+// [IdentityService.GenerateCredentialsByUserId], which revokes their current credentials. The result of each user is
+// returned in the order of users. The new API secrets are only available in the results.
+//
+// RegenerateAPICredentials stops early if ctx is done. The users that were not processed get the error of ctx.
+func (i *IdentityService) RegenerateAPICredentials(ctx context.Context, users []User, options BulkCredentialsOptions) []BulkCredentialsResult {
+	return bulkCredentials(ctx, users, options, func(ctx context.Context, user User) (APICredentials, error) {
+		creds, _, err := i.GenerateCredentialsByUserId(ctx, user.UserId)
+		return creds, err
+	})
+}
+
+// RevokeAPICredentials revokes the API credentials of each of the users using
+// [IdentityService.RevokeCredentialsByUserId]. The result of each user is returned in the order of users.
+//
+// RevokeAPICredentials stops early if ctx is done. The users that were not processed get the error of ctx.
+func (i *IdentityService) RevokeAPICredentials(ctx context.Context, users []User, options BulkCredentialsOptions) []BulkCredentialsResult {
+	return bulkCredentials(ctx, users, options, func(ctx context.Context, user User) (APICredentials, error) {
+		resp, err := i.RevokeCredentialsByUserId(ctx, user.UserId)
+
+		// The status of calls without a response body is not checked by Client.Do.
+		if err == nil && checkStatus(resp.Response) != nil {
+			err = Error{Code: resp.StatusCode, Endpoint: resp.Request.URL.Path}
+		}
+		return APICredentials{}, err
+	})
+}
+
+// bulkCredentials calls action for each of the users, unless options.DryRun is set.
+func bulkCredentials(ctx context.Context, users []User, options BulkCredentialsOptions, action func(context.Context, User) (APICredentials, error)) []BulkCredentialsResult {
+	results := make([]BulkCredentialsResult, len(users))
+
+	for k, user := range users {
+		results[k].User = user
+
+		if options.DryRun {
+			results[k].DryRun = true
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			results[k].Err = err
+			continue
+		}
+
+		results[k].Credentials, results[k].Err = action(ctx, user)
+	}
+
+	return results
+}
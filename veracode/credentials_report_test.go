@@ -0,0 +1,209 @@
+package veracode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Expiration times with a special meaning for newCredentialsReportServer.
+var (
+	revokedCredentials  = time.Unix(1, 0) // The credentials of the user have been revoked.
+	noExpiryCredentials = time.Unix(2, 0) // The credentials do not have an expiration time.
+)
+
+// newCredentialsReportServer returns a server with an API user for each of the expiration times. A zero expiration
+// time means that the user does not have credentials. The users are returned one per page.
+func newCredentialsReportServer(t *testing.T, expirations []time.Time) (*httptest.Server, *[]string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var calls []string
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/authn/v2/users/search", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("user_type") != "api" {
+			http.Error(w, "expected user_type=api", http.StatusBadRequest)
+			return
+		}
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+
+		var result userSearchResult
+		result.Embedded.Users = []User{{UserId: strconv.Itoa(page), UserName: fmt.Sprintf("api-%d", page)}}
+		result.Page = PageMeta{Number: page, Size: 1, TotalElements: len(expirations), TotalPages: len(expirations)}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+
+	mux.HandleFunc("/api/authn/v2/api_credentials/user_id/{id}", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.PathValue("id"))
+		mu.Unlock()
+
+		id, _ := strconv.Atoi(r.PathValue("id"))
+
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case id == 3:
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"message": "internal error"}`)
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost:
+			fmt.Fprintf(w, `{"api_id": "new-%d", "api_secret": "secret", "expiration_ts": %q}`, id, time.Now().AddDate(1, 0, 0).Format(time.RFC3339))
+		case expirations[id].IsZero():
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "No API credentials found"}`)
+		case expirations[id].Equal(revokedCredentials):
+			fmt.Fprintf(w, `{"api_id": "key-%d", "expiration_ts": %q, "revocation_ts": %q}`, id, time.Now().AddDate(0, 6, 0).Format(time.RFC3339), time.Now().Format(time.RFC3339))
+		case expirations[id].Equal(noExpiryCredentials):
+			fmt.Fprintf(w, `{"api_id": "key-%d"}`, id)
+		default:
+			fmt.Fprintf(w, `{"api_id": "key-%d", "expiration_ts": %q}`, id, expirations[id].Format(time.RFC3339))
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server, &calls
+}
+
+func TestIdentityService_APICredentialsReport(t *testing.T) {
+	now := time.Now()
+	server, _ := newCredentialsReportServer(t, []time.Time{
+		now.AddDate(0, 6, 0),   // 0: valid
+		now.AddDate(0, 0, 10),  // 1: expiring
+		now.AddDate(0, 0, -1),  // 2: expired
+		now.AddDate(0, 6, 0),   // 3: server error
+		{},                     // 4: never generated
+		now.AddDate(0, 0, 100), // 5: valid
+		revokedCredentials,     // 6: revoked
+		noExpiryCredentials,    // 7: no expiration time
+	})
+
+	c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithRetryPolicy(NoRetryPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := c.Identity.APICredentialsReport(context.Background(), CredentialReportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []CredentialStatus{CredentialsValid, CredentialsExpiring, CredentialsExpired, CredentialsUnknown, CredentialsNeverGenerated, CredentialsValid, CredentialsRevoked, CredentialsValid}
+	if len(report.Entries) != len(want) {
+		t.Fatalf("got %d entries, expected %d", len(report.Entries), len(want))
+	}
+
+	for k, entry := range report.Entries {
+		if entry.Status != want[k] {
+			t.Errorf("user %s has status %s, expected %s", entry.User.UserName, entry.Status, want[k])
+		}
+	}
+
+	if report.Entries[3].Err == nil {
+		t.Error("expected the error of the user to be reported")
+	}
+
+	if report.Entries[2].ExpiresIn >= 0 {
+		t.Errorf("expected a negative ExpiresIn for expired credentials, got %s", report.Entries[2].ExpiresIn)
+	}
+
+	if report.Entries[7].ExpiresIn != 0 || report.Entries[7].Credentials.ApiId != "key-7" {
+		t.Errorf("unexpected entry for credentials without an expiration time: %+v", report.Entries[7])
+	}
+
+	// With a longer period, more credentials are expiring.
+	report, err = c.Identity.APICredentialsReport(context.Background(), CredentialReportOptions{ExpiringWithin: 120 * 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(report.ByStatus(CredentialsExpiring)); got != 2 {
+		t.Errorf("got %d expiring credentials, expected 2", got)
+	}
+
+	if users := report.Users(CredentialsExpired, CredentialsNeverGenerated); len(users) != 2 || users[0].UserId != "2" || users[1].UserId != "4" {
+		t.Errorf("unexpected users: %+v", users)
+	}
+}
+
+func TestIdentityService_BulkAPICredentials(t *testing.T) {
+	server, calls := newCredentialsReportServer(t, make([]time.Time, 4))
+
+	c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithRetryPolicy(NoRetryPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := []User{{UserId: "1", UserName: "api-1"}, {UserId: "2", UserName: "api-2"}}
+
+	t.Run("dry run", func(t *testing.T) {
+		for _, results := range [][]BulkCredentialsResult{
+			c.Identity.RegenerateAPICredentials(context.Background(), users, BulkCredentialsOptions{DryRun: true}),
+			c.Identity.RevokeAPICredentials(context.Background(), users, BulkCredentialsOptions{DryRun: true}),
+		} {
+			if len(results) != 2 || !results[0].DryRun || !results[1].DryRun || results[1].User.UserName != "api-2" {
+				t.Errorf("unexpected results: %+v", results)
+			}
+		}
+
+		if len(*calls) != 0 {
+			t.Errorf("expected no calls in dry-run mode, got: %v", *calls)
+		}
+	})
+
+	t.Run("regenerate", func(t *testing.T) {
+		results := c.Identity.RegenerateAPICredentials(context.Background(), users, BulkCredentialsOptions{})
+
+		for k, result := range results {
+			if result.Err != nil || result.DryRun || result.Credentials.ApiId != "new-"+users[k].UserId {
+				t.Errorf("unexpected result: %+v", result)
+			}
+		}
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		*calls = nil
+
+		results := c.Identity.RevokeAPICredentials(context.Background(), append(users, User{UserId: "3", UserName: "api-3"}), BulkCredentialsOptions{})
+		for _, result := range results[:2] {
+			if result.Err != nil {
+				t.Errorf("unexpected error for %s: %v", result.User.UserName, result.Err)
+			}
+		}
+
+		var verr Error
+		if !errors.As(results[2].Err, &verr) || verr.Code != http.StatusInternalServerError {
+			t.Errorf("expected an API error for api-3, got: %v", results[2].Err)
+		}
+
+		if fmt.Sprint(*calls) != "[DELETE 1 DELETE 2 DELETE 3]" {
+			t.Errorf("unexpected calls: %v", *calls)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		for _, result := range c.Identity.RevokeAPICredentials(ctx, users, BulkCredentialsOptions{}) {
+			if result.Err != context.Canceled {
+				t.Errorf("expected context.Canceled for %s, got: %v", result.User.UserName, result.Err)
+			}
+		}
+	})
+}
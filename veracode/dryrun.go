@@ -0,0 +1,178 @@
+package veracode
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDryRun is returned for mutating calls that were recorded in a Plan instead of being sent. See [WithDryRun].
+var ErrDryRun = errors.New("dry run: request was not sent")
+
+// DryRunMode determines what calls that were recorded in a Plan return. See [WithDryRun].
+type DryRunMode int
+
+const (
+	// DryRunError makes recorded calls return an error that wraps ErrDryRun.
+	DryRunError DryRunMode = iota
+
+	// DryRunEcho makes recorded calls succeed with a synthesized 200 response, whose body is the request body.
+	// Calls to the XML APIs still return an error that wraps ErrDryRun.
+	DryRunEcho
+)
+
+// PlannedOperation is a mutating call that was recorded instead of being sent.
+type PlannedOperation struct {
+	Time     time.Time
+	Method   string
+	Endpoint string // Logical name of the endpoint, for example "Identity.UpdateTeam". See [EndpointName].
+	URL      string
+	Body     any    // The request body decoded from JSON or the raw body as a string if it is not JSON. Nil if there is no body.
+	Summary  string // Human-readable description of the operation.
+}
+
+// Plan records the mutating calls of a Client in dry-run mode. See [WithDryRun]. A Plan is safe for concurrent use.
+type Plan struct {
+	mu         sync.Mutex
+	operations []PlannedOperation
+}
+
+// Operations returns the recorded operations in the order in which they were made.
+func (p *Plan) Operations() []PlannedOperation {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r := make([]PlannedOperation, len(p.operations))
+	copy(r, p.operations)
+	return r
+}
+
+// Reset removes all recorded operations.
+func (p *Plan) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.operations = nil
+}
+
+// String returns a numbered list of the summaries of the recorded operations.
+func (p *Plan) String() string {
+	var sb strings.Builder
+	for i, op := range p.Operations() {
+		fmt.Fprintf(&sb, "%d. %s\n", i+1, op.Summary)
+	}
+	return sb.String()
+}
+
+func (p *Plan) add(op PlannedOperation) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.operations = append(p.operations, op)
+}
+
+// WithDryRun enables dry-run mode. POST, PUT, PATCH and DELETE requests are not sent, but recorded in plan. The mode
+// determines whether the calls return an error or succeed with an echo of the request. Other requests are sent as
+// usual, so that a dry run can read the current state of the platform.
+func WithDryRun(plan *Plan, mode DryRunMode) ClientOption {
+	return func(cfg *clientConfig) error {
+		if plan == nil {
+			return fmt.Errorf("dry run plan must not be nil")
+		}
+
+		cfg.dryRun = &dryRunTransport{plan: plan, mode: mode}
+		return nil
+	}
+}
+
+// dryRunTransport implements the http.RoundTripper interface. It records mutating requests in a Plan and passes
+// all other requests to the next http.RoundTripper.
+type dryRunTransport struct {
+	next    http.RoundTripper
+	plan    *Plan
+	mode    DryRunMode
+	bodyLog *bodyLogger // Used to redact secrets from summaries.
+}
+
+// RoundTrip is required to implement the http.RoundTripper interface.
+func (t *dryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return t.next.RoundTrip(req)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	op := PlannedOperation{
+		Time:     time.Now(),
+		Method:   req.Method,
+		Endpoint: EndpointName(req.Context()),
+		URL:      req.URL.String(),
+	}
+
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &op.Body); err != nil {
+			op.Body = string(body)
+		}
+	}
+
+	op.Summary = t.summarize(req, op.Endpoint, body)
+	t.plan.add(op)
+
+	if t.mode != DryRunEcho || strings.HasSuffix(req.URL.Path, ".do") {
+		return nil, fmt.Errorf("%w: %s", ErrDryRun, op.Summary)
+	}
+
+	if len(body) == 0 {
+		body = []byte("{}")
+	}
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// maxSummaryBodyLength is the maximum number of bytes of the request body that are included in a summary.
+const maxSummaryBodyLength = 200
+
+// summarize returns a human-readable description of a mutating request, in which secrets are redacted. For example:
+//
+//	Identity.UpdateTeam: PUT /api/authn/v2/teams/abcd?partial=true {"team_id":"abcd","team_name":"Team A"}
+func (t *dryRunTransport) summarize(req *http.Request, endpoint string, body []byte) string {
+	var sb strings.Builder
+
+	if endpoint != "" {
+		sb.WriteString(endpoint + ": ")
+	}
+
+	sb.WriteString(req.Method + " " + req.URL.RequestURI())
+
+	if len(body) > 0 {
+		sb.WriteString(" " + t.bodyLog.redactBody(body, maxSummaryBodyLength))
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,77 @@
+package veracode
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClient_DryRun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("%s request was sent in dry-run mode", r.Method)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+
+	t.Run("echo", func(t *testing.T) {
+		plan := &Plan{}
+
+		c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithDryRun(plan, DryRunEcho))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		partial := true
+		team, _, err := c.Identity.UpdateTeam(ctx, &Team{TeamId: "abcd", TeamName: "Team A"}, UpdateOptions{Partial: &partial})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if team.TeamName != "Team A" {
+			t.Errorf("IdentityService.UpdateTeam() = %+v, want an echo of the request", team)
+		}
+
+		if _, err := c.Healthcheck.GetStatus(ctx); err != nil {
+			t.Errorf("HealthCheckService.GetStatus() error = %v, want reads to be sent", err)
+		}
+
+		ops := plan.Operations()
+		if len(ops) != 1 {
+			t.Fatalf("plan contains %d operations, want 1", len(ops))
+		}
+
+		op := ops[0]
+		if op.Method != http.MethodPut || op.Endpoint != "Identity.UpdateTeam" || !strings.HasSuffix(op.URL, "/api/authn/v2/teams/abcd?partial=true") {
+			t.Errorf("planned operation = %s %s %s, want PUT Identity.UpdateTeam .../api/authn/v2/teams/abcd?partial=true", op.Method, op.Endpoint, op.URL)
+		}
+		if body, ok := op.Body.(map[string]any); !ok || body["team_name"] != "Team A" {
+			t.Errorf("planned operation body = %v, want the decoded team", op.Body)
+		}
+		if want := `Identity.UpdateTeam: PUT /api/authn/v2/teams/abcd?partial=true {"team_id":"abcd","team_name":"Team A"}`; op.Summary != want {
+			t.Errorf("planned operation summary = %s, want %s", op.Summary, want)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		plan := &Plan{}
+
+		c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithDryRun(plan, DryRunError))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = c.Application.DeleteApplication(ctx, "0b8a2f3e-1c4d-4e5f-8a9b-0c1d2e3f4a5b")
+		if !errors.Is(err, ErrDryRun) {
+			t.Errorf("ApplicationService.DeleteApplication() error = %v, want %v", err, ErrDryRun)
+		}
+
+		if want := "1. Application.DeleteApplication: DELETE /appsec/v1/applications/0b8a2f3e-1c4d-4e5f-8a9b-0c1d2e3f4a5b\n"; plan.String() != want {
+			t.Errorf("Plan.String() = %q, want %q", plan.String(), want)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package veracode
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Hooks contains functions that the Client calls around every request that is sent using [Client.Do].
+// Either function can be nil.
+//
+// Hooks can be used for audit logging, per-endpoint metrics or adding headers to requests, without having to wrap
+// every service method. Use [EndpointName] to get the logical name of the endpoint (for example "Identity.ListUsers")
+// from the request's context.
+type Hooks struct {
+	// BeforeRequest is called before the request is sent. The request can be modified, for example to add headers.
+	BeforeRequest func(req *http.Request)
+
+	// AfterResponse is called after the response has been decoded, with the error that is returned to the caller.
+	// This includes the errors that the XML APIs return with a 200 status code. The duration is the total time
+	// that was spent in Client.Do, including retries.
+	//
+	// resp is never nil, but resp.Response is nil if no response was received, for example because of a network
+	// error, an open circuit breaker (see [ErrCircuitOpen]) or credentials that cannot be retrieved. Check
+	// resp.Response before reading the status code or headers when err is not nil.
+	AfterResponse func(resp *Response, err error, duration time.Duration)
+
+	// OnCircuitStateChange is called when the state of the circuit breaker changes. See [WithCircuitBreaker].
+	OnCircuitStateChange func(from, to CircuitState)
+}
+
+// WithHooks registers hooks on the Client. See [Hooks].
+func WithHooks(hooks ...Hooks) ClientOption {
+	return func(cfg *clientConfig) error {
+		cfg.hooks = append(cfg.hooks, hooks...)
+		return nil
+	}
+}
+
+// AddHooks registers hooks on the Client after it has been created. The hooks are called for all requests
+// that start after AddHooks returns.
+func (c *Client) AddHooks(hooks Hooks) {
+	c.rwMu.Lock()
+	defer c.rwMu.Unlock()
+
+	c.hooks = append(c.hooks[:len(c.hooks):len(c.hooks)], hooks)
+}
+
+type endpointNameKey struct{}
+
+// WithEndpointName returns a copy of ctx that sets the logical endpoint name of requests created with
+// [Client.NewRequest]. This is useful for custom endpoints, where the name that is derived from the calling
+// function is not descriptive.
+func WithEndpointName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, endpointNameKey{}, name)
+}
+
+// EndpointName returns the logical name of the endpoint that a request created with [Client.NewRequest] is for,
+// for example "Identity.ListUsers". It returns an empty string if ctx does not contain an endpoint name.
+func EndpointName(ctx context.Context) string {
+	name, _ := ctx.Value(endpointNameKey{}).(string)
+	return name
+}
+
+// callerEndpointName derives the endpoint name from the function that is skip frames above the caller
+// of callerEndpointName.
+//
+// For example: "github.com/DanCreative/veracode-go/veracode.(*IdentityService).ListUsers" becomes "Identity.ListUsers".
+func callerEndpointName(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return ""
+	}
+
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return ""
+	}
+
+	return endpointNameFromFunc(fn.Name())
+}
+
+// endpointNameFromFunc converts a fully qualified function name into an endpoint name.
+func endpointNameFromFunc(name string) string {
+	// Remove the import path and the package name.
+	name = name[strings.LastIndex(name, "/")+1:]
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+
+	name = strings.NewReplacer("(*", "", "(", "", ")", "").Replace(name)
+
+	if typeName, method, ok := strings.Cut(name, "."); ok {
+		name = strings.TrimSuffix(typeName, "Service") + "." + method
+	}
+
+	return name
+}
@@ -0,0 +1,105 @@
+package veracode
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClient_Do_Hooks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Audit") != "yes" {
+			t.Errorf("header added by BeforeRequest is missing")
+		}
+
+		switch r.URL.Path {
+		case "/api/authn/v2/users":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"_embedded":{"users":[]},"page":{"total_elements":0}}`))
+		case "/api/5.0/getbuildinfo.do":
+			w.Header().Set("Content-Type", "text/xml")
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><error>App not found.</error>`))
+		}
+	}))
+	defer server.Close()
+
+	type call struct {
+		before   string
+		after    string
+		status   int
+		err      error
+		duration time.Duration
+	}
+	var calls []call
+
+	c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithHooks(Hooks{
+		BeforeRequest: func(req *http.Request) {
+			req.Header.Set("X-Audit", "yes")
+			calls = append(calls, call{before: EndpointName(req.Context())})
+		},
+		AfterResponse: func(resp *Response, err error, duration time.Duration) {
+			last := &calls[len(calls)-1]
+			last.after, last.err, last.duration = resp.Endpoint, err, duration
+			if resp.Response != nil {
+				last.status = resp.StatusCode
+			}
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	if _, _, err := c.Identity.ListUsers(ctx, ListUserOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := c.UploadXML.GetBuildInfo(ctx, BuildInfoOptions{AppId: 1}); err == nil {
+		t.Fatal("UploadXMLService.GetBuildInfo() error = nil, want an error")
+	}
+
+	if len(calls) != 2 {
+		t.Fatalf("hooks were called for %d requests, want 2", len(calls))
+	}
+
+	want := []string{"Identity.ListUsers", "UploadXML.GetBuildInfo"}
+	for i, call := range calls {
+		if call.before != want[i] || call.after != want[i] {
+			t.Errorf("call %d: endpoint names = %q, %q, want %q", i, call.before, call.after, want[i])
+		}
+		if call.status != http.StatusOK {
+			t.Errorf("call %d: status = %d, want %d", i, call.status, http.StatusOK)
+		}
+		if call.duration <= 0 {
+			t.Errorf("call %d: duration = %s, want a positive duration", i, call.duration)
+		}
+	}
+
+	var verr Error
+	if !errors.As(calls[1].err, &verr) {
+		t.Errorf("AfterResponse error = %v, want a veracode.Error", calls[1].err)
+	}
+}
+
+func TestEndpointNameFromFunc(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   string
+		want string
+	}{
+		{name: "service method", fn: "github.com/DanCreative/veracode-go/veracode.(*IdentityService).ListUsers", want: "Identity.ListUsers"},
+		{name: "custom client method", fn: "example.com/tool/internal/api.(*Client).GetEntity", want: "Client.GetEntity"},
+		{name: "function", fn: "main.listEntities", want: "listEntities"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := endpointNameFromFunc(tt.fn); got != tt.want {
+				t.Errorf("endpointNameFromFunc() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
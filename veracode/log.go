@@ -0,0 +1,252 @@
+package veracode
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const redacted = "REDACTED"
+
+// LogOptions configures the debug logging of the Client. See [WithLogOptions].
+//
+// Request and response bodies are only logged if the Client's logger is enabled for [slog.LevelDebug].
+type LogOptions struct {
+	MaxRequestBodyBytes  int      // Maximum number of bytes of a request body that is logged. Defaults to 4096. A negative value disables request body logging.
+	MaxResponseBodyBytes int      // Maximum number of bytes of a response body that is logged. Defaults to 4096. A negative value disables response body logging.
+	RedactFields         []string // Names of additional JSON fields whose values are redacted from logged bodies. The "api_secret" field is always redacted.
+}
+
+// redactHeaders contains the headers whose values are never logged.
+var redactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// redactFields contains the JSON fields whose values are never logged.
+var redactFields = []string{"api_secret", "veracode_api_key_secret"}
+
+// WithLogger sets the logger that the Client uses to log every API call.
+//
+// Completed calls are logged at [slog.LevelInfo] and failed calls at [slog.LevelWarn], with the method, endpoint,
+// status, duration, number of attempts and the messages of the Veracode error. Retries are logged at
+// [slog.LevelWarn]. Request and response bodies are logged at [slog.LevelDebug] (see [LogOptions]).
+//
+// The Authorization header and API secrets are always redacted.
+func WithLogger(logger *slog.Logger) ClientOption {
+	return func(cfg *clientConfig) error {
+		if logger == nil {
+			return fmt.Errorf("logger must not be nil")
+		}
+
+		cfg.logger = logger
+		return nil
+	}
+}
+
+// WithLogOptions configures the debug logging of request and response bodies. See [LogOptions].
+func WithLogOptions(options LogOptions) ClientOption {
+	return func(cfg *clientConfig) error {
+		cfg.logOptions = options
+		return nil
+	}
+}
+
+// bodyLogger logs request and response bodies according to the LogOptions.
+type bodyLogger struct {
+	logger       *slog.Logger
+	maxRequest   int
+	maxResponse  int
+	redactFields map[string]bool
+	redactText   *regexp.Regexp // Matches the string values of the redacted fields in bodies that cannot be parsed.
+}
+
+func newBodyLogger(logger *slog.Logger, options LogOptions) *bodyLogger {
+	b := &bodyLogger{
+		logger:       logger,
+		maxRequest:   options.MaxRequestBodyBytes,
+		maxResponse:  options.MaxResponseBodyBytes,
+		redactFields: make(map[string]bool),
+	}
+
+	if b.maxRequest == 0 {
+		b.maxRequest = 4096
+	}
+
+	if b.maxResponse == 0 {
+		b.maxResponse = 4096
+	}
+
+	var quoted []string
+	for _, field := range slices.Concat(redactFields, options.RedactFields) {
+		b.redactFields[strings.ToLower(field)] = true
+		quoted = append(quoted, regexp.QuoteMeta(field))
+	}
+
+	// The closing quote of a value is optional, because the value of a truncated body can be cut off.
+	b.redactText = regexp.MustCompile(`(?i)("(?:` + strings.Join(quoted, "|") + `)"\s*:\s*)"(?:[^"\\]|\\.)*"?`)
+
+	return b
+}
+
+// logRequest logs the headers and body of a single attempt at debug level.
+func (b *bodyLogger) logRequest(req *http.Request, attempt int) {
+	ctx := req.Context()
+	if !b.logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("endpoint", EndpointName(ctx)),
+		slog.String("url", req.URL.Redacted()),
+		slog.Int("attempt", attempt),
+		slog.Any("headers", redactHeaderValues(req.Header)),
+	}
+
+	if b.maxRequest > 0 && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			buf, _ := io.ReadAll(body)
+			body.Close()
+			attrs = append(attrs, slog.String("body", b.redactBody(buf, b.maxRequest)))
+		}
+	}
+
+	b.logger.LogAttrs(ctx, slog.LevelDebug, "veracode api request", attrs...)
+}
+
+// logResponse logs the headers and body of the response of req at debug level. Only the part of the body that is
+// logged is read. It is put back in front of the rest of the body, so that the body can still be decoded afterwards.
+//
+// req is the request that was passed to the http.Client, because resp.Request is not set by every http.RoundTripper.
+func (b *bodyLogger) logResponse(req *http.Request, resp *http.Response) {
+	ctx := req.Context()
+	if !b.logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("endpoint", EndpointName(ctx)),
+		slog.Int("status", resp.StatusCode),
+		slog.Any("headers", redactHeaderValues(resp.Header)),
+	}
+
+	if b.maxResponse > 0 {
+		// One byte more than the maximum is read to find out whether the body is truncated.
+		buf, err := io.ReadAll(io.LimitReader(resp.Body, int64(b.maxResponse)+1))
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), resp.Body), resp.Body}
+
+		if err != nil {
+			attrs = append(attrs, slog.String("body_error", err.Error()))
+		}
+
+		if len(buf) <= b.maxResponse {
+			attrs = append(attrs, slog.String("body", b.redactBody(buf, b.maxResponse)))
+		} else {
+			// The size of the rest of the body is only known from the Content-Length header.
+			truncated := "...(truncated)"
+			if resp.ContentLength > 0 {
+				truncated = fmt.Sprintf("...(%d bytes truncated)", resp.ContentLength-int64(b.maxResponse))
+			}
+			attrs = append(attrs, slog.String("body", b.redactBody(buf[:b.maxResponse], b.maxResponse)+truncated))
+		}
+	}
+
+	b.logger.LogAttrs(ctx, slog.LevelDebug, "veracode api response", attrs...)
+}
+
+// redactBody redacts the secret fields from a JSON body and truncates the result to max bytes.
+// In bodies that cannot be parsed, for example because they are truncated, the string values of the secret fields
+// are redacted textually.
+func (b *bodyLogger) redactBody(body []byte, max int) string {
+	var v any
+	if json.Unmarshal(body, &v) == nil {
+		if buf, err := json.Marshal(redactValue(v, b.redactFields)); err == nil {
+			body = buf
+		}
+	} else {
+		body = b.redactText.ReplaceAll(body, []byte(`${1}"`+redacted+`"`))
+	}
+
+	if len(body) > max {
+		return fmt.Sprintf("%s...(%d bytes truncated)", body[:max], len(body)-max)
+	}
+
+	return string(body)
+}
+
+// redactValue replaces the values of all object keys in fields, at any depth.
+func redactValue(v any, fields map[string]bool) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if fields[strings.ToLower(key)] {
+				v[key] = redacted
+			} else {
+				v[key] = redactValue(value, fields)
+			}
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = redactValue(value, fields)
+		}
+	}
+	return v
+}
+
+// redactHeaderValues returns a copy of h in which the values of sensitive headers are redacted.
+func redactHeaderValues(h http.Header) http.Header {
+	r := h.Clone()
+	for _, name := range redactHeaders {
+		if values := r.Values(name); len(values) > 0 {
+			r.Set(name, redacted)
+		}
+	}
+	return r
+}
+
+// logCall logs the outcome of a call to Client.Do.
+func logCall(logger *slog.Logger, req *http.Request, resp *Response, err error, duration time.Duration) {
+	ctx := req.Context()
+
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelWarn
+	}
+
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("endpoint", EndpointName(ctx)),
+		slog.String("path", req.URL.Path),
+		slog.Duration("duration", duration),
+		slog.Int("attempts", resp.Attempts),
+	}
+
+	if resp.Response != nil {
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	}
+
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+
+		var verr Error
+		if errors.As(err, &verr) {
+			attrs = append(attrs, slog.Any("messages", verr.Messages))
+		}
+	}
+
+	logger.LogAttrs(ctx, level, "veracode api call", attrs...)
+}
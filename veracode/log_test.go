@@ -0,0 +1,162 @@
+package veracode
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestClient_Do_LogRedaction(t *testing.T) {
+	const secret = "c0ffeec0ffeec0ffee"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"api_id":"abc","api_secret":"` + secret + `","nested":{"token":"` + secret + `"}}`))
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	c, err := New(testApiKey, testApiSecret,
+		WithBaseURLs(server.URL, server.URL),
+		WithLogger(logger),
+		WithLogOptions(LogOptions{RedactFields: []string{"token"}}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds, _, err := c.Identity.SelfGetCredentials(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if creds.ApiSecret != secret {
+		t.Errorf("APICredentials.ApiSecret = %q, want %q: logging must not change the decoded body", creds.ApiSecret, secret)
+	}
+
+	logger.Info("credentials loaded", "credentials", creds)
+
+	out := buf.String()
+	if strings.Contains(out, secret) {
+		t.Errorf("log output contains the API secret:\n%s", out)
+	}
+	if strings.Contains(out, "VERACODE-HMAC-SHA-256") {
+		t.Errorf("log output contains the Authorization header:\n%s", out)
+	}
+	for _, want := range []string{`"endpoint":"Identity.SelfGetCredentials"`, `"status":200`, `"attempts":1`, `"msg":"veracode api response"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log output does not contain %s:\n%s", want, out)
+		}
+	}
+}
+
+func TestClient_Do_ResponseWithoutRequest(t *testing.T) {
+	// The stub does not set Response.Request, like many custom transports and test stubs.
+	stub := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"user_id":"abc"}`)),
+		}, nil
+	})
+
+	tests := []struct {
+		name string
+		opts []ClientOption
+	}{
+		{name: "logging disabled"},
+		{name: "debug logging", opts: []ClientOption{WithLogger(slog.New(slog.NewJSONHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelDebug})))}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(testApiKey, testApiSecret, append(tt.opts, WithHTTPClient(&http.Client{Transport: stub}))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			user, _, err := c.Identity.GetUser(context.Background(), "abc", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.UserId != "abc" {
+				t.Errorf("IdentityService.GetUser() user id = %q, want %q", user.UserId, "abc")
+			}
+		})
+	}
+}
+
+func TestClient_Do_LogLargeResponse(t *testing.T) {
+	const secret = "c0ffeec0ffeec0ffee"
+
+	report := `{"api_secret":"` + secret + `","findings":"` + strings.Repeat("x", 1<<20) + `"}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(report)))
+		w.Write([]byte(report))
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithLogger(logger), WithLogOptions(LogOptions{MaxResponseBodyBytes: 64}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := c.NewRequest(context.Background(), "/report", http.MethodGet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body struct {
+		Findings string `json:"findings"`
+	}
+	if _, err := c.Do(req, &body); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(body.Findings) != 1<<20 {
+		t.Errorf("decoded findings have %d bytes, want %d: logging must not change the decoded body", len(body.Findings), 1<<20)
+	}
+
+	out := buf.String()
+	if strings.Contains(out, secret) {
+		t.Errorf("log output contains the API secret:\n%s", out)
+	}
+	if want := fmt.Sprintf("(%d bytes truncated)", len(report)-64); !strings.Contains(out, want) {
+		t.Errorf("log output does not contain %s:\n%.500s", want, out)
+	}
+}
+
+func TestBodyLogger_redactBody(t *testing.T) {
+	b := newBodyLogger(slog.New(slog.DiscardHandler), LogOptions{RedactFields: []string{"Password"}})
+
+	tests := []struct {
+		name string
+		body string
+		max  int
+		want string
+	}{
+		{name: "redacts nested fields", body: `{"users":[{"password":"x"}],"api_secret":"y"}`, max: 100, want: `{"api_secret":"REDACTED","users":[{"password":"REDACTED"}]}`},
+		{name: "truncates", body: `<buildinfo app_id="1"/>`, max: 10, want: `<buildinfo...(13 bytes truncated)`},
+		{name: "redacts fields of truncated json", body: `{"api_secret":"y","users":[{"Password":"x\"z"},{"password":"cut`, max: 100, want: `{"api_secret":"REDACTED","users":[{"Password":"REDACTED"},{"password":"REDACTED"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := b.redactBody([]byte(tt.body), tt.max); got != tt.want {
+				t.Errorf("bodyLogger.redactBody() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
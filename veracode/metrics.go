@@ -0,0 +1,293 @@
+package veracode
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RequestMetric describes a single attempt that was sent by the Client's transport.
+type RequestMetric struct {
+	Endpoint      string        // Endpoint template, in which IDs are replaced with "{id}". For example: "/api/authn/v2/users/{id}".
+	Method        string        // HTTP method of the request.
+	StatusClass   string        // Class of the response status: "1xx", "2xx", "3xx", "4xx", "5xx" or "error" if no response was received.
+	Latency       time.Duration // Time between sending the request and receiving the response headers.
+	RateLimitWait time.Duration // Time that the request waited for the client-side rate and concurrency limits.
+	Coalesced     bool          // Whether the request was not sent, because it was coalesced with an identical request. Latency is the time it waited. See [WithCoalescing].
+}
+
+// MetricsCollector receives a RequestMetric for every attempt that the Client's transport sends, including retries.
+// Attempts that fail in the transport before they are sent, for example with [ErrCircuitOpen] or because the request
+// cannot be signed, are reported with StatusClass "error". Calls that fail before they reach the transport, for
+// example because the credentials cannot be retrieved, are not reported. See [WithMetrics].
+//
+// A RequestMetric is also reported for every call that was coalesced with an identical request (see [WithCoalescing]).
+//
+// ObserveRequest is called concurrently and should not block.
+type MetricsCollector interface {
+	ObserveRequest(m RequestMetric)
+}
+
+// WithMetrics sets the MetricsCollector that receives the metrics of every attempt. See [InMemoryMetrics] for a
+// built-in collector.
+func WithMetrics(collector MetricsCollector) ClientOption {
+	return func(cfg *clientConfig) error {
+		cfg.metrics = collector
+		return nil
+	}
+}
+
+// statusClass returns the class of the response's status code.
+func statusClass(resp *http.Response, err error) string {
+	if err != nil || resp == nil {
+		return "error"
+	}
+	return strconv.Itoa(resp.StatusCode/100) + "xx"
+}
+
+var (
+	guidSegment   = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	apiKeySegment = regexp.MustCompile(`^([a-zA-Z0-9]{8}-)?[0-9a-fA-F]{32}$`)
+)
+
+// endpointTemplate replaces the segments of path that contain IDs with "{id}", so that requests for different
+// entities of the same endpoint are grouped together.
+func endpointTemplate(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if isIdSegment(segment) {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// isIdSegment reports whether a path segment is a numeric ID, a GUID or an API key ID.
+func isIdSegment(segment string) bool {
+	if segment == "" {
+		return false
+	}
+
+	if _, err := strconv.ParseUint(segment, 10, 64); err == nil {
+		return true
+	}
+
+	return guidSegment.MatchString(segment) || apiKeySegment.MatchString(segment)
+}
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the histogram buckets used by [InMemoryMetrics].
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// InMemoryMetrics is a MetricsCollector that keeps counters and histograms in memory.
+//
+// The metrics can be published using expvar, since InMemoryMetrics implements the [expvar.Var] interface:
+//
+//	expvar.Publish("veracode", metrics)
+//
+// They can also be served in the Prometheus text format using [InMemoryMetrics.Handler].
+type InMemoryMetrics struct {
+	mu      sync.Mutex
+	buckets []float64
+	series  map[seriesKey]*metricSeries
+}
+
+type seriesKey struct {
+	Endpoint    string
+	Method      string
+	StatusClass string
+}
+
+// metricSeries contains the metrics for a single combination of endpoint, method and status class.
+type metricSeries struct {
+	count     uint64
+	coalesced uint64
+	latency   histogram
+	wait      histogram
+}
+
+type histogram struct {
+	counts []uint64 // Number of observations per bucket (not cumulative). The last element counts observations above the highest bound.
+	sum    float64
+}
+
+func (h *histogram) observe(bounds []float64, v float64) {
+	i, _ := slices.BinarySearch(bounds, v)
+	h.counts[i]++
+	h.sum += v
+}
+
+// NewInMemoryMetrics returns a new InMemoryMetrics that uses the provided histogram bucket bounds (in seconds).
+// If no buckets are provided, [DefaultLatencyBuckets] are used.
+func NewInMemoryMetrics(buckets ...float64) *InMemoryMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+
+	return &InMemoryMetrics{
+		buckets: buckets,
+		series:  make(map[seriesKey]*metricSeries),
+	}
+}
+
+// ObserveRequest implements the MetricsCollector interface.
+func (m *InMemoryMetrics) ObserveRequest(rm RequestMetric) {
+	key := seriesKey{Endpoint: rm.Endpoint, Method: rm.Method, StatusClass: rm.StatusClass}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.series[key]
+	if !ok {
+		// The histograms are created with the series, because series that only contain coalesced calls are also
+		// written by WritePrometheus.
+		s = &metricSeries{
+			latency: histogram{counts: make([]uint64, len(m.buckets)+1)},
+			wait:    histogram{counts: make([]uint64, len(m.buckets)+1)},
+		}
+		m.series[key] = s
+	}
+
+	if rm.Coalesced {
+		s.coalesced++
+		return
+	}
+
+	s.count++
+	s.latency.observe(m.buckets, rm.Latency.Seconds())
+	s.wait.observe(m.buckets, rm.RateLimitWait.Seconds())
+}
+
+// MetricsSnapshot contains the metrics for a single combination of endpoint, method and status class.
+type MetricsSnapshot struct {
+	Endpoint           string  `json:"endpoint"`
+	Method             string  `json:"method"`
+	StatusClass        string  `json:"status_class"`
+	Count              uint64  `json:"count"`
+	Coalesced          uint64  `json:"coalesced"`
+	LatencySeconds     float64 `json:"latency_seconds_sum"`
+	RateLimitWaitTotal float64 `json:"rate_limit_wait_seconds_sum"`
+}
+
+// Snapshot returns the current counters, sorted by endpoint, method and status class.
+func (m *InMemoryMetrics) Snapshot() []MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r := make([]MetricsSnapshot, 0, len(m.series))
+	for _, key := range m.sortedKeys() {
+		s := m.series[key]
+		r = append(r, MetricsSnapshot{
+			Endpoint:           key.Endpoint,
+			Method:             key.Method,
+			StatusClass:        key.StatusClass,
+			Count:              s.count,
+			Coalesced:          s.coalesced,
+			LatencySeconds:     s.latency.sum,
+			RateLimitWaitTotal: s.wait.sum,
+		})
+	}
+	return r
+}
+
+// String implements the [expvar.Var] interface. It returns the Snapshot as JSON.
+func (m *InMemoryMetrics) String() string {
+	buf, err := json.Marshal(m.Snapshot())
+	if err != nil {
+		return "[]"
+	}
+	return string(buf)
+}
+
+// Handler returns an http.Handler that serves the metrics in the Prometheus text exposition format.
+//
+// The following metrics are exposed, all labelled with endpoint, method and status_class:
+//   - veracode_requests_total (counter)
+//   - veracode_coalesced_requests_total (counter)
+//   - veracode_request_duration_seconds (histogram)
+//   - veracode_rate_limit_wait_seconds (histogram)
+func (m *InMemoryMetrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.WritePrometheus(w)
+	})
+}
+
+// WritePrometheus writes the metrics to w in the Prometheus text exposition format. See [InMemoryMetrics.Handler].
+func (m *InMemoryMetrics) WritePrometheus(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := m.sortedKeys()
+	var sb strings.Builder
+
+	sb.WriteString("# HELP veracode_requests_total Number of requests sent to the Veracode APIs.\n")
+	sb.WriteString("# TYPE veracode_requests_total counter\n")
+	for _, key := range keys {
+		fmt.Fprintf(&sb, "veracode_requests_total{%s} %d\n", key.labels(), m.series[key].count)
+	}
+
+	sb.WriteString("# HELP veracode_coalesced_requests_total Number of calls that were coalesced with an identical request in flight.\n")
+	sb.WriteString("# TYPE veracode_coalesced_requests_total counter\n")
+	for _, key := range keys {
+		fmt.Fprintf(&sb, "veracode_coalesced_requests_total{%s} %d\n", key.labels(), m.series[key].coalesced)
+	}
+
+	m.writeHistogram(&sb, keys, "veracode_request_duration_seconds", "Latency of requests sent to the Veracode APIs.",
+		func(s *metricSeries) *histogram { return &s.latency })
+	m.writeHistogram(&sb, keys, "veracode_rate_limit_wait_seconds", "Time requests waited for the client-side rate limiter.",
+		func(s *metricSeries) *histogram { return &s.wait })
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func (m *InMemoryMetrics) writeHistogram(sb *strings.Builder, keys []seriesKey, name, help string, get func(*metricSeries) *histogram) {
+	fmt.Fprintf(sb, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(sb, "# TYPE %s histogram\n", name)
+
+	for _, key := range keys {
+		s := m.series[key]
+		h := get(s)
+		labels := key.labels()
+
+		var cumulative uint64
+		for i, bound := range m.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(sb, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(sb, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, s.count)
+		fmt.Fprintf(sb, "%s_sum{%s} %s\n", name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(sb, "%s_count{%s} %d\n", name, labels, s.count)
+	}
+}
+
+// sortedKeys returns the keys of all series in a stable order. The caller must hold m.mu.
+func (m *InMemoryMetrics) sortedKeys() []seriesKey {
+	keys := make([]seriesKey, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+
+	slices.SortFunc(keys, func(a, b seriesKey) int {
+		return strings.Compare(a.Endpoint+" "+a.Method+" "+a.StatusClass, b.Endpoint+" "+b.Method+" "+b.StatusClass)
+	})
+
+	return keys
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (k seriesKey) labels() string {
+	return fmt.Sprintf(`endpoint="%s",method="%s",status_class="%s"`,
+		labelEscaper.Replace(k.Endpoint), labelEscaper.Replace(k.Method), labelEscaper.Replace(k.StatusClass))
+}
@@ -0,0 +1,145 @@
+package veracode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEndpointTemplate(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "guid", path: "/api/authn/v2/users/0b8a2f3e-1c4d-4e5f-8a9b-0c1d2e3f4a5b", want: "/api/authn/v2/users/{id}"},
+		{name: "nested guids", path: "/appsec/v1/applications/0b8a2f3e-1c4d-4e5f-8a9b-0c1d2e3f4a5b/sandboxes/1b8a2f3e-1c4d-4e5f-8a9b-0c1d2e3f4a5b", want: "/appsec/v1/applications/{id}/sandboxes/{id}"},
+		{name: "api key", path: "/api/authn/v2/api_credentials/vera01ei-3ddaeeb10ca690df3fee5e3bd1c329fa", want: "/api/authn/v2/api_credentials/{id}"},
+		{name: "numeric id", path: "/api/authn/v2/users/12345", want: "/api/authn/v2/users/{id}"},
+		{name: "no id", path: "/api/authn/v2/users/self", want: "/api/authn/v2/users/self"},
+		{name: "xml", path: "/api/5.0/getbuildinfo.do", want: "/api/5.0/getbuildinfo.do"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := endpointTemplate(tt.path); got != tt.want {
+				t.Errorf("endpointTemplate() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInMemoryMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	metrics := NewInMemoryMetrics(0.5, 1)
+
+	c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithMetrics(metrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"0b8a2f3e-1c4d-4e5f-8a9b-0c1d2e3f4a5b", "1b8a2f3e-1c4d-4e5f-8a9b-0c1d2e3f4a5b"} {
+		if _, _, err := c.Identity.GetUser(context.Background(), id, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	metrics.ObserveRequest(RequestMetric{Endpoint: "/api/authn/v2/roles", Method: http.MethodGet, StatusClass: "5xx", Latency: 2 * time.Second})
+
+	snapshot := metrics.Snapshot()
+	if len(snapshot) != 2 {
+		t.Fatalf("InMemoryMetrics.Snapshot() returned %d series, want 2", len(snapshot))
+	}
+	if snapshot[1].Endpoint != "/api/authn/v2/users/{id}" || snapshot[1].Count != 2 {
+		t.Errorf("InMemoryMetrics.Snapshot()[1] = %+v, want 2 requests for /api/authn/v2/users/{id}", snapshot[1])
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		`veracode_requests_total{endpoint="/api/authn/v2/users/{id}",method="GET",status_class="2xx"} 2`,
+		`veracode_request_duration_seconds_bucket{endpoint="/api/authn/v2/roles",method="GET",status_class="5xx",le="1"} 0`,
+		`veracode_request_duration_seconds_bucket{endpoint="/api/authn/v2/roles",method="GET",status_class="5xx",le="+Inf"} 1`,
+		`veracode_rate_limit_wait_seconds_count{endpoint="/api/authn/v2/users/{id}",method="GET",status_class="2xx"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Prometheus output does not contain %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestInMemoryMetrics_CoalescedOnly(t *testing.T) {
+	metrics := NewInMemoryMetrics(0.5, 1)
+
+	// The leader of the coalesced calls failed before it was sent, so the series only contains coalesced calls.
+	metrics.ObserveRequest(RequestMetric{Endpoint: "/api/authn/v2/roles", Method: http.MethodGet, StatusClass: "error", Coalesced: true})
+
+	var sb strings.Builder
+	if err := metrics.WritePrometheus(&sb); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`veracode_coalesced_requests_total{endpoint="/api/authn/v2/roles",method="GET",status_class="error"} 1`,
+		`veracode_request_duration_seconds_bucket{endpoint="/api/authn/v2/roles",method="GET",status_class="error",le="0.5"} 0`,
+		`veracode_request_duration_seconds_count{endpoint="/api/authn/v2/roles",method="GET",status_class="error"} 0`,
+	} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("Prometheus output does not contain %q:\n%s", want, sb.String())
+		}
+	}
+}
+
+func TestInMemoryMetrics_FailedBeforeSending(t *testing.T) {
+	var sent atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { sent.Store(true) }))
+	defer server.Close()
+
+	metrics := NewInMemoryMetrics()
+
+	// The API secret is not valid hex, so the request cannot be signed.
+	c, err := New(testApiKey, "not-hex", WithBaseURLs(server.URL, server.URL), WithMetrics(metrics), WithCoalescing())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := c.Identity.ListRoles(context.Background(), PageOptions{}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if sent.Load() {
+		t.Error("the request was sent")
+	}
+
+	var sb strings.Builder
+	if err := metrics.WritePrometheus(&sb); err != nil {
+		t.Fatal(err)
+	}
+
+	// Signing errors are not retried, so a single attempt is reported.
+	for _, want := range []string{
+		`veracode_requests_total{endpoint="/api/authn/v2/roles",method="GET",status_class="error"} 1`,
+		`veracode_coalesced_requests_total{endpoint="/api/authn/v2/roles",method="GET",status_class="error"} 0`,
+		`veracode_request_duration_seconds_bucket{endpoint="/api/authn/v2/roles",method="GET",status_class="error",le="+Inf"} 1`,
+		`veracode_request_duration_seconds_count{endpoint="/api/authn/v2/roles",method="GET",status_class="error"} 1`,
+		`veracode_rate_limit_wait_seconds_count{endpoint="/api/authn/v2/roles",method="GET",status_class="error"} 1`,
+	} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("Prometheus output does not contain %q:\n%s", want, sb.String())
+		}
+	}
+
+	if n := strings.Count(sb.String(), "veracode_requests_total{"); n != 1 {
+		t.Errorf("got %d series, expected only the series of the failed attempt:\n%s", n, sb.String())
+	}
+}
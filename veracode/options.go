@@ -0,0 +1,189 @@
+package veracode
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ClientOption configures a [Client] that is created with [New].
+type ClientOption func(*clientConfig) error
+
+// Middleware wraps an http.RoundTripper with additional behaviour. See [WithMiddleware].
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// clientConfig contains all of the settings that can be changed using a ClientOption.
+type clientConfig struct {
+	httpClient  *http.Client
+	ratePeriod  time.Duration
+	rateBurst   int
+	retryPolicy RetryPolicy
+	region      *Region
+	restURL     *url.URL
+	xmlURL      *url.URL
+	userAgent   string
+	middleware  []Middleware
+	hooks       []Hooks
+	logger      *slog.Logger
+	logOptions  LogOptions
+	metrics     MetricsCollector
+	tracer      Tracer
+	credentials CredentialsProvider
+
+	limiter       *AdaptiveLimiter
+	sharedLimiter bool
+	maxInFlight   int
+	hostLimits    map[string]HostLimits
+
+	circuitBreaker *CircuitBreakerOptions
+	cache          *CacheOptions
+	coalesce       bool
+	dryRun         *dryRunTransport
+}
+
+func defaultClientConfig() clientConfig {
+	return clientConfig{
+		ratePeriod:  time.Minute * 1,
+		rateBurst:   500,
+		retryPolicy: DefaultRetryPolicy,
+		logger:      slog.New(slog.DiscardHandler),
+		tracer:      noopTracer{},
+	}
+}
+
+// WithHTTPClient sets the http.Client that the Client uses to send requests.
+//
+// The provided http.Client is copied and is never modified. Its Transport (or the http.DefaultTransport if it is nil)
+// is used as the base of the Client's transport chain.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(cfg *clientConfig) error {
+		cfg.httpClient = httpClient
+		return nil
+	}
+}
+
+// WithRateLimit sets the client-side rate limit. The limiter allows bursts of up to burst requests and
+// refills one request every period.
+//
+// The default is a burst of 500 requests and a period of 1 minute.
+func WithRateLimit(period time.Duration, burst int) ClientOption {
+	return func(cfg *clientConfig) error {
+		if period <= 0 {
+			return fmt.Errorf("rate limit period must be positive, got: %s", period)
+		}
+		if burst < 1 {
+			return fmt.Errorf("rate limit burst must be at least 1, got: %d", burst)
+		}
+
+		cfg.ratePeriod, cfg.rateBurst = period, burst
+		return nil
+	}
+}
+
+// WithRetryPolicy sets the RetryPolicy. The default is [DefaultRetryPolicy].
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(cfg *clientConfig) error {
+		cfg.retryPolicy = policy
+		return nil
+	}
+}
+
+// WithRegion sets the region that the Client connects to, instead of deriving it from the API key.
+// The region is kept when the credentials are changed using [Client.UpdateCredentials].
+//
+// The region does not need to be registered using [RegisterRegion], but it must have a REST and an XML base URL.
+func WithRegion(region Region) ClientOption {
+	return func(cfg *clientConfig) error {
+		if err := region.validate(); err != nil {
+			return err
+		}
+
+		cfg.region = &region
+		return nil
+	}
+}
+
+// WithBaseURLs sets the base URLs of the REST and XML APIs, instead of using the URLs of the region.
+// It is equivalent to using both [WithRestBaseURL] and [WithXMLBaseURL].
+//
+// If both base URLs are set, the API key does not need to map to a known region.
+func WithBaseURLs(rest, xml string) ClientOption {
+	return func(cfg *clientConfig) error {
+		if err := WithRestBaseURL(rest)(cfg); err != nil {
+			return err
+		}
+
+		return WithXMLBaseURL(xml)(cfg)
+	}
+}
+
+// WithRestBaseURL sets the base URL of the REST APIs, instead of using the URL of the region.
+//
+// The base URL can use plain HTTP and can contain a path prefix, for example: "http://localhost:8080/veracode".
+// This allows the Client to target a local test server, a corporate gateway or a signing proxy.
+func WithRestBaseURL(rest string) ClientOption {
+	return func(cfg *clientConfig) (err error) {
+		cfg.restURL, err = parseBaseURL(rest)
+		if err != nil {
+			return fmt.Errorf("invalid REST base URL: %w", err)
+		}
+		return nil
+	}
+}
+
+// WithXMLBaseURL sets the base URL of the XML APIs, instead of using the URL of the region.
+//
+// See [WithRestBaseURL] for the supported URLs.
+func WithXMLBaseURL(xml string) ClientOption {
+	return func(cfg *clientConfig) (err error) {
+		cfg.xmlURL, err = parseBaseURL(xml)
+		if err != nil {
+			return fmt.Errorf("invalid XML base URL: %w", err)
+		}
+		return nil
+	}
+}
+
+// parseBaseURL parses and validates a base URL.
+func parseBaseURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%q must use the http or https scheme", rawURL)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("%q does not contain a host", rawURL)
+	}
+
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("%q must not contain a query or fragment", rawURL)
+	}
+
+	return u, nil
+}
+
+// WithUserAgent sets the User-Agent header on all requests created with [Client.NewRequest].
+func WithUserAgent(userAgent string) ClientOption {
+	return func(cfg *clientConfig) error {
+		cfg.userAgent = userAgent
+		return nil
+	}
+}
+
+// WithMiddleware adds middleware to the Client's transport chain.
+//
+// Middleware sit between the Client's own transport (which handles rate limiting, retries and authentication) and
+// the transport of the http.Client. This means that they see every individual, signed attempt. The first
+// middleware provided is the outermost one.
+func WithMiddleware(middleware ...Middleware) ClientOption {
+	return func(cfg *clientConfig) error {
+		cfg.middleware = append(cfg.middleware, middleware...)
+		return nil
+	}
+}
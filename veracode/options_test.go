@@ -0,0 +1,186 @@
+package veracode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// roundTripperFunc allows a function to be used as an http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestNewClient_DoesNotModifyHTTPClient(t *testing.T) {
+	httpClient := &http.Client{Timeout: time.Second}
+
+	c, err := NewClient(httpClient, testApiKey, testApiSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if httpClient.Transport != nil {
+		t.Errorf("NewClient() modified the Transport of the provided http.Client")
+	}
+	if c.HttpClient == httpClient {
+		t.Errorf("NewClient() used the provided http.Client instead of a copy")
+	}
+	if c.HttpClient.Timeout != time.Second {
+		t.Errorf("Client.HttpClient.Timeout = %s, want %s", c.HttpClient.Timeout, time.Second)
+	}
+}
+
+func TestNew_Options(t *testing.T) {
+	var order []string
+	var userAgent string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+	}))
+	defer server.Close()
+
+	middleware := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				if req.Header.Get("Authorization") == "" {
+					t.Errorf("middleware %s received an unsigned request", name)
+				}
+				order = append(order, name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+
+	c, err := New(testApiKey, testApiSecret,
+		WithBaseURLs(server.URL, server.URL),
+		WithUserAgent("veracode-go-test"),
+		WithRateLimit(time.Second, 10),
+		WithMiddleware(middleware("first"), middleware("second")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := c.NewRequest(context.Background(), "/healthcheck/status", http.MethodGet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Do(req, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"first", "second"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("middleware order = %v, want %v", order, want)
+	}
+	if userAgent != "veracode-go-test" {
+		t.Errorf("User-Agent = %q, want %q", userAgent, "veracode-go-test")
+	}
+}
+
+func TestNew_InvalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  ClientOption
+	}{
+		{name: "zero rate limit period", opt: WithRateLimit(0, 10)},
+		{name: "zero rate limit burst", opt: WithRateLimit(time.Second, 0)},
+		{name: "empty region", opt: WithRegion(Region{})},
+		{name: "invalid base url", opt: WithBaseURLs("http://[::1", "https://analysiscenter.veracode.com")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(testApiKey, testApiSecret, tt.opt); err == nil {
+				t.Errorf("New() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestClient_NewRequest_BaseURLOverride(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []ClientOption
+		endpoint string
+		useXML   bool
+		want     string
+	}{
+		{
+			name:     "region derived from key",
+			endpoint: "/api/authn/v2/users",
+			want:     "https://api.veracode.com/api/authn/v2/users",
+		},
+		{
+			name:     "region override",
+			opts:     []ClientOption{WithRegion(Regions()["e"])},
+			endpoint: "/api/5.0/getbuildinfo.do",
+			useXML:   true,
+			want:     "https://analysiscenter.veracode.eu/api/5.0/getbuildinfo.do",
+		},
+		{
+			name:     "plain http with path prefix",
+			opts:     []ClientOption{WithRestBaseURL("http://localhost:8080/veracode")},
+			endpoint: "/api/authn/v2/users?page=1",
+			want:     "http://localhost:8080/veracode/api/authn/v2/users?page=1",
+		},
+		{
+			name:     "path prefix with trailing slash",
+			opts:     []ClientOption{WithRestBaseURL("http://gateway.internal/proxy/rest/")},
+			endpoint: "appsec/v1/applications",
+			want:     "http://gateway.internal/proxy/rest/appsec/v1/applications",
+		},
+		{
+			name:     "xml override does not affect rest",
+			opts:     []ClientOption{WithXMLBaseURL("http://localhost:9090/xml")},
+			endpoint: "/api/authn/v2/users",
+			want:     "https://api.veracode.com/api/authn/v2/users",
+		},
+		{
+			name:     "xml override",
+			opts:     []ClientOption{WithXMLBaseURL("http://localhost:9090/xml")},
+			endpoint: "/api/5.0/getbuildlist.do",
+			useXML:   true,
+			want:     "http://localhost:9090/xml/api/5.0/getbuildlist.do",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(testApiKey, testApiSecret, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := c.NewRequest(context.Background(), tt.endpoint, http.MethodGet, nil, tt.useXML)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := req.URL.String(); got != tt.want {
+				t.Errorf("Client.NewRequest() URL = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_UpdateCredentials_KeepsOverrides(t *testing.T) {
+	c, err := New(testApiKey, testApiSecret, WithRestBaseURL("http://localhost:8080/veracode"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.UpdateCredentials("vera01ei-"+testApiKey, "vera01es-"+testApiSecret); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := c.baseRestURL.String(), "http://localhost:8080/veracode/"; got != want {
+		t.Errorf("REST base URL = %s, want %s", got, want)
+	}
+	if got, want := c.baseXmlURL.String(), "https://analysiscenter.veracode.eu/"; got != want {
+		t.Errorf("XML base URL = %s, want %s", got, want)
+	}
+}
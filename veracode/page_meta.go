@@ -1,5 +1,7 @@
 package veracode
 
+import "context"
+
 // PageMeta contains the meta data for the current API page.
 type PageMeta struct {
 	Number        int `json:"number"`
@@ -33,3 +35,35 @@ type PageOptions struct {
 	Page int              `url:"page"`           // Page through the list.
 	Sort []SortQueryField `url:"sort,omitempty"` // Sort by multiple field names. Field names have to be in camelCase. Sort is ascending by default.
 }
+
+// listAll calls list for every page, starting at the page that is currently set, until all pages have been fetched.
+// page must point to the page number in the options that list uses, so that it can be incremented.
+//
+// listAll creates a parent span with the provided name for all of the requests. The returned Response is the
+// Response of the last page.
+func listAll[T any](ctx context.Context, c *Client, name string, page *int, list func(context.Context) ([]T, *Response, error)) ([]T, *Response, error) {
+	ctx, span := c.tracer.StartSpan(ctx, name, Attr("veracode.service", serviceName(name)), Attr("veracode.endpoint", name))
+	defer span.End()
+
+	var all []T
+	var pages int
+
+	for {
+		items, resp, err := list(ctx)
+		if err != nil {
+			span.SetAttributes(Attr("veracode.pages", pages))
+			span.RecordError(err)
+			return nil, resp, err
+		}
+
+		pages++
+		all = append(all, items...)
+
+		if len(items) == 0 || resp.Page.Number+1 >= resp.Page.TotalPages {
+			span.SetAttributes(Attr("veracode.pages", pages), Attr("veracode.items", len(all)))
+			return all, resp, nil
+		}
+
+		*page = resp.Page.Number + 1
+	}
+}
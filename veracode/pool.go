@@ -0,0 +1,152 @@
+package veracode
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// ClientPool holds a Client for each profile of a Veracode credentials file. The Clients are created when they are
+// first used. Each Client has its own rate limiter and region, which is derived from the API key of its profile.
+//
+// A ClientPool is safe for concurrent use.
+type ClientPool struct {
+	profiles map[string]Profile
+	opts     []ClientOption
+
+	mu      sync.Mutex
+	clients map[string]*Client
+}
+
+// NewClientPool returns a ClientPool for profiles. The Clients are created using [New] with the credentials of their
+// profile and opts.
+//
+// Options that hold state, such as [WithRateLimiter] or [WithMetrics], are shared by all of the Clients.
+func NewClientPool(profiles map[string]Profile, opts ...ClientOption) *ClientPool {
+	return &ClientPool{
+		profiles: maps.Clone(profiles),
+		opts:     opts,
+		clients:  make(map[string]*Client),
+	}
+}
+
+// NewClientPoolFromFile returns a ClientPool for all of the profiles in the credentials file at filePath. If filePath
+// is empty, the path returned by [GetCredentialsFilePath] is used. See [NewClientPool].
+func NewClientPoolFromFile(filePath string, opts ...ClientOption) (*ClientPool, error) {
+	if filePath == "" {
+		var err error
+		if filePath, err = GetCredentialsFilePath(); err != nil {
+			return nil, err
+		}
+	}
+
+	profiles, err := GetProfiles(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClientPool(profiles, opts...), nil
+}
+
+// Profiles returns the names of the profiles of the pool in alphabetical order.
+func (p *ClientPool) Profiles() []string {
+	return slices.Sorted(maps.Keys(p.profiles))
+}
+
+// Client returns the Client of profile, creating it if it does not exist yet. It returns an error that wraps
+// ErrProfileNotFound if the pool does not contain the profile.
+func (p *ClientPool) Client(profile string) (*Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if c, ok := p.clients[profile]; ok {
+		return c, nil
+	}
+
+	credentials, ok := p.profiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrProfileNotFound, profile)
+	}
+
+	c, err := New(credentials.VeracodeApiKeyId, credentials.VeracodeApiKeySecret, p.opts...)
+	if err != nil {
+		return nil, fmt.Errorf("could not create client for profile %s: %w", profile, err)
+	}
+
+	p.clients[profile] = c
+	return c, nil
+}
+
+// PoolResult is the result of a function that was run for a profile by [RunAll].
+type PoolResult[T any] struct {
+	Profile string
+	Value   T
+	Err     error
+}
+
+// RunOptions configures [RunAll].
+type RunOptions struct {
+	// Parallelism is the maximum number of profiles that the function runs for at the same time. The default is the
+	// number of profiles.
+	Parallelism int
+
+	// Profiles are the profiles to run the function for. The default is all of the profiles of the pool.
+	Profiles []string
+}
+
+// RunAll runs fn with the Client of every profile of pool, with at most options.Parallelism calls running at the same
+// time. It returns the result of each profile, in the order of options.Profiles or in alphabetical order.
+//
+// RunAll waits for all of the calls to return. Profiles whose Client cannot be created, or that have not started
+// when ctx is done, get an error in their result and fn is not called for them.
+func RunAll[T any](ctx context.Context, pool *ClientPool, options RunOptions, fn func(ctx context.Context, profile string, c *Client) (T, error)) []PoolResult[T] {
+	profiles := options.Profiles
+	if profiles == nil {
+		profiles = pool.Profiles()
+	}
+
+	parallelism := options.Parallelism
+	if parallelism <= 0 {
+		parallelism = len(profiles)
+	}
+
+	results := make([]PoolResult[T], len(profiles))
+	sem := make(chan struct{}, max(parallelism, 1))
+
+	var wg sync.WaitGroup
+
+	for k, profile := range profiles {
+		results[k].Profile = profile
+
+		if err := ctx.Err(); err != nil {
+			results[k].Err = err
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[k].Err = ctx.Err()
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			c, err := pool.Client(profile)
+			if err != nil {
+				results[k].Err = err
+				return
+			}
+
+			results[k].Value, results[k].Err = fn(ctx, profile, c)
+		}()
+	}
+
+	wg.Wait()
+	return results
+}
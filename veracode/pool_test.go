@@ -0,0 +1,136 @@
+package veracode
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientPool(t *testing.T) {
+	keys := map[string]string{testApiKey: testApiSecret, strings.Repeat("b", 32): testApiSecret}
+	server := newVerifyingServer(t, keys)
+
+	pool := NewClientPool(map[string]Profile{
+		"commercial": {Name: "commercial", VeracodeApiKeyId: testApiKey, VeracodeApiKeySecret: testApiSecret},
+		"eu":         {Name: "eu", VeracodeApiKeyId: "vera01ei-" + strings.Repeat("b", 32), VeracodeApiKeySecret: "vera01ei-" + testApiSecret},
+		"invalid":    {Name: "invalid", VeracodeApiKeyId: "vera01xx-" + testApiKey, VeracodeApiKeySecret: testApiSecret},
+	}, WithRestBaseURL(server.URL), WithRetryPolicy(NoRetryPolicy))
+
+	if got := strings.Join(pool.Profiles(), ","); got != "commercial,eu,invalid" {
+		t.Errorf("got profiles %s", got)
+	}
+
+	t.Run("lazy clients", func(t *testing.T) {
+		eu, err := pool.Client("eu")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if eu.baseXmlURL.Host != "analysiscenter.veracode.eu" {
+			t.Errorf("got XML base URL %s, expected the European region", eu.baseXmlURL)
+		}
+
+		if again, _ := pool.Client("eu"); again != eu {
+			t.Error("expected the same client for the same profile")
+		}
+
+		if _, err := pool.Client("prod"); !errors.Is(err, ErrProfileNotFound) {
+			t.Errorf("expected ErrProfileNotFound, got: %v", err)
+		}
+	})
+
+	t.Run("run all", func(t *testing.T) {
+		results := RunAll(context.Background(), pool, RunOptions{}, func(ctx context.Context, profile string, c *Client) (string, error) {
+			return signedWith(ctx, c)
+		})
+
+		if len(results) != 3 {
+			t.Fatalf("got %d results, expected 3", len(results))
+		}
+
+		if results[0].Profile != "commercial" || results[0].Err != nil || results[0].Value != testApiKey {
+			t.Errorf("unexpected result: %+v", results[0])
+		}
+
+		if results[1].Profile != "eu" || results[1].Err != nil || results[1].Value != strings.Repeat("b", 32) {
+			t.Errorf("unexpected result: %+v", results[1])
+		}
+
+		if results[2].Profile != "invalid" || results[2].Err == nil || !strings.Contains(results[2].Err.Error(), "profile invalid") {
+			t.Errorf("expected an error for the invalid profile, got: %+v", results[2])
+		}
+	})
+
+	t.Run("subset", func(t *testing.T) {
+		results := RunAll(context.Background(), pool, RunOptions{Profiles: []string{"eu", "missing"}}, func(ctx context.Context, profile string, c *Client) (string, error) {
+			return profile, nil
+		})
+
+		if len(results) != 2 || results[0].Value != "eu" || !errors.Is(results[1].Err, ErrProfileNotFound) {
+			t.Errorf("unexpected results: %+v", results)
+		}
+	})
+}
+
+func TestRunAll_Parallelism(t *testing.T) {
+	profiles := make(map[string]Profile)
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		profiles[name] = Profile{Name: name, VeracodeApiKeyId: testApiKey, VeracodeApiKeySecret: testApiSecret}
+	}
+
+	pool := NewClientPool(profiles)
+
+	var running, maxRunning atomic.Int32
+
+	results := RunAll(context.Background(), pool, RunOptions{Parallelism: 2}, func(ctx context.Context, profile string, c *Client) (int, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		return len(profile), nil
+	})
+
+	if maxRunning.Load() != 2 {
+		t.Errorf("got %d concurrent calls, expected 2", maxRunning.Load())
+	}
+
+	for _, result := range results {
+		if result.Err != nil || result.Value != 1 {
+			t.Errorf("unexpected result: %+v", result)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, result := range RunAll(ctx, pool, RunOptions{}, func(ctx context.Context, profile string, c *Client) (int, error) {
+		t.Error("fn was called after the context was cancelled")
+		return 0, nil
+	}) {
+		if !errors.Is(result.Err, context.Canceled) {
+			t.Errorf("expected context.Canceled for %s, got: %v", result.Profile, result.Err)
+		}
+	}
+}
+
+func TestNewClientPoolFromFile(t *testing.T) {
+	pool, err := NewClientPoolFromFile(writeTestCredentialsFile(t, testCredentialsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Profiles without an API key ID and secret are skipped.
+	if got := strings.Join(pool.Profiles(), ","); got != "ci,default" {
+		t.Errorf("got profiles %s, expected ci,default", got)
+	}
+}
@@ -0,0 +1,127 @@
+package veracode
+
+import (
+	"context"
+	"sync"
+)
+
+// Priority is the priority of a call in the client-side rate limiter. See [WithPriority].
+type Priority int
+
+const (
+	PriorityLow    Priority = -1 // For batch work, such as nightly synchronisation jobs.
+	PriorityNormal Priority = 0  // The default priority.
+	PriorityHigh   Priority = 1  // For interactive work, such as CLI commands.
+)
+
+// maxSkips is the number of times that a priority lane with waiters can be passed over in favour of a higher
+// priority lane, before it is served. This makes sure that low priority work still makes progress.
+const maxSkips = 4
+
+type priorityKey struct{}
+
+// WithPriority returns a copy of ctx that carries the priority p. Calls made with the returned context are served
+// by the client-side rate limiter and the limit of requests in flight (see [WithMaxInFlight]) according to p.
+//
+// When multiple calls are waiting for the rate limiter or a free slot, calls with a higher priority are served first. Calls with
+// a lower priority are not starved: after a lower priority call has been passed over a few times, it is served
+// before the next higher priority call.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFromContext returns the priority set by WithPriority or PriorityNormal if no priority was set.
+func PriorityFromContext(ctx context.Context) Priority {
+	p, ok := ctx.Value(priorityKey{}).(Priority)
+	if !ok || p < PriorityLow || p > PriorityHigh {
+		return PriorityNormal
+	}
+	return p
+}
+
+// priorityGate lets a limited number of callers at a time hold a turn, for example to wait for a rate limiter or to
+// send a request. Waiting callers get their turn in the order of their priority.
+type priorityGate struct {
+	mu      sync.Mutex
+	size    int                                             // Number of turns that can be held at the same time. Zero means one.
+	held    int                                             // Number of turns that are currently held.
+	lanes   [PriorityHigh - PriorityLow + 1][]chan struct{} // Waiters per priority, lowest priority first.
+	skipped [PriorityHigh - PriorityLow + 1]int             // Number of times each lane was passed over.
+}
+
+// enter blocks until it is the caller's turn or ctx is done. If enter returns nil, leave must be called once the
+// caller is done waiting for the rate limiter.
+func (g *priorityGate) enter(ctx context.Context, p Priority) error {
+	g.mu.Lock()
+	if g.held < max(g.size, 1) {
+		g.held++
+		g.mu.Unlock()
+		return nil
+	}
+
+	lane := int(p - PriorityLow)
+	turn := make(chan struct{})
+	g.lanes[lane] = append(g.lanes[lane], turn)
+	g.mu.Unlock()
+
+	select {
+	case <-turn:
+		return nil
+	case <-ctx.Done():
+		g.mu.Lock()
+		defer g.mu.Unlock()
+
+		for i, c := range g.lanes[lane] {
+			if c == turn {
+				g.lanes[lane] = append(g.lanes[lane][:i], g.lanes[lane][i+1:]...)
+				return ctx.Err()
+			}
+		}
+
+		// The turn was handed to the caller at the same time that ctx was done, so it has to be passed on.
+		g.next()
+		return ctx.Err()
+	}
+}
+
+// leave passes the turn of the caller to the next waiter.
+func (g *priorityGate) leave() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.next()
+}
+
+// next hands a turn that is given up to the waiter of the highest priority lane, unless a lower priority lane has been passed
+// over too often. The caller must hold g.mu.
+func (g *priorityGate) next() {
+	lane := -1
+	for i := len(g.lanes) - 1; i >= 0; i-- {
+		if len(g.lanes[i]) == 0 {
+			continue
+		}
+
+		if lane == -1 {
+			lane = i
+		} else if g.skipped[i] >= maxSkips {
+			lane = i
+			break
+		}
+	}
+
+	if lane == -1 {
+		g.held--
+		return
+	}
+
+	for i := range lane {
+		if len(g.lanes[i]) > 0 {
+			g.skipped[i]++
+		}
+	}
+	g.skipped[lane] = 0
+
+	turn := g.lanes[lane][0]
+	g.lanes[lane] = g.lanes[lane][1:]
+	close(turn)
+}
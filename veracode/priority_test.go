@@ -0,0 +1,169 @@
+package veracode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// queueWaiters makes every priority in ps wait for g in order and returns the channel on which the priorities are
+// reported once the waiters get their turn.
+func queueWaiters(t *testing.T, g *priorityGate, ps ...Priority) <-chan Priority {
+	t.Helper()
+
+	served := make(chan Priority, len(ps))
+	for i, p := range ps {
+		go func() {
+			if err := g.enter(context.Background(), p); err != nil {
+				t.Error(err)
+				return
+			}
+			served <- p
+		}()
+
+		// Wait until the waiter is queued, so that the order of the waiters within a lane is deterministic.
+		for {
+			g.mu.Lock()
+			var n int
+			for _, lane := range g.lanes {
+				n += len(lane)
+			}
+			g.mu.Unlock()
+
+			if n == i+1 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	return served
+}
+
+func TestPriorityGate(t *testing.T) {
+	tests := []struct {
+		name    string
+		waiters []Priority
+		want    []Priority
+	}{
+		{
+			name:    "higher priorities first",
+			waiters: []Priority{PriorityLow, PriorityNormal, PriorityHigh, PriorityNormal},
+			want:    []Priority{PriorityHigh, PriorityNormal, PriorityNormal, PriorityLow},
+		},
+		{
+			name:    "low priority is not starved",
+			waiters: []Priority{PriorityLow, PriorityHigh, PriorityHigh, PriorityHigh, PriorityHigh, PriorityHigh, PriorityHigh},
+			want:    []Priority{PriorityHigh, PriorityHigh, PriorityHigh, PriorityHigh, PriorityLow, PriorityHigh, PriorityHigh},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &priorityGate{}
+
+			// Take the turn, so that all waiters are queued.
+			if err := g.enter(context.Background(), PriorityNormal); err != nil {
+				t.Fatal(err)
+			}
+
+			served := queueWaiters(t, g, tt.waiters...)
+
+			var got []Priority
+			for range tt.waiters {
+				g.leave()
+				got = append(got, <-served)
+			}
+			g.leave()
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("waiters were served in order %v, want %v", got, tt.want)
+			}
+			if g.held != 0 {
+				t.Errorf("priorityGate holds %d turns after all waiters left", g.held)
+			}
+		})
+	}
+}
+
+func TestPriorityGate_Cancel(t *testing.T) {
+	g := &priorityGate{}
+	if err := g.enter(context.Background(), PriorityNormal); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := g.enter(ctx, PriorityHigh); err != context.Canceled {
+		t.Errorf("priorityGate.enter() = %v, want %v", err, context.Canceled)
+	}
+
+	served := queueWaiters(t, g, PriorityLow)
+	g.leave()
+	if p := <-served; p != PriorityLow {
+		t.Errorf("waiter with priority %d was served, want %d", p, PriorityLow)
+	}
+}
+
+func TestPriorityFromContext(t *testing.T) {
+	if p := PriorityFromContext(context.Background()); p != PriorityNormal {
+		t.Errorf("PriorityFromContext() = %d, want %d", p, PriorityNormal)
+	}
+	if p := PriorityFromContext(WithPriority(context.Background(), PriorityHigh)); p != PriorityHigh {
+		t.Errorf("PriorityFromContext() = %d, want %d", p, PriorityHigh)
+	}
+}
+
+// TestClient_PriorityInFlight checks that high priority calls do not queue behind a burst of low priority calls for
+// a slot of the in-flight limit.
+func TestClient_PriorityInFlight(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithRateLimit(time.Microsecond, 1000), WithMaxInFlight(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const lowCalls = 40
+	var done atomic.Int32
+	var wg sync.WaitGroup
+
+	for range lowCalls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := c.Identity.ListRoles(WithPriority(context.Background(), PriorityLow), PageOptions{}); err != nil {
+				t.Error(err)
+			}
+			done.Add(1)
+		}()
+	}
+
+	// Wait until the low priority calls are queued.
+	for c.RateLimitStatus()[c.baseRestURL.Host].InFlight < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if _, _, err := c.Identity.ListRoles(WithPriority(context.Background(), PriorityHigh), PageOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	finishedFirst := done.Load()
+
+	wg.Wait()
+
+	// The high priority call takes the next free slot, so only the calls that were in flight finish before it.
+	if finishedFirst > 6 {
+		t.Errorf("%d of %d low priority calls finished before the high priority call", finishedFirst, lowCalls)
+	}
+}
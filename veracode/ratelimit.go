@@ -0,0 +1,493 @@
+package veracode
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+	"weak"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// minLimitDivisor bounds how far an AdaptiveLimiter lowers its rate: never below 1/minLimitDivisor of the configured rate.
+	minLimitDivisor = 32
+
+	// recoveryInterval is the minimum time between two increases of the rate of a throttled AdaptiveLimiter.
+	recoveryInterval = 10 * time.Second
+
+	// recoveryFactor is the factor by which the rate of a throttled AdaptiveLimiter increases per recoveryInterval.
+	recoveryFactor = 1.25
+)
+
+// AdaptiveLimiter is a client-side rate limiter that adapts to the rate that the Veracode API allows.
+//
+// It starts at the configured rate and burst. When the API responds with 429 Too Many Requests, the rate and the
+// burst are halved and the limiter pauses for the duration of the Retry-After header. When the API reports its
+// remaining quota using rate limit headers (X-RateLimit-Remaining and X-RateLimit-Reset), the rate and burst are
+// lowered so that the remaining quota is spread over the rest of the window, and the limiter pauses until the window
+// resets once the quota is used up. After being throttled, the rate and burst slowly recover to the configured values.
+//
+// A Client uses a separate AdaptiveLimiter for every host, so that the REST APIs and the XML APIs have independent
+// budgets. An AdaptiveLimiter is safe for concurrent use and can be shared by multiple Clients. See [WithRateLimiter]
+// and [SharedRateLimiter].
+type AdaptiveLimiter struct {
+	mu             sync.Mutex
+	gate           priorityGate
+	limiter        *rate.Limiter
+	maxLimit       rate.Limit
+	maxBurst       int
+	pausedUntil    time.Time
+	lastChange     time.Time
+	throttleEvents int
+}
+
+// RateLimitStatus is a snapshot of the state of the budget of a host. See [Client.RateLimitStatus].
+type RateLimitStatus struct {
+	Limit          float64   // Current rate in requests per second.
+	MaxLimit       float64   // Configured rate in requests per second.
+	Burst          int       // Current maximum burst size.
+	MaxBurst       int       // Configured maximum burst size.
+	Tokens         float64   // Number of requests that can currently be sent without waiting.
+	Throttled      bool      // Whether the current rate or burst is lower than the configured values.
+	PausedUntil    time.Time // Time until which no requests are sent. Zero if the limiter is not paused.
+	ThrottleEvents int       // Number of times that the rate was lowered.
+	InFlight       int       // Number of requests to the host that are currently in flight. Only set by [Client.RateLimitStatus].
+	MaxInFlight    int       // Maximum number of concurrent requests to the host. Zero means no limit. Only set by [Client.RateLimitStatus].
+}
+
+// NewAdaptiveLimiter returns a new AdaptiveLimiter that allows bursts of up to burst requests and refills one request
+// every period.
+func NewAdaptiveLimiter(period time.Duration, burst int) *AdaptiveLimiter {
+	limit := rate.Every(period)
+	return &AdaptiveLimiter{
+		limiter:  rate.NewLimiter(limit, burst),
+		maxLimit: limit,
+		maxBurst: burst,
+	}
+}
+
+type sharedLimiterKey struct {
+	apiKey string
+	host   string
+}
+
+// sharedLimiters holds weak pointers, so that the limiters of API keys that are no longer used, for example after a
+// rotation, are removed once no Client uses them anymore.
+var sharedLimiters = struct {
+	sync.Mutex
+	m map[sharedLimiterKey]weak.Pointer[AdaptiveLimiter]
+}{m: make(map[sharedLimiterKey]weak.Pointer[AdaptiveLimiter])}
+
+// SharedRateLimiter returns the AdaptiveLimiter for apiKey and host that is shared by all Clients in the process.
+// The limiter is created with period and burst on the first call for apiKey and host, later calls return the
+// existing limiter as long as it is still in use.
+func SharedRateLimiter(apiKey, host string, period time.Duration, burst int) *AdaptiveLimiter {
+	sharedLimiters.Lock()
+	defer sharedLimiters.Unlock()
+
+	key := sharedLimiterKey{apiKey: apiKey, host: host}
+	if l := sharedLimiters.m[key].Value(); l != nil {
+		return l
+	}
+
+	l := NewAdaptiveLimiter(period, burst)
+	sharedLimiters.m[key] = weak.Make(l)
+	runtime.AddCleanup(l, removeSharedLimiter, key)
+	return l
+}
+
+// removeSharedLimiter removes the entry of key once its limiter has been garbage collected, unless a new limiter has
+// been created for key in the meantime.
+func removeSharedLimiter(key sharedLimiterKey) {
+	sharedLimiters.Lock()
+	defer sharedLimiters.Unlock()
+
+	if sharedLimiters.m[key].Value() == nil {
+		delete(sharedLimiters.m, key)
+	}
+}
+
+// Wait blocks until a request can be sent or ctx is done.
+//
+// If the next request could only be sent after the deadline of ctx, Wait returns immediately with an error that wraps
+// [context.DeadlineExceeded].
+//
+// Waiting calls are served in the order of their priority (see [WithPriority]), without starving calls with a
+// lower priority.
+func (l *AdaptiveLimiter) Wait(ctx context.Context) error {
+	if err := l.gate.enter(ctx, PriorityFromContext(ctx)); err != nil {
+		return err
+	}
+	defer l.gate.leave()
+
+	l.mu.Lock()
+	pause := time.Until(l.pausedUntil)
+	l.mu.Unlock()
+
+	if err := sleepContext(ctx, pause); err != nil {
+		return err
+	}
+
+	if err := l.limiter.Wait(ctx); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		// The limiter fails without waiting when the next request could only be sent after the deadline of ctx.
+		if _, ok := ctx.Deadline(); ok {
+			return fmt.Errorf("%w: %v", context.DeadlineExceeded, err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Observe adapts the rate of the limiter to a response of the Veracode API.
+func (l *AdaptiveLimiter) Observe(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retryAfter, _ := parseRetryAfter(resp.Header.Get("Retry-After"), now)
+		l.pause(now, retryAfter)
+		l.throttle(now, l.limiter.Limit()/2, l.limiter.Burst()/2)
+		return
+	}
+
+	if remaining, reset, ok := parseRateLimitHeaders(resp.Header, now); ok {
+		if remaining == 0 {
+			l.pause(now, reset)
+			l.throttleEvents++
+			return
+		}
+
+		if reset > 0 {
+			if quota := rate.Limit(float64(remaining) / reset.Seconds()); quota < l.limiter.Limit() || remaining < l.limiter.Burst() {
+				l.throttle(now, min(quota, l.limiter.Limit()), min(remaining, l.limiter.Burst()))
+				return
+			}
+		}
+	}
+
+	l.recover(now)
+}
+
+// Status returns a snapshot of the state of the limiter.
+func (l *AdaptiveLimiter) Status() RateLimitStatus {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s := RateLimitStatus{
+		Limit:          float64(l.limiter.Limit()),
+		MaxLimit:       float64(l.maxLimit),
+		Burst:          l.limiter.Burst(),
+		MaxBurst:       l.maxBurst,
+		Tokens:         l.limiter.TokensAt(now),
+		Throttled:      l.isThrottled(),
+		ThrottleEvents: l.throttleEvents,
+	}
+
+	if l.pausedUntil.After(now) {
+		s.PausedUntil = l.pausedUntil
+	}
+
+	return s
+}
+
+// isThrottled reports whether the rate or burst is lower than the configured values. The caller must hold l.mu.
+func (l *AdaptiveLimiter) isThrottled() bool {
+	return l.limiter.Limit() < l.maxLimit || l.limiter.Burst() < l.maxBurst
+}
+
+// pause stops requests for d. The caller must hold l.mu.
+func (l *AdaptiveLimiter) pause(now time.Time, d time.Duration) {
+	if until := now.Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+
+	l.lastChange = now
+}
+
+// throttle lowers the rate and burst, but not below the minimum values. Lowering the burst also drops any
+// tokens above the new burst. The caller must hold l.mu.
+func (l *AdaptiveLimiter) throttle(now time.Time, limit rate.Limit, burst int) {
+	l.limiter.SetLimitAt(now, max(limit, l.maxLimit/minLimitDivisor))
+	l.limiter.SetBurstAt(now, max(burst, 1))
+	l.throttleEvents++
+	l.lastChange = now
+}
+
+// recover increases the rate and burst of a throttled limiter, at most once per recoveryInterval.
+// The caller must hold l.mu.
+func (l *AdaptiveLimiter) recover(now time.Time) {
+	if !l.isThrottled() || now.Sub(l.lastChange) < recoveryInterval {
+		return
+	}
+
+	l.limiter.SetLimitAt(now, min(l.limiter.Limit()*recoveryFactor, l.maxLimit))
+	l.limiter.SetBurstAt(now, min(int(float64(l.limiter.Burst())*recoveryFactor)+1, l.maxBurst))
+	l.lastChange = now
+}
+
+// parseRateLimitHeaders returns the remaining number of requests and the time until the quota resets, if the
+// response contains rate limit headers.
+func parseRateLimitHeaders(h http.Header, now time.Time) (int, time.Duration, bool) {
+	remainingValue := firstHeader(h, "X-RateLimit-Remaining", "RateLimit-Remaining")
+	if remainingValue == "" {
+		return 0, 0, false
+	}
+
+	remaining, err := strconv.Atoi(remainingValue)
+	if err != nil || remaining < 0 {
+		return 0, 0, false
+	}
+
+	var reset time.Duration
+	if v, err := strconv.ParseInt(firstHeader(h, "X-RateLimit-Reset", "RateLimit-Reset"), 10, 64); err == nil && v > 0 {
+		// Some APIs send the reset time as a Unix timestamp instead of a number of seconds.
+		if v > 1_000_000_000 {
+			reset = time.Unix(v, 0).Sub(now)
+		} else {
+			reset = time.Duration(v) * time.Second
+		}
+	}
+
+	if reset < 0 {
+		reset = 0
+	}
+
+	return remaining, reset, true
+}
+
+// firstHeader returns the value of the first of the headers that is set.
+func firstHeader(h http.Header, names ...string) string {
+	for _, name := range names {
+		if v := h.Get(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// HostLimits is the request budget for a single host. See [WithHostLimits].
+type HostLimits struct {
+	Period      time.Duration // The rate limiter refills one request every Period.
+	Burst       int           // The rate limiter allows bursts of up to Burst requests.
+	MaxInFlight int           // Maximum number of concurrent requests. Zero means no limit.
+}
+
+// hostBudget limits the requests that are sent to a single host.
+type hostBudget struct {
+	limiter  *AdaptiveLimiter
+	inFlight *priorityGate // Limits the requests in flight. Nil if the number of requests is not limited.
+}
+
+// acquire blocks until a request can be sent to the host or ctx is done. Waiting requests get a slot in the order of
+// their priority (see [WithPriority]), so that a burst of low priority requests cannot hold up high priority requests.
+// If acquire returns nil, release must be called once the request is done.
+func (b *hostBudget) acquire(ctx context.Context) error {
+	if b.inFlight == nil {
+		return nil
+	}
+
+	return b.inFlight.enter(ctx, PriorityFromContext(ctx))
+}
+
+func (b *hostBudget) release() {
+	if b.inFlight != nil {
+		b.inFlight.leave()
+	}
+}
+
+// inFlightStatus returns the number of requests in flight and the maximum number of requests.
+func (b *hostBudget) inFlightStatus() (int, int) {
+	if b.inFlight == nil {
+		return 0, 0
+	}
+
+	b.inFlight.mu.Lock()
+	defer b.inFlight.mu.Unlock()
+
+	return b.inFlight.held, b.inFlight.size
+}
+
+// hostBudgets creates and holds the hostBudget of every host that the Client sends requests to.
+type hostBudgets struct {
+	mu      sync.Mutex
+	budgets map[budgetKey]*hostBudget
+	cfg     clientConfig
+}
+
+// budgetKey identifies a hostBudget. The API key ID is only set if the limiters are shared, because the shared
+// limiters are kept per API key.
+type budgetKey struct {
+	apiKeyID string
+	host     string
+}
+
+func newHostBudgets(cfg clientConfig) *hostBudgets {
+	return &hostBudgets{
+		budgets: make(map[budgetKey]*hostBudget),
+		cfg:     cfg,
+	}
+}
+
+// get returns the hostBudget of host for requests signed with apiKeyID, creating it on first use.
+func (h *hostBudgets) get(apiKeyID, host string) *hostBudget {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := budgetKey{host: host}
+	if h.cfg.limiter == nil && h.cfg.sharedLimiter {
+		key.apiKeyID = apiKeyID
+	}
+
+	if b, ok := h.budgets[key]; ok {
+		return b
+	}
+
+	// The budgets of API keys that the Client no longer uses, for example after a rotation, are removed, so that their
+	// shared limiters can be released. Budgets with requests in flight are kept until a later call.
+	if key.apiKeyID != "" {
+		for k, b := range h.budgets {
+			if k.host == host && k.apiKeyID != key.apiKeyID {
+				if inFlight, _ := b.inFlightStatus(); inFlight == 0 {
+					delete(h.budgets, k)
+				}
+			}
+		}
+	}
+
+	limits, ok := h.cfg.hostLimits[host]
+	if !ok {
+		limits = HostLimits{Period: h.cfg.ratePeriod, Burst: h.cfg.rateBurst, MaxInFlight: h.cfg.maxInFlight}
+	}
+
+	b := &hostBudget{}
+
+	switch {
+	case h.cfg.limiter != nil:
+		b.limiter = h.cfg.limiter
+	case h.cfg.sharedLimiter:
+		b.limiter = SharedRateLimiter(apiKeyID, host, limits.Period, limits.Burst)
+	default:
+		b.limiter = NewAdaptiveLimiter(limits.Period, limits.Burst)
+	}
+
+	if limits.MaxInFlight > 0 {
+		b.inFlight = &priorityGate{size: limits.MaxInFlight}
+	}
+
+	h.budgets[key] = b
+	return b
+}
+
+// status returns the RateLimitStatus of every host that requests signed with apiKeyID have been sent to.
+func (h *hostBudgets) status(apiKeyID string) map[string]RateLimitStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r := make(map[string]RateLimitStatus, len(h.budgets))
+	for key, b := range h.budgets {
+		if key.apiKeyID != "" && key.apiKeyID != apiKeyID {
+			continue
+		}
+
+		s := b.limiter.Status()
+		s.InFlight, s.MaxInFlight = b.inFlightStatus()
+		r[key.host] = s
+	}
+	return r
+}
+
+// releaseOnClose is a response body that releases the hostBudget of its request once it is closed.
+type releaseOnClose struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
+
+// WithMaxInFlight sets the maximum number of concurrent requests per host. Zero means no limit, which is the default.
+//
+// Requests to the REST APIs and the XML APIs have separate limits, so that for example polling the XML APIs
+// cannot starve calls to the REST APIs.
+func WithMaxInFlight(n int) ClientOption {
+	return func(cfg *clientConfig) error {
+		if n < 0 {
+			return fmt.Errorf("max in flight must not be negative, got: %d", n)
+		}
+
+		cfg.maxInFlight = n
+		return nil
+	}
+}
+
+// WithHostLimits sets the request budget of a single host (for example: "analysiscenter.veracode.com"), instead of
+// the budget set by [WithRateLimit] and [WithMaxInFlight].
+func WithHostLimits(host string, limits HostLimits) ClientOption {
+	return func(cfg *clientConfig) error {
+		if limits.Period <= 0 {
+			return fmt.Errorf("rate limit period must be positive, got: %s", limits.Period)
+		}
+		if limits.Burst < 1 {
+			return fmt.Errorf("rate limit burst must be at least 1, got: %d", limits.Burst)
+		}
+		if limits.MaxInFlight < 0 {
+			return fmt.Errorf("max in flight must not be negative, got: %d", limits.MaxInFlight)
+		}
+
+		if cfg.hostLimits == nil {
+			cfg.hostLimits = make(map[string]HostLimits)
+		}
+
+		cfg.hostLimits[host] = limits
+		return nil
+	}
+}
+
+// WithRateLimiter sets the AdaptiveLimiter that the Client uses for all hosts. This allows a limiter to be shared by
+// multiple Clients. It takes precedence over [WithRateLimit] and the rates set by [WithHostLimits].
+func WithRateLimiter(limiter *AdaptiveLimiter) ClientOption {
+	return func(cfg *clientConfig) error {
+		cfg.limiter = limiter
+		return nil
+	}
+}
+
+// WithSharedRateLimiter makes the Client use the AdaptiveLimiters that are shared by all Clients in the process that
+// use the same API key. See [SharedRateLimiter].
+//
+// The limiter is chosen by the API key ID that a request is signed with, so Clients that get their credentials from
+// a CredentialsProvider or that use [WithCredentials] share the limiters of those credentials.
+func WithSharedRateLimiter() ClientOption {
+	return func(cfg *clientConfig) error {
+		cfg.sharedLimiter = true
+		return nil
+	}
+}
+
+// RateLimitStatus returns a snapshot of the request budget of every host that the Client has sent requests to,
+// keyed by host.
+func (c *Client) RateLimitStatus() map[string]RateLimitStatus {
+	return c.transport.budgets.status(c.transport.apiKeyID(context.Background()))
+}
@@ -0,0 +1,246 @@
+package veracode
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveLimiter_Observe(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		header        http.Header
+		wantLimit     float64
+		wantBurst     int
+		wantPaused    bool
+		wantThrottled bool
+	}{
+		{
+			name:          "too many requests halves the rate and burst",
+			status:        http.StatusTooManyRequests,
+			header:        http.Header{"Retry-After": {"30"}},
+			wantLimit:     5,
+			wantBurst:     5,
+			wantPaused:    true,
+			wantThrottled: true,
+		},
+		{
+			name:          "low remaining quota lowers the rate",
+			status:        http.StatusOK,
+			header:        http.Header{"X-Ratelimit-Remaining": {"4"}, "X-Ratelimit-Reset": {"2"}},
+			wantLimit:     2,
+			wantBurst:     4,
+			wantThrottled: true,
+		},
+		{
+			name:          "exhausted quota pauses until reset",
+			status:        http.StatusOK,
+			header:        http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"60"}},
+			wantLimit:     10,
+			wantBurst:     10,
+			wantPaused:    true,
+			wantThrottled: false,
+		},
+		{
+			name:      "enough quota keeps the rate",
+			status:    http.StatusOK,
+			header:    http.Header{"X-Ratelimit-Remaining": {"1000"}, "X-Ratelimit-Reset": {"60"}},
+			wantLimit: 10,
+			wantBurst: 10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewAdaptiveLimiter(100*time.Millisecond, 10)
+			l.Observe(&http.Response{StatusCode: tt.status, Header: tt.header})
+
+			s := l.Status()
+			if s.Limit != tt.wantLimit || s.Burst != tt.wantBurst {
+				t.Errorf("AdaptiveLimiter.Status() = %v/s with burst %d, want %v/s with burst %d", s.Limit, s.Burst, tt.wantLimit, tt.wantBurst)
+			}
+			if paused := !s.PausedUntil.IsZero(); paused != tt.wantPaused {
+				t.Errorf("AdaptiveLimiter paused = %v, want %v", paused, tt.wantPaused)
+			}
+			if s.Throttled != tt.wantThrottled {
+				t.Errorf("AdaptiveLimiter.Status().Throttled = %v, want %v", s.Throttled, tt.wantThrottled)
+			}
+		})
+	}
+}
+
+func TestAdaptiveLimiter_MinimumRate(t *testing.T) {
+	l := NewAdaptiveLimiter(100*time.Millisecond, 10)
+	for range 10 {
+		l.Observe(&http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}})
+	}
+
+	s := l.Status()
+	if want := s.MaxLimit / minLimitDivisor; s.Limit != want {
+		t.Errorf("AdaptiveLimiter.Status().Limit = %v, want %v", s.Limit, want)
+	}
+	if s.Burst != 1 {
+		t.Errorf("AdaptiveLimiter.Status().Burst = %d, want 1", s.Burst)
+	}
+	if s.ThrottleEvents != 10 {
+		t.Errorf("AdaptiveLimiter.Status().ThrottleEvents = %d, want 10", s.ThrottleEvents)
+	}
+}
+
+func TestAdaptiveLimiter_WaitDeadline(t *testing.T) {
+	l := NewAdaptiveLimiter(time.Hour, 1)
+
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatalf("AdaptiveLimiter.Wait() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	start := time.Now()
+	err := l.Wait(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("AdaptiveLimiter.Wait() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("AdaptiveLimiter.Wait() returned after %s, want immediately", elapsed)
+	}
+}
+
+func TestSharedRateLimiter(t *testing.T) {
+	a := SharedRateLimiter("shared-test-key", "api.veracode.com", time.Second, 5)
+	b := SharedRateLimiter("shared-test-key", "api.veracode.com", time.Minute, 1)
+	if a != b {
+		t.Errorf("SharedRateLimiter() returned different limiters for the same API key and host")
+	}
+
+	if SharedRateLimiter("other-test-key", "api.veracode.com", time.Second, 5) == a {
+		t.Errorf("SharedRateLimiter() returned the same limiter for different API keys")
+	}
+	if SharedRateLimiter("shared-test-key", "analysiscenter.veracode.com", time.Second, 5) == a {
+		t.Errorf("SharedRateLimiter() returned the same limiter for different hosts")
+	}
+
+	c1, err := New(testApiKey, testApiSecret, WithSharedRateLimiter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := New(testApiKey, testApiSecret, WithSharedRateLimiter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c1.transport.budgets.get(testApiKey, "api.veracode.com").limiter != c2.transport.budgets.get(testApiKey, "api.veracode.com").limiter {
+		t.Errorf("Clients created with WithSharedRateLimiter() do not share a limiter")
+	}
+
+	// Clients that get their credentials from a provider share the limiters of the API key that they sign with.
+	provided, err := New("", "", WithCredentialsProvider(StaticCredentialsProvider{APIKeyID: testApiKey, APIKeySecret: testApiSecret}), WithSharedRateLimiter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, err := provided.transport.withCredentials(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provided.transport.budgets.get(provided.transport.apiKeyID(ctx), "api.veracode.com").limiter != c1.transport.budgets.get(testApiKey, "api.veracode.com").limiter {
+		t.Errorf("a Client with a CredentialsProvider does not share the limiter of its API key")
+	}
+}
+
+func TestSharedRateLimiter_Released(t *testing.T) {
+	key := sharedLimiterKey{apiKey: "rotated-test-key", host: "api.veracode.com"}
+
+	// The budgets of a Client that switched to another API key no longer use the limiter of the old key.
+	budgets := newHostBudgets(clientConfig{sharedLimiter: true, ratePeriod: time.Second, rateBurst: 5})
+	budgets.get(key.apiKey, key.host)
+	budgets.get("new-test-key", key.host)
+
+	if len(budgets.budgets) != 1 {
+		t.Fatalf("hostBudgets holds %d budgets after switching API keys, want 1", len(budgets.budgets))
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		runtime.GC()
+
+		sharedLimiters.Lock()
+		_, ok := sharedLimiters.m[key]
+		sharedLimiters.Unlock()
+
+		if !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the shared limiter of an API key that is no longer used was not removed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestClient_HostBudgets(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+
+	xml := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	defer xml.Close()
+
+	rest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer rest.Close()
+
+	xmlHost := strings.TrimPrefix(xml.URL, "http://")
+
+	c, err := New(testApiKey, testApiSecret,
+		WithBaseURLs(rest.URL, xml.URL),
+		WithHostLimits(xmlHost, HostLimits{Period: time.Millisecond, Burst: 10, MaxInFlight: 1}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Start two XML calls. Only one of them can be in flight at a time.
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.UploadXML.GetBuildList(context.Background(), BuildListOptions{})
+		}()
+	}
+	<-started
+
+	// The REST host has its own budget, so it is not blocked by the XML calls.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.Healthcheck.GetStatus(ctx); err != nil {
+		t.Fatalf("REST call was blocked by the XML calls: %s", err)
+	}
+
+	status := c.RateLimitStatus()[xmlHost]
+	if status.InFlight != 1 || status.MaxInFlight != 1 {
+		t.Errorf("RateLimitStatus()[%s] has %d of %d requests in flight, want 1 of 1", xmlHost, status.InFlight, status.MaxInFlight)
+	}
+
+	select {
+	case <-started:
+		t.Errorf("second XML call was sent while the first one was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	wg.Wait()
+
+	if status := c.RateLimitStatus()[xmlHost]; status.InFlight != 0 {
+		t.Errorf("RateLimitStatus()[%s].InFlight = %d after all calls finished, want 0", xmlHost, status.InFlight)
+	}
+}
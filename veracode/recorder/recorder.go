@@ -0,0 +1,373 @@
+// Package recorder provides an http.RoundTripper that records the traffic of a veracode.Client to a cassette file
+// and replays it, so that code that is built on the client can be tested deterministically and without network
+// access.
+package recorder
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ErrNoInteraction is returned by the Recorder in ModeReplay for requests that do not match any unused interaction
+// of the cassette.
+var ErrNoInteraction = errors.New("recorder: no matching interaction in cassette")
+
+const redacted = "REDACTED"
+
+// Mode determines whether a Recorder records or replays traffic.
+type Mode int
+
+const (
+	// ModeReplay replays the interactions of an existing cassette. Requests are never sent.
+	ModeReplay Mode = iota
+
+	// ModeRecord sends requests using Options.Transport and records the interactions. The cassette is written
+	// when the Recorder is stopped.
+	ModeRecord
+)
+
+// Options configures a Recorder.
+type Options struct {
+	Mode Mode
+
+	// Transport is used to send requests in ModeRecord. The default is http.DefaultTransport.
+	Transport http.RoundTripper
+
+	// RedactHeaders are the names of additional headers that are removed before the cassette is written. The
+	// Authorization, Proxy-Authorization, Cookie and Set-Cookie headers are always removed.
+	RedactHeaders []string
+
+	// RedactFields are the names of additional JSON fields, XML attributes and query parameters whose values are
+	// redacted before the cassette is written. The "api_secret" and "veracode_api_key_secret" fields are always
+	// redacted.
+	RedactFields []string
+}
+
+// redactHeaders contains the headers that are never written to a cassette.
+var redactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// redactFields contains the fields whose values are never written to a cassette.
+var redactFields = []string{"api_secret", "veracode_api_key_secret"}
+
+// Cassette contains the recorded interactions.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a single request and its response.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the sanitized request of an Interaction.
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// RecordedResponse is the sanitized response of an Interaction.
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Recorder is an http.RoundTripper that records or replays interactions. Use it as the base transport of a
+// veracode.Client, so that it sees the requests after they were signed:
+//
+//	rec, err := recorder.New("testdata/applications.json", recorder.Options{Mode: recorder.ModeReplay})
+//	...
+//	client, err := veracode.New(key, secret, veracode.WithHTTPClient(&http.Client{Transport: rec}))
+//
+// Authorization headers (including the HMAC nonce and timestamp) are never recorded, so they are not used to match
+// requests. A request matches an interaction if it has the same method, path, query and body. The scheme and host
+// are ignored, so that a cassette can be replayed with credentials of another region. Every interaction is replayed
+// at most once, in the order in which it was recorded.
+//
+// A Recorder is safe for concurrent use.
+type Recorder struct {
+	path    string
+	options Options
+	headers []string
+	fields  []string
+	fieldRe *regexp.Regexp
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+// New returns a new Recorder for the cassette at path. In ModeReplay, the cassette must exist.
+func New(path string, options Options) (*Recorder, error) {
+	r := &Recorder{
+		path:    path,
+		options: options,
+		headers: append(slices.Clone(redactHeaders), options.RedactHeaders...),
+		fields:  append(slices.Clone(redactFields), options.RedactFields...),
+	}
+
+	quoted := make([]string, len(r.fields))
+	for i, field := range r.fields {
+		quoted[i] = regexp.QuoteMeta(field)
+	}
+	r.fieldRe = regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)="[^"]*"`)
+
+	if r.options.Transport == nil {
+		r.options.Transport = http.DefaultTransport
+	}
+
+	if options.Mode == ModeReplay {
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("recorder: failed to read cassette: %w", err)
+		}
+
+		if err := json.Unmarshal(buf, &r.cassette); err != nil {
+			return nil, fmt.Errorf("recorder: failed to decode cassette %s: %w", path, err)
+		}
+
+		r.used = make([]bool, len(r.cassette.Interactions))
+	}
+
+	return r, nil
+}
+
+// RoundTrip is required to implement the http.RoundTripper interface.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.options.Mode == ModeReplay {
+		return r.replay(req, body)
+	}
+
+	return r.record(req, body)
+}
+
+// record sends req and records the sanitized interaction.
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	if body != nil {
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	resp, err := r.options.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	interaction := Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    r.sanitizeURL(req.URL),
+			Header: r.sanitizeHeader(req.Header),
+			Body:   r.sanitizeBody(body),
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     r.sanitizeHeader(resp.Header),
+			Body:       r.sanitizeBody(respBody),
+		},
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.mu.Unlock()
+
+	return resp, nil
+}
+
+// replay returns the response of the first unused interaction that matches req.
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	target := r.sanitizeURL(req.URL)
+	sanitized := r.sanitizeBody(body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, interaction := range r.cassette.Interactions {
+		if r.used[i] || interaction.Request.Method != req.Method || !sameTarget(interaction.Request.URL, target) || interaction.Request.Body != sanitized {
+			continue
+		}
+
+		r.used[i] = true
+
+		header := interaction.Response.Header.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+			StatusCode:    interaction.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, target)
+}
+
+// Stop writes the cassette in ModeRecord. In ModeReplay, it returns an error if not all interactions were replayed.
+func (r *Recorder) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.options.Mode == ModeReplay {
+		var unused []string
+		for i, interaction := range r.cassette.Interactions {
+			if !r.used[i] {
+				unused = append(unused, interaction.Request.Method+" "+interaction.Request.URL)
+			}
+		}
+
+		if len(unused) > 0 {
+			return fmt.Errorf("recorder: %d interactions were not replayed: %s", len(unused), strings.Join(unused, ", "))
+		}
+		return nil
+	}
+
+	buf, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return fmt.Errorf("recorder: failed to create cassette directory: %w", err)
+	}
+
+	return os.WriteFile(r.path, append(buf, '\n'), 0644)
+}
+
+// sanitizeHeader returns a copy of h without the redacted headers.
+func (r *Recorder) sanitizeHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range r.headers {
+		h.Del(name)
+	}
+
+	if len(h) == 0 {
+		return nil
+	}
+	return h
+}
+
+// sanitizeURL returns the path and query of u, with the values of redacted query parameters replaced.
+func (r *Recorder) sanitizeURL(u *url.URL) string {
+	query := u.Query()
+	for key := range query {
+		if r.isRedactedField(key) {
+			query[key] = []string{redacted}
+		}
+	}
+
+	s := u.EscapedPath()
+	if len(query) > 0 {
+		s += "?" + query.Encode()
+	}
+	return s
+}
+
+// sanitizeBody redacts the values of the redacted fields in a JSON or XML body.
+func (r *Recorder) sanitizeBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	// Numbers are decoded as json.Number, so that large IDs do not lose precision when the body is encoded again.
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var v any
+	if decoder.Decode(&v) == nil && !decoder.More() {
+		if !r.redactValue(v) {
+			return string(body)
+		}
+		if buf, err := json.Marshal(v); err == nil {
+			return string(buf)
+		}
+	}
+
+	return r.fieldRe.ReplaceAllString(string(body), `$1="`+redacted+`"`)
+}
+
+// redactValue replaces the values of all object keys that are redacted fields, at any depth. It reports whether
+// any value was replaced.
+func (r *Recorder) redactValue(v any) bool {
+	var changed bool
+
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if r.isRedactedField(key) {
+				v[key] = redacted
+				changed = true
+			} else if r.redactValue(value) {
+				changed = true
+			}
+		}
+	case []any:
+		for _, value := range v {
+			if r.redactValue(value) {
+				changed = true
+			}
+		}
+	}
+
+	return changed
+}
+
+func (r *Recorder) isRedactedField(name string) bool {
+	return slices.ContainsFunc(r.fields, func(field string) bool { return strings.EqualFold(field, name) })
+}
+
+// sameTarget reports whether two sanitized URLs have the same path and query. The order of the query parameters
+// is ignored.
+func sameTarget(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+
+	return ua.EscapedPath() == ub.EscapedPath() && ua.Query().Encode() == ub.Query().Encode()
+}
+
+// readBody reads and closes the body of req.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	return body, err
+}
@@ -0,0 +1,145 @@
+package recorder
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DanCreative/veracode-go/veracode"
+)
+
+const (
+	testApiKey    = "3ddaeeb10ca690df3fee5e3bd1c329fa"
+	testApiSecret = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+)
+
+func newTestClient(t *testing.T, rec *Recorder, baseURL string) *veracode.Client {
+	t.Helper()
+
+	c, err := veracode.New(testApiKey, testApiSecret,
+		veracode.WithHTTPClient(&http.Client{Transport: rec}),
+		veracode.WithBaseURLs(baseURL, baseURL),
+		veracode.WithRetryPolicy(veracode.NoRetryPolicy),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRecorder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/authn/v2/api_credentials":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Set-Cookie", "session=secret")
+			w.Write([]byte(`{"api_id":"abcd","api_secret":"super-secret"}`))
+		case "/api/5.0/getbuildinfo.do":
+			w.Header().Set("Content-Type", "text/xml")
+			w.Write([]byte(`<buildinfo app_id="1"><build build_id="2" results_ready="true"></build></buildinfo>`))
+		}
+	}))
+
+	path := filepath.Join(t.TempDir(), "cassettes", "test.json")
+
+	rec, err := New(path, Options{Mode: ModeRecord})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestClient(t, rec, server.URL)
+	ctx := context.Background()
+
+	creds, _, err := c.Identity.SelfGenerateCredentials(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.ApiSecret != "super-secret" {
+		t.Errorf("recorded call returned secret %q, want the real response", creds.ApiSecret)
+	}
+
+	if _, _, err := c.UploadXML.GetBuildInfo(ctx, veracode.BuildInfoOptions{AppId: 1, BuildId: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rec.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"super-secret", "Authorization", "VERACODE-HMAC", "session=secret"} {
+		if strings.Contains(string(buf), secret) {
+			t.Errorf("cassette contains %q:\n%s", secret, buf)
+		}
+	}
+
+	// Replay the cassette against another base URL, without a server.
+	rec, err = New(path, Options{Mode: ModeReplay})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c = newTestClient(t, rec, "https://api.example.com")
+
+	creds, _, err = c.Identity.SelfGenerateCredentials(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.ApiId != "abcd" || creds.ApiSecret != redacted {
+		t.Errorf("replayed credentials = %+v, want api id abcd with a redacted secret", creds)
+	}
+
+	if err := rec.Stop(); err == nil {
+		t.Errorf("Recorder.Stop() did not report the interaction that was not replayed")
+	}
+
+	info, _, err := c.UploadXML.GetBuildInfo(ctx, veracode.BuildInfoOptions{AppId: 1, BuildId: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Build.ResultsReady {
+		t.Errorf("replayed build info = %+v, want results ready", info)
+	}
+
+	// Every interaction is replayed only once and unmatched requests fail.
+	if _, _, err := c.UploadXML.GetBuildInfo(ctx, veracode.BuildInfoOptions{AppId: 1, BuildId: 2}); !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("UploadXMLService.GetBuildInfo() error = %v, want %v", err, ErrNoInteraction)
+	}
+
+	if err := rec.Stop(); err != nil {
+		t.Errorf("Recorder.Stop() error = %v after all interactions were replayed", err)
+	}
+}
+
+func TestRecorder_SanitizeBody(t *testing.T) {
+	rec, err := New("", Options{Mode: ModeRecord, RedactFields: []string{"token"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "json", body: `{"users":[{"token":"a","name":"b"}],"api_secret":"c"}`, want: `{"api_secret":"REDACTED","users":[{"name":"b","token":"REDACTED"}]}`},
+		{name: "json without secrets is kept", body: `{"id": 12345678901234567890}`, want: `{"id": 12345678901234567890}`},
+		{name: "xml", body: `<apicredentials api_id="a" api_secret="b"/>`, want: `<apicredentials api_id="a" api_secret="REDACTED"/>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rec.sanitizeBody([]byte(tt.body)); got != tt.want {
+				t.Errorf("Recorder.sanitizeBody() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
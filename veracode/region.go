@@ -1,34 +1,149 @@
 package veracode
 
 import (
+	"errors"
 	"fmt"
+	"maps"
 	"strings"
+	"sync"
 )
 
-type Region map[string]string
+var (
+	// ErrUnknownRegion is returned when the region character of an API key is not registered.
+	ErrUnknownRegion = errors.New("unknown veracode region")
 
-var Regions = map[string]map[string]string{
-	"e": Region{"rest": "https://api.veracode.eu", "xml": "https://analysiscenter.veracode.eu"},
-	"f": Region{"rest": "https://api.veracode.us", "xml": "https://analysiscenter.veracode.us"},
-	"g": Region{"rest": "https://api.veracode.com", "xml": "https://analysiscenter.veracode.com"},
+	// ErrInvalidKeyPrefix is returned when an API key starts with a prefix that does not have the expected format.
+	ErrInvalidKeyPrefix = errors.New("invalid API key prefix")
+)
+
+// Region holds the base URLs of the Veracode services in a Veracode region.
+//
+// Rest and XML are required. The other URLs are empty if the service is not available in the region.
+type Region struct {
+	Name           string // Name of the region, for example "commercial".
+	Rest           string // Base URL of the REST APIs.
+	XML            string // Base URL of the XML APIs.
+	PipelineScan   string // Base URL of the Pipeline Scan API.
+	SCAAgent       string // Base URL of the SCA agent API.
+	DASTEssentials string // Base URL of the DAST Essentials API.
+}
+
+// validate checks that the base URLs of r are valid and that the required ones are set.
+func (r Region) validate() error {
+	if r.Rest == "" || r.XML == "" {
+		return errors.New("region must have a REST and an XML base URL")
+	}
+
+	for name, rawURL := range map[string]string{
+		"REST":            r.Rest,
+		"XML":             r.XML,
+		"Pipeline Scan":   r.PipelineScan,
+		"SCA agent":       r.SCAAgent,
+		"DAST Essentials": r.DASTEssentials,
+	} {
+		if rawURL == "" {
+			continue
+		}
+		if _, err := parseBaseURL(rawURL); err != nil {
+			return fmt.Errorf("invalid %s base URL of region %s: %w", name, r.Name, err)
+		}
+	}
+
+	return nil
 }
 
+var (
+	regionsMu sync.RWMutex
+
+	// regions maps the region character of an API key prefix to its Region.
+	regions = map[string]Region{
+		"e": {
+			Name:         "european",
+			Rest:         "https://api.veracode.eu",
+			XML:          "https://analysiscenter.veracode.eu",
+			PipelineScan: "https://api.veracode.eu/pipeline_scan/v1",
+			SCAAgent:     "https://api.sourceclear.eu",
+		},
+		"f": {
+			Name:         "fedramp",
+			Rest:         "https://api.veracode.us",
+			XML:          "https://analysiscenter.veracode.us",
+			PipelineScan: "https://api.veracode.us/pipeline_scan/v1",
+			SCAAgent:     "https://api.veracode.us/srcclr",
+		},
+		"g": {
+			Name:           "commercial",
+			Rest:           "https://api.veracode.com",
+			XML:            "https://analysiscenter.veracode.com",
+			PipelineScan:   "https://api.veracode.com/pipeline_scan/v1",
+			SCAAgent:       "https://api.sourceclear.io",
+			DASTEssentials: "https://api.crashtest.cloud",
+		},
+	}
+)
+
+// RegisterRegion registers region for the region character of API key prefixes, replacing the region that was
+// registered for it before. The built-in regions are "e" (european), "f" (fedramp) and "g" (commercial).
+//
+// Clients that have already been created keep using their region until their credentials are updated.
+func RegisterRegion(character string, region Region) error {
+	if len(character) != 1 {
+		return fmt.Errorf("region character %q must be a single character", character)
+	}
+
+	if err := region.validate(); err != nil {
+		return err
+	}
+
+	regionsMu.Lock()
+	defer regionsMu.Unlock()
+
+	regions[strings.ToLower(character)] = region
+	return nil
+}
+
+// LookupRegion returns the region that is registered for the region character of API key prefixes.
+func LookupRegion(character string) (Region, bool) {
+	regionsMu.RLock()
+	defer regionsMu.RUnlock()
+
+	region, ok := regions[strings.ToLower(character)]
+	return region, ok
+}
+
+// Regions returns a copy of the registered regions, keyed by their region character.
+func Regions() map[string]Region {
+	regionsMu.RLock()
+	defer regionsMu.RUnlock()
+
+	return maps.Clone(regions)
+}
+
+// GetRegionFromCredentials returns the region of apiKey. The region is determined by the 7th character of the 8
+// character prefix of the API key, for example the "e" of "vera01ei-". API keys without a prefix belong to the
+// commercial region ("g").
+//
+// It returns an error that wraps ErrInvalidKeyPrefix if the prefix does not have 8 characters, or ErrUnknownRegion if
+// no region is registered for the region character.
 func GetRegionFromCredentials(apiKey string) (Region, error) {
-	var regionCharacter string
-	if strings.Contains(apiKey, "-") {
-		prefix := strings.Split(apiKey, "-")[0]
+	regionCharacter := "g"
+
+	if prefix, _, ok := strings.Cut(apiKey, "-"); ok {
 		if len(prefix) != 8 {
-			return nil, fmt.Errorf("credential %s starts with an invalid prefix", apiKey)
+			return Region{}, fmt.Errorf("%w: prefix %q of credential %s must have 8 characters", ErrInvalidKeyPrefix, prefix, apiKey)
 		}
 
-		regionCharacter = strings.ToLower(string(prefix[6]))
-	} else {
-		regionCharacter = "g"
+		regionCharacter = prefix[6:7]
+		if region, ok := LookupRegion(regionCharacter); ok {
+			return region, nil
+		}
+
+		return Region{}, fmt.Errorf("%w: character %q at position 7 of prefix %q of credential %s is not a registered region", ErrUnknownRegion, regionCharacter, prefix, apiKey)
 	}
 
-	if v, ok := Regions[regionCharacter]; ok {
-		return v, nil
-	} else {
-		return nil, fmt.Errorf("credential %s does not map to a known region", apiKey)
+	if region, ok := LookupRegion(regionCharacter); ok {
+		return region, nil
 	}
+
+	return Region{}, fmt.Errorf("%w: no region is registered for credential %s without a prefix (%q)", ErrUnknownRegion, apiKey, regionCharacter)
 }
@@ -0,0 +1,88 @@
+package veracode
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGetRegionFromCredentials(t *testing.T) {
+	tests := []struct {
+		name    string
+		apiKey  string
+		want    string
+		wantErr error
+	}{
+		{name: "no prefix", apiKey: testApiKey, want: "commercial"},
+		{name: "european", apiKey: "vera01ei-" + testApiKey, want: "european"},
+		{name: "upper case", apiKey: "VERA01FI-" + testApiKey, want: "fedramp"},
+		{name: "short prefix", apiKey: "vera01e-" + testApiKey, wantErr: ErrInvalidKeyPrefix},
+		{name: "unknown region", apiKey: "vera01xi-" + testApiKey, wantErr: ErrUnknownRegion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			region, err := GetRegionFromCredentials(tt.apiKey)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetRegionFromCredentials() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if region.Name != tt.want {
+				t.Errorf("GetRegionFromCredentials() = %q, want %q", region.Name, tt.want)
+			}
+		})
+	}
+
+	_, err := GetRegionFromCredentials("vera01xi-" + testApiKey)
+	if !strings.Contains(err.Error(), `character "x"`) {
+		t.Errorf("expected the error to name the unknown character, got: %v", err)
+	}
+}
+
+func TestRegisterRegion(t *testing.T) {
+	original := Regions()
+	t.Cleanup(func() {
+		regionsMu.Lock()
+		regions = original
+		regionsMu.Unlock()
+	})
+
+	staging := Region{Name: "staging", Rest: "https://api.staging.example", XML: "https://xml.staging.example"}
+	if err := RegisterRegion("X", staging); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New("vera01xi-"+testApiKey, testApiSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.baseRestURL.String() != "https://api.staging.example/" || c.baseXmlURL.String() != "https://xml.staging.example/" {
+		t.Errorf("got base URLs %s and %s, expected the staging region", c.baseRestURL, c.baseXmlURL)
+	}
+
+	// Built-in regions can be overridden.
+	if err := RegisterRegion("g", staging); err != nil {
+		t.Fatal(err)
+	}
+
+	if region, _ := GetRegionFromCredentials(testApiKey); region != staging {
+		t.Errorf("got region %+v, expected the override", region)
+	}
+
+	if len(original) != 3 || original["g"].Name != "commercial" {
+		t.Errorf("Regions() did not return a copy: %+v", original)
+	}
+
+	for name, tt := range map[string]struct {
+		character string
+		region    Region
+	}{
+		"empty character":   {character: "", region: staging},
+		"missing XML":       {character: "y", region: Region{Rest: "https://api.staging.example"}},
+		"invalid SCA agent": {character: "y", region: Region{Rest: staging.Rest, XML: staging.XML, SCAAgent: "ftp://sca.example"}},
+	} {
+		if err := RegisterRegion(tt.character, tt.region); err == nil {
+			t.Errorf("%s: RegisterRegion() error = nil, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package veracode
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy configures how the veracodeTransport retries requests that failed with a transient error.
+//
+// Requests are retried when the API responds with one of the RetryStatusCodes or when the request failed with a
+// network error before a response was received (for example a connection reset). Errors that occur before the
+// request is sent, such as invalid credentials or a context deadline that the rate limiter cannot meet, are not
+// retried. The delay between attempts grows exponentially from BaseDelay up to MaxDelay with full jitter. If the
+// response contains a Retry-After header, its value is used instead.
+//
+// By default only idempotent methods (GET, HEAD, OPTIONS and DELETE) are retried. Set RetryNonIdempotent to true to
+// also retry POST, PUT and PATCH requests.
+type RetryPolicy struct {
+	MaxAttempts        int           // Total number of attempts, including the first one. A value of 1 or less disables retries.
+	BaseDelay          time.Duration // Delay before the first retry. Each following retry doubles the delay.
+	MaxDelay           time.Duration // Maximum delay between attempts. A Retry-After value that exceeds MaxDelay will not be retried.
+	RetryStatusCodes   []int         // HTTP status codes that are considered transient.
+	RetryNonIdempotent bool          // Retry POST, PUT and PATCH requests as well.
+}
+
+// DefaultRetryPolicy is the RetryPolicy used by a new Client. A Client copies the policy when it is created, so
+// changing DefaultRetryPolicy afterwards does not affect existing Clients.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:      4,
+	BaseDelay:        500 * time.Millisecond,
+	MaxDelay:         30 * time.Second,
+	RetryStatusCodes: []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+}
+
+// NoRetryPolicy disables retries. Every request is sent exactly once.
+var NoRetryPolicy = RetryPolicy{MaxAttempts: 1}
+
+// shouldRetry reports whether the outcome of an attempt for req is eligible for another attempt.
+func (p RetryPolicy) shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if !p.isRetryableMethod(req.Method) {
+		return false
+	}
+
+	// The body can only be sent again if it can be recreated.
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	if err != nil {
+		// Do not retry if the caller gave up.
+		if req.Context().Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false
+		}
+		return isTransientError(err)
+	}
+
+	return slices.Contains(p.RetryStatusCodes, resp.StatusCode)
+}
+
+// isTransientError reports whether err is a network error that may not occur again on another attempt. Errors that
+// are caused locally, for example by credentials that cannot be parsed, are never transient.
+func isTransientError(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func (p RetryPolicy) isRetryableMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodDelete:
+		return true
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		return p.RetryNonIdempotent
+	default:
+		return false
+	}
+}
+
+// delay returns how long to wait before the next attempt, given that attempt (1-based) has just failed.
+// The returned bool is false if the server asked to wait longer than MaxDelay.
+func (p RetryPolicy) delay(attempt int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil {
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			if p.MaxDelay > 0 && d > p.MaxDelay {
+				return 0, false
+			}
+			return d, true
+		}
+	}
+
+	backoff := p.BaseDelay << (attempt - 1)
+	if backoff <= 0 || (p.MaxDelay > 0 && backoff > p.MaxDelay) {
+		// backoff <= 0 covers an overflow of the shift.
+		backoff = p.MaxDelay
+	}
+
+	if backoff <= 0 {
+		return 0, true
+	}
+
+	// Full jitter: pick a random delay between 0 and the exponential backoff.
+	return rand.N(backoff + 1), true
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which can either be a number of seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		d := date.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+
+	return 0, false
+}
+
+// sleepContext waits for d or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// discardResponse drains and closes the body of a response that will not be returned to the caller,
+// so that the underlying connection can be reused.
+func discardResponse(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
@@ -0,0 +1,238 @@
+package veracode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/DanCreative/veracode-go/hmac"
+)
+
+const (
+	testApiKey    = "3ddaeeb10ca690df3fee5e3bd1c329fa"
+	testApiSecret = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+)
+
+// newRetryTestClient returns a Client that sends all requests to the test server and retries with a negligible delay.
+func newRetryTestClient(t *testing.T, server *httptest.Server) *Client {
+	t.Helper()
+
+	policy := DefaultRetryPolicy
+	policy.BaseDelay = time.Millisecond
+
+	c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithRetryPolicy(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestClient_Do_Retry(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		statuses     []int
+		wantAttempts int
+		wantStatus   int
+	}{
+		{
+			name:         "GET succeeds after transient errors",
+			method:       http.MethodGet,
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			wantAttempts: 3,
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name:         "GET gives up after max attempts",
+			method:       http.MethodGet,
+			statuses:     []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK},
+			wantAttempts: 4,
+			wantStatus:   http.StatusBadGateway,
+		},
+		{
+			name:         "GET does not retry client errors",
+			method:       http.MethodGet,
+			statuses:     []int{http.StatusBadRequest, http.StatusOK},
+			wantAttempts: 1,
+			wantStatus:   http.StatusBadRequest,
+		},
+		{
+			name:         "POST is not retried by default",
+			method:       http.MethodPost,
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusOK},
+			wantAttempts: 1,
+			wantStatus:   http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if n := len(r.Header.Values("Authorization")); n != 1 {
+					t.Errorf("request has %d Authorization headers, want 1", n)
+				}
+
+				i := int(calls.Add(1)) - 1
+				w.WriteHeader(tt.statuses[i])
+			}))
+			defer server.Close()
+
+			c := newRetryTestClient(t, server)
+
+			req, err := c.NewRequest(context.Background(), "/healthcheck/status", tt.method, strings.NewReader("{}"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, _ := c.Do(req, nil)
+			if resp.Attempts != tt.wantAttempts {
+				t.Errorf("Response.Attempts = %d, want %d", resp.Attempts, tt.wantAttempts)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Response.StatusCode = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestClient_Do_RetryResignsRequest(t *testing.T) {
+	var headers []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Get("Authorization"))
+		if len(headers) < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	c := newRetryTestClient(t, server)
+
+	req, err := c.NewRequest(context.Background(), "/healthcheck/status", http.MethodGet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Do(req, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(headers) != 2 {
+		t.Fatalf("server received %d requests, want 2", len(headers))
+	}
+	if headers[0] == headers[1] {
+		t.Errorf("retry reused the Authorization header of the first attempt")
+	}
+	if req.Header.Get("Authorization") != "" {
+		t.Errorf("the caller's request was modified")
+	}
+}
+
+func TestClient_SetRetryPolicy_CopiesStatusCodes(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 2, RetryStatusCodes: []int{http.StatusServiceUnavailable}}
+
+	c, err := New(testApiKey, testApiSecret, WithRetryPolicy(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy.RetryStatusCodes[0] = http.StatusInternalServerError
+	if got := c.transport.retryPolicy.Load().RetryStatusCodes; !slices.Equal(got, []int{http.StatusServiceUnavailable}) {
+		t.Errorf("RetryStatusCodes after changing the policy passed to WithRetryPolicy = %v, want [503]", got)
+	}
+
+	c.SetRetryPolicy(policy)
+	policy.RetryStatusCodes[0] = http.StatusBadGateway
+	if got := c.transport.retryPolicy.Load().RetryStatusCodes; !slices.Equal(got, []int{http.StatusInternalServerError}) {
+		t.Errorf("RetryStatusCodes after changing the policy passed to SetRetryPolicy = %v, want [500]", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOk bool
+	}{
+		{name: "seconds", value: "3", want: 3 * time.Second, wantOk: true},
+		{name: "http date", value: "Mon, 01 Jan 2024 12:00:10 GMT", want: 10 * time.Second, wantOk: true},
+		{name: "date in the past", value: "Mon, 01 Jan 2024 11:00:00 GMT", want: 0, wantOk: true},
+		{name: "empty", value: "", want: 0, wantOk: false},
+		{name: "invalid", value: "soon", want: 0, wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.value, now)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("parseRetryAfter() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_ShouldRetryErrors(t *testing.T) {
+	_, signerErr := hmac.NewSigner(testApiKey, "not-hex")
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "connection reset", err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, want: true},
+		{name: "unexpected EOF", err: io.ErrUnexpectedEOF, want: true},
+		{name: "timeout", err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}, want: true},
+		{name: "signing error", err: signerErr, want: false},
+		{name: "credentials error", err: fmt.Errorf("could not get Veracode API credentials: %w", ErrNoCredentials), want: false},
+		{name: "rate limiter deadline", err: errors.New("rate: Wait(n=1) would exceed context deadline"), want: false},
+		{name: "circuit open", err: ErrCircuitOpen, want: false},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/healthcheck/status", nil)
+			if got := DefaultRetryPolicy.shouldRetry(req, nil, tt.err); got != tt.want {
+				t.Errorf("shouldRetry(%v) = %t, want %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_Do_NoRetryForSigningErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the request should not be sent")
+	}))
+	defer server.Close()
+
+	c, err := New(testApiKey, "not-hex", WithBaseURLs(server.URL, server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := c.NewRequest(context.Background(), "/healthcheck/status", http.MethodGet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := c.Do(req, nil)
+	if err == nil {
+		t.Fatal("expected a signing error")
+	}
+	if resp.Attempts != 1 {
+		t.Errorf("Response.Attempts = %d, want 1", resp.Attempts)
+	}
+}
@@ -0,0 +1,382 @@
+package veracode
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// CredentialsSink persists API credentials after they have been rotated by a [CredentialRotator].
+type CredentialsSink interface {
+	SaveCredentials(ctx context.Context, creds Credentials) error
+}
+
+// CredentialsSinkFunc is an adapter that allows a function, for example one that writes the credentials to a secrets
+// vault, to be used as a CredentialsSink.
+type CredentialsSinkFunc func(ctx context.Context, creds Credentials) error
+
+// SaveCredentials is required to implement the CredentialsSink interface.
+func (f CredentialsSinkFunc) SaveCredentials(ctx context.Context, creds Credentials) error {
+	return f(ctx, creds)
+}
+
+// FileCredentialsSink is a CredentialsSink that saves the credentials to a profile in a Veracode API credentials file
+// using [SaveProfile].
+type FileCredentialsSink struct {
+	// Path is the path of the credentials file. If it is empty, the path returned by [GetCredentialsFilePath] is used.
+	Path string
+
+	// Profile is the name of the profile. If it is empty, the profile is read from the VERACODE_API_PROFILE environment
+	// variable. If the variable is not set either, the profile with name "default" is used.
+	Profile string
+}
+
+// SaveCredentials is required to implement the CredentialsSink interface.
+func (s *FileCredentialsSink) SaveCredentials(ctx context.Context, creds Credentials) error {
+	path := s.Path
+	if path == "" {
+		var err error
+		if path, err = GetCredentialsFilePath(); err != nil {
+			return err
+		}
+	}
+
+	profile := s.Profile
+	if profile == "" {
+		profile = os.Getenv(EnvAPIProfile)
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	return SaveProfile(path, Profile{Name: profile, VeracodeApiKeyId: creds.APIKeyID, VeracodeApiKeySecret: creds.APIKeySecret})
+}
+
+// RotationPersistError is returned by a CredentialRotator if new credentials were generated, but could not be saved
+// by the CredentialsSink. The current credentials have already been revoked, so Credentials may be the only copy of
+// the new API key secret.
+type RotationPersistError struct {
+	Credentials APICredentials
+	Err         error
+}
+
+func (e *RotationPersistError) Error() string {
+	return fmt.Sprintf("the API credentials were rotated to %s, but could not be saved: %v", e.Credentials.ApiId, e.Err)
+}
+
+func (e *RotationPersistError) Unwrap() error {
+	return e.Err
+}
+
+// RotatorOptions configures a CredentialRotator.
+type RotatorOptions struct {
+	// LeadTime is how long before the credentials expire they are rotated. The default is 7 days.
+	LeadTime time.Duration
+
+	// CheckInterval is the maximum time between two checks of the expiration time of the credentials. Checks that
+	// fail are retried after CheckInterval. The default is 1 hour.
+	CheckInterval time.Duration
+
+	// Sink persists the new credentials. If it is nil, the new credentials are only used by the Client and are lost
+	// when the process exits.
+	Sink CredentialsSink
+
+	// OnRotate is called after the Client has switched to the new credentials, even if they could not be persisted
+	// by the Sink. It is optional.
+	OnRotate func(old, new APICredentials)
+}
+
+// CredentialRotator keeps the API credentials of a Client from expiring. It checks the expiration time of the current
+// credentials using [IdentityService.SelfGetCredentials], generates new credentials using
+// [IdentityService.SelfGenerateCredentials] once they are about to expire, switches the Client over using
+// [Client.UpdateCredentials] and persists them using a CredentialsSink.
+//
+// The Veracode API revokes the current credentials of an API user as soon as new credentials are generated, so the
+// old and new credentials cannot be valid at the same time. To hand over without failing requests, the rotator waits
+// until the calls of the Client that are in flight have been answered and holds back new calls until the Client has
+// switched to the new credentials. Calls that are held back continue with the new credentials and, if the new API
+// key belongs to a different region, are sent to the base URL of that region.
+//
+// Other processes or Clients that use the same credentials fail with a 401 response until they load the new
+// credentials, for example from the CredentialsSink. The rotator should therefore be the only one that rotates the
+// credentials of the API user.
+//
+// If the new API key belongs to a different region, the Client is switched to the base URLs of that region, unless
+// they were set using [WithRegion] or [WithBaseURLs].
+type CredentialRotator struct {
+	client *Client
+	opts   RotatorOptions
+	now    func() time.Time
+	mu     sync.Mutex // Ensures that the credentials are not rotated concurrently.
+}
+
+// NewCredentialRotator returns a CredentialRotator for the credentials of client.
+//
+// The rotator replaces the credentials of client using [Client.UpdateCredentials], which also replaces a
+// CredentialsProvider that was set using [WithCredentialsProvider].
+func NewCredentialRotator(client *Client, opts RotatorOptions) *CredentialRotator {
+	if opts.LeadTime <= 0 {
+		opts.LeadTime = 7 * 24 * time.Hour
+	}
+
+	if opts.CheckInterval <= 0 {
+		opts.CheckInterval = time.Hour
+	}
+
+	return &CredentialRotator{client: client, opts: opts, now: time.Now}
+}
+
+// Run checks the credentials and rotates them when they are about to expire, until ctx is done. Errors are logged
+// using the Client's logger and the check is retried after RotatorOptions.CheckInterval. Run is typically started in
+// its own goroutine.
+//
+// Run returns the error of ctx when ctx is done.
+func (r *CredentialRotator) Run(ctx context.Context) error {
+	for {
+		wait := r.opts.CheckInterval
+
+		next, err := r.check(ctx)
+		if err != nil {
+			r.client.logger.LogAttrs(ctx, slog.LevelError, "veracode api credential rotation failed", slog.String("error", err.Error()))
+		} else if until := next.Sub(r.now()); until > 0 && until < wait {
+			wait = until
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// RotateIfNeeded rotates the credentials if they expire within RotatorOptions.LeadTime and reports whether they were
+// rotated. The credentials are only reported as rotated once the Client uses the new credentials.
+//
+// If the new credentials could not be persisted, the returned error wraps a *RotationPersistError that holds them.
+func (r *CredentialRotator) RotateIfNeeded(ctx context.Context) (bool, error) {
+	_, rotated, err := r.rotateIfNeeded(ctx, false)
+	return rotated, err
+}
+
+// Rotate generates new credentials, switches the Client over to them and persists them using the
+// RotatorOptions.Sink, regardless of when the current credentials expire. It returns the new credentials.
+//
+// If the Client cannot be switched over to the new credentials or if they cannot be persisted, an error is returned
+// that contains the new API key ID, together with the new credentials, so that they can be recovered. If persisting
+// failed, the error wraps a *RotationPersistError and the Client keeps using the new credentials.
+//
+// If the Client is in dry-run mode (see [WithDryRun]), the credentials are not rotated and an error that wraps
+// [ErrDryRun] is returned.
+func (r *CredentialRotator) Rotate(ctx context.Context) (APICredentials, error) {
+	creds, _, err := r.rotateIfNeeded(ctx, true)
+	return creds, err
+}
+
+// check rotates the credentials if needed and returns the time at which they should be checked again.
+func (r *CredentialRotator) check(ctx context.Context) (time.Time, error) {
+	creds, _, err := r.rotateIfNeeded(ctx, false)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return r.rotateAt(creds), nil
+}
+
+// rotateIfNeeded rotates the credentials if they are about to expire or if force is true. It returns the credentials
+// that the Client uses afterwards and whether they were rotated.
+func (r *CredentialRotator) rotateIfNeeded(ctx context.Context, force bool) (APICredentials, bool, error) {
+	// The lock is held while checking the credentials, so that concurrent calls do not rotate them more than once.
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, _, err := r.client.Identity.SelfGetCredentials(ctx)
+	if err != nil {
+		return APICredentials{}, false, fmt.Errorf("could not get the current API credentials: %w", err)
+	}
+
+	if !force && r.now().Before(r.rotateAt(current)) {
+		return current, false, nil
+	}
+
+	// In dry-run mode, the new credentials are not generated, so the Client must keep using the current ones.
+	if r.client.dryRun != nil {
+		return current, false, fmt.Errorf("%w: API credentials cannot be rotated in dry-run mode", ErrDryRun)
+	}
+
+	return r.rotate(ctx, current)
+}
+
+// rotateAt returns the time at which creds should be rotated. Credentials without an expiration time are never
+// rotated automatically.
+func (r *CredentialRotator) rotateAt(creds APICredentials) time.Time {
+	if creds.ExpirationTs.IsZero() {
+		return r.now().Add(r.opts.CheckInterval)
+	}
+	return creds.ExpirationTs.Add(-r.opts.LeadTime)
+}
+
+// rotate replaces the current credentials with new credentials. It returns the new credentials if they were
+// generated, even if it fails afterwards, and whether the Client was switched over to them.
+func (r *CredentialRotator) rotate(ctx context.Context, current APICredentials) (APICredentials, bool, error) {
+	// Generating new credentials revokes the current ones, so no other call of the Client may be in flight until the
+	// Client has switched over.
+	switchCtx, unlock, err := r.client.credentialsGate.lock(ctx)
+	if err != nil {
+		return APICredentials{}, false, fmt.Errorf("could not wait for the calls in flight: %w", err)
+	}
+
+	generated, _, err := r.client.Identity.SelfGenerateCredentials(switchCtx)
+	if err != nil {
+		unlock()
+		return APICredentials{}, false, fmt.Errorf("could not generate new API credentials: %w", err)
+	}
+
+	err = r.client.UpdateCredentials(generated.ApiId, generated.ApiSecret)
+	unlock()
+
+	if err != nil {
+		return generated, false, r.persist(ctx, generated, fmt.Errorf("could not switch the client to the new API credentials %s: %w", generated.ApiId, err))
+	}
+
+	oldRegion, _ := GetRegionFromCredentials(current.ApiId)
+	newRegion, _ := GetRegionFromCredentials(generated.ApiId)
+
+	attrs := []slog.Attr{
+		slog.String("old_api_id", current.ApiId),
+		slog.String("new_api_id", generated.ApiId),
+		slog.Time("expiration_ts", generated.ExpirationTs.Time),
+	}
+	if oldRegion.Rest != newRegion.Rest {
+		attrs = append(attrs, slog.String("region", newRegion.Name))
+	}
+	r.client.logger.LogAttrs(ctx, slog.LevelInfo, "veracode api credentials rotated", attrs...)
+
+	// OnRotate is called even if the credentials cannot be persisted, because the Client may hold the only copy of
+	// the new secret.
+	err = r.persist(ctx, generated, nil)
+
+	if r.opts.OnRotate != nil {
+		r.opts.OnRotate(current, generated)
+	}
+
+	return generated, true, err
+}
+
+// persist saves creds using the sink and returns cause, joined with a *RotationPersistError if the sink failed.
+func (r *CredentialRotator) persist(ctx context.Context, creds APICredentials, cause error) error {
+	if r.opts.Sink == nil {
+		return cause
+	}
+
+	err := r.opts.Sink.SaveCredentials(ctx, Credentials{APIKeyID: creds.ApiId, APIKeySecret: creds.ApiSecret, Source: "rotation"})
+	if err != nil {
+		err = &RotationPersistError{Credentials: creds, Err: err}
+		if cause != nil {
+			return fmt.Errorf("%w; %w", cause, err)
+		}
+		return err
+	}
+	return cause
+}
+
+// credentialsGate lets a CredentialRotator switch the credentials of a Client while none of its calls are in flight.
+// The zero value is ready to use.
+type credentialsGate struct {
+	mu      sync.Mutex
+	active  int           // Number of calls in flight.
+	pending chan struct{} // Closed once the pending switch is done. Nil if no switch is pending.
+	drained chan struct{} // Closed once the last call in flight leaves during a pending switch.
+}
+
+type credentialsGateKey struct{}
+
+// enter blocks while the credentials are being switched or until ctx is done. If enter returns nil, the returned
+// function must be called once the call is no longer in flight.
+//
+// Calls made with the returned context, for example from a Hook, do not wait for the gate again.
+func (g *credentialsGate) enter(ctx context.Context) (context.Context, func(), error) {
+	if ctx.Value(credentialsGateKey{}) == g {
+		return ctx, func() {}, nil
+	}
+
+	g.mu.Lock()
+	if err := g.waitPending(ctx); err != nil {
+		return nil, nil, err
+	}
+	g.active++
+	g.mu.Unlock()
+
+	return context.WithValue(ctx, credentialsGateKey{}, g), g.leave, nil
+}
+
+func (g *credentialsGate) leave() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.active--
+	if g.active == 0 && g.drained != nil {
+		close(g.drained)
+		g.drained = nil
+	}
+}
+
+// lock waits until no calls are in flight and holds back new calls until the returned function is called. The calls
+// that switch the credentials must be made with the returned context.
+func (g *credentialsGate) lock(ctx context.Context) (context.Context, func(), error) {
+	g.mu.Lock()
+	if err := g.waitPending(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	pending := make(chan struct{})
+	g.pending = pending
+
+	var drained chan struct{}
+	if g.active > 0 {
+		drained = make(chan struct{})
+		g.drained = drained
+	}
+	g.mu.Unlock()
+
+	unlock := func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+
+		g.pending, g.drained = nil, nil
+		close(pending)
+	}
+
+	if drained != nil {
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			unlock()
+			return nil, nil, ctx.Err()
+		}
+	}
+
+	return context.WithValue(ctx, credentialsGateKey{}, g), unlock, nil
+}
+
+// waitPending waits until no switch is pending. The caller must hold g.mu, which is held again when waitPending
+// returns nil and released if it returns an error.
+func (g *credentialsGate) waitPending(ctx context.Context) error {
+	for g.pending != nil {
+		pending := g.pending
+		g.mu.Unlock()
+
+		select {
+		case <-pending:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		g.mu.Lock()
+	}
+	return nil
+}
@@ -0,0 +1,478 @@
+package veracode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DanCreative/veracode-go/hmac"
+)
+
+// fakeCredentialsServer implements the api_credentials endpoints of the Identity API for a single API user.
+// Generating new credentials revokes the current credentials, like the Veracode platform does.
+type fakeCredentialsServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	apiID     string // Current API key ID, including the region prefix.
+	secret    string
+	expires   time.Time
+	prefix    string // Region prefix of generated credentials.
+	generated int
+	hosts     []string // Hosts of the received requests.
+
+	// Requests with the query parameter "slow" are reported on arrived and answered once release is closed.
+	arrived chan struct{}
+	release chan struct{}
+}
+
+func newFakeCredentialsServer(t *testing.T, expires time.Time) *fakeCredentialsServer {
+	t.Helper()
+
+	s := &fakeCredentialsServer{apiID: testApiKey, secret: testApiSecret, expires: expires, arrived: make(chan struct{}, 1), release: make(chan struct{})}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *fakeCredentialsServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Has("slow") {
+		s.arrived <- struct{}{}
+		<-s.release
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hosts = append(s.hosts, r.Host)
+
+	if _, err := hmac.Verify(r, func(apiKeyID string) (string, error) {
+		if apiKeyID != withoutRegionPrefix(s.apiID) {
+			return "", hmac.ErrUnknownKey
+		}
+		return s.secret, nil
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	body := map[string]string{"api_id": s.apiID, "expiration_ts": s.expires.Format(time.RFC3339)}
+
+	if r.Method == http.MethodPost {
+		s.generated++
+		s.apiID = s.prefix + strings.Repeat(string(rune('a'+s.generated)), 32)
+		s.expires = time.Now().Add(365 * 24 * time.Hour)
+
+		body = map[string]string{"api_id": s.apiID, "api_secret": s.prefix + testApiSecret, "expiration_ts": s.expires.Format(time.RFC3339)}
+		s.secret = testApiSecret
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+// withoutRegionPrefix removes the region prefix of an API key ID.
+func withoutRegionPrefix(apiKeyID string) string {
+	if _, id, ok := strings.Cut(apiKeyID, "-"); ok {
+		return id
+	}
+	return apiKeyID
+}
+
+func TestCredentialRotator_RotateIfNeeded(t *testing.T) {
+	server := newFakeCredentialsServer(t, time.Now().Add(30*24*time.Hour))
+
+	c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithRetryPolicy(NoRetryPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var saved []Credentials
+	var rotations int
+
+	rotator := NewCredentialRotator(c, RotatorOptions{
+		LeadTime: 14 * 24 * time.Hour,
+		Sink: CredentialsSinkFunc(func(ctx context.Context, creds Credentials) error {
+			saved = append(saved, creds)
+			return nil
+		}),
+		OnRotate: func(old, new APICredentials) { rotations++ },
+	})
+
+	// The credentials expire in 30 days, which is outside of the lead time.
+	if rotated, err := rotator.RotateIfNeeded(context.Background()); err != nil || rotated {
+		t.Fatalf("RotateIfNeeded returned %t, %v, expected no rotation", rotated, err)
+	}
+
+	// 20 days later, the credentials expire within the lead time.
+	rotator.now = func() time.Time { return time.Now().Add(20 * 24 * time.Hour) }
+
+	if rotated, err := rotator.RotateIfNeeded(context.Background()); err != nil || !rotated {
+		t.Fatalf("RotateIfNeeded returned %t, %v, expected a rotation", rotated, err)
+	}
+
+	if len(saved) != 1 || saved[0].APIKeyID != server.apiID || rotations != 1 {
+		t.Fatalf("unexpected saved credentials %+v after %d rotations", saved, rotations)
+	}
+
+	// The Client uses the new credentials, the old ones have been revoked.
+	creds, _, err := c.Identity.SelfGetCredentials(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if creds.ApiId != saved[0].APIKeyID {
+		t.Errorf("got API key ID %s, expected %s", creds.ApiId, saved[0].APIKeyID)
+	}
+}
+
+func TestCredentialRotator_DryRun(t *testing.T) {
+	for _, mode := range []DryRunMode{DryRunError, DryRunEcho} {
+		server := newFakeCredentialsServer(t, time.Now().Add(time.Hour))
+
+		var plan Plan
+		c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithDryRun(&plan, mode))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rotator := NewCredentialRotator(c, RotatorOptions{
+			Sink: CredentialsSinkFunc(func(ctx context.Context, creds Credentials) error {
+				t.Errorf("dry run mode %d: credentials were persisted", mode)
+				return nil
+			}),
+		})
+
+		if _, err := rotator.Rotate(context.Background()); !errors.Is(err, ErrDryRun) {
+			t.Errorf("dry run mode %d: Rotate returned %v, expected ErrDryRun", mode, err)
+		}
+		if rotated, err := rotator.RotateIfNeeded(context.Background()); rotated || !errors.Is(err, ErrDryRun) {
+			t.Errorf("dry run mode %d: RotateIfNeeded returned %t, %v, expected ErrDryRun", mode, rotated, err)
+		}
+
+		// The Client keeps using the current credentials.
+		creds, _, err := c.Identity.SelfGetCredentials(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if creds.ApiId != testApiKey || len(plan.Operations()) != 0 {
+			t.Errorf("dry run mode %d: got API key ID %s and %d planned operations, expected %s and none", mode, creds.ApiId, len(plan.Operations()), testApiKey)
+		}
+	}
+}
+
+func TestCredentialRotator_FileSink(t *testing.T) {
+	server := newFakeCredentialsServer(t, time.Now().Add(time.Hour))
+	path := filepath.Join(t.TempDir(), "credentials")
+
+	c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithRetryPolicy(NoRetryPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotator := NewCredentialRotator(c, RotatorOptions{Sink: &FileCredentialsSink{Path: path, Profile: "service"}})
+
+	if _, err := rotator.Rotate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err := (&FileCredentialsProvider{Path: path, Profile: "service"}).Credentials(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if creds.APIKeyID != server.apiID {
+		t.Errorf("got API key ID %s from the file, expected %s", creds.APIKeyID, server.apiID)
+	}
+}
+
+func TestCredentialRotator_SinkError(t *testing.T) {
+	server := newFakeCredentialsServer(t, time.Now().Add(time.Hour))
+
+	c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithRetryPolicy(NoRetryPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rotatedTo APICredentials
+	rotator := NewCredentialRotator(c, RotatorOptions{
+		Sink: CredentialsSinkFunc(func(ctx context.Context, creds Credentials) error {
+			return errors.New("vault is sealed")
+		}),
+		OnRotate: func(old, new APICredentials) { rotatedTo = new },
+	})
+
+	rotated, err := rotator.RotateIfNeeded(context.Background())
+	if err == nil || !strings.Contains(err.Error(), server.apiID) || !strings.Contains(err.Error(), "vault is sealed") {
+		t.Fatalf("expected an error with the new API key ID, got: %v", err)
+	}
+
+	if !rotated {
+		t.Error("expected the credentials to be reported as rotated")
+	}
+
+	// The new credentials can be recovered from the error and OnRotate.
+	var persistErr *RotationPersistError
+	if !errors.As(err, &persistErr) || persistErr.Credentials.ApiId != server.apiID || persistErr.Credentials.ApiSecret == "" {
+		t.Errorf("expected a RotationPersistError with the new credentials, got: %#v", err)
+	}
+
+	if rotatedTo.ApiId != server.apiID || rotatedTo.ApiSecret == "" {
+		t.Errorf("OnRotate was not called with the new credentials, got: %+v", rotatedTo)
+	}
+
+	// The Client keeps working with the new credentials.
+	if _, _, err := c.Identity.SelfGetCredentials(context.Background()); err != nil {
+		t.Errorf("the client does not use the new credentials: %v", err)
+	}
+}
+
+func TestCredentialRotator_RegionChange(t *testing.T) {
+	server := newFakeCredentialsServer(t, time.Now().Add(time.Hour))
+	server.prefix = "vera01ei-"
+
+	target, _ := url.Parse(server.URL)
+
+	// Send the requests for every region to the test server, while keeping the Host header of the region.
+	httpClient := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		req.Host = req.URL.Host
+		req.URL.Scheme, req.URL.Host = target.Scheme, target.Host
+		return http.DefaultTransport.RoundTrip(req)
+	})}
+
+	c, err := New(testApiKey, testApiSecret, WithHTTPClient(httpClient), WithRetryPolicy(NoRetryPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newRequest := func(path string) *http.Request {
+		req, err := c.NewRequest(context.Background(), path, http.MethodGet, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+
+	// A call that is in flight when the rotation starts, so that the rotator has to wait for it.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := c.Do(newRequest("/api/authn/v2/api_credentials?slow=1"), nil)
+		errs <- err
+	}()
+	<-server.arrived
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := NewCredentialRotator(c, RotatorOptions{}).Rotate(context.Background())
+		errs <- err
+	}()
+
+	for {
+		c.credentialsGate.mu.Lock()
+		pending := c.credentialsGate.pending != nil
+		c.credentialsGate.mu.Unlock()
+
+		if pending {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A call that is built for the old region and held back during the rotation is sent to the new region.
+	held := newRequest("/api/authn/v2/api_credentials?held=1")
+	if held.URL.Host != "api.veracode.com" {
+		t.Fatalf("the held back call was built for %s", held.URL.Host)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := c.Do(held, nil)
+		errs <- err
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	close(server.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, _, err := c.Identity.SelfGetCredentials(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The current credentials, the slow call and the generation go to the old region, the held back call and the
+	// call after the rotation go to the new region.
+	want := "api.veracode.com,api.veracode.com,api.veracode.com,api.veracode.eu,api.veracode.eu"
+	if hosts := server.hosts; strings.Join(hosts, ",") != want {
+		t.Errorf("got requests to %v, expected %s", hosts, want)
+	}
+}
+
+func TestCredentialRotator_WaitsForCallsInFlight(t *testing.T) {
+	server := newFakeCredentialsServer(t, time.Now().Add(time.Hour))
+
+	c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithRetryPolicy(NoRetryPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string) error {
+		req, err := c.NewRequest(context.Background(), path, http.MethodGet, nil)
+		if err != nil {
+			return err
+		}
+		_, err = c.Do(req, nil)
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+
+	// A call that is in flight when the rotation starts.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		errs <- get("/api/authn/v2/api_credentials?slow=1")
+	}()
+	<-server.arrived
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := NewCredentialRotator(c, RotatorOptions{}).Rotate(context.Background())
+		errs <- err
+	}()
+
+	// Wait until the rotator holds back new calls.
+	for {
+		c.credentialsGate.mu.Lock()
+		pending := c.credentialsGate.pending != nil
+		c.credentialsGate.mu.Unlock()
+
+		if pending {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A call that starts during the rotation.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		errs <- get("/api/authn/v2/api_credentials")
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+
+	server.mu.Lock()
+	generated := server.generated
+	server.mu.Unlock()
+
+	if generated != 0 {
+		t.Error("the credentials were rotated while a call was in flight")
+	}
+
+	close(server.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	if server.generated != 1 {
+		t.Errorf("generated %d credentials, expected 1", server.generated)
+	}
+}
+
+func TestCredentialRotator_SwitchError(t *testing.T) {
+	server := newFakeCredentialsServer(t, time.Now().Add(time.Hour))
+	server.prefix = "vera01xi-" // The new API key does not map to a known region.
+
+	target, _ := url.Parse(server.URL)
+
+	httpClient := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		req.URL.Scheme, req.URL.Host = target.Scheme, target.Host
+		return http.DefaultTransport.RoundTrip(req)
+	})}
+
+	c, err := New(testApiKey, testApiSecret, WithHTTPClient(httpClient), WithRetryPolicy(NoRetryPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var saved []Credentials
+	rotator := NewCredentialRotator(c, RotatorOptions{
+		LeadTime: 24 * time.Hour,
+		Sink: CredentialsSinkFunc(func(ctx context.Context, creds Credentials) error {
+			saved = append(saved, creds)
+			return nil
+		}),
+		OnRotate: func(old, new APICredentials) { t.Error("OnRotate was called for a failed rotation") },
+	})
+
+	rotated, err := rotator.RotateIfNeeded(context.Background())
+	if rotated || !errors.Is(err, ErrUnknownRegion) || !strings.Contains(err.Error(), server.apiID) {
+		t.Fatalf("RotateIfNeeded returned %t, %v, expected a failed rotation with the new API key ID", rotated, err)
+	}
+
+	// The new credentials are persisted, so that they can be recovered.
+	if len(saved) != 1 || saved[0].APIKeyID != server.apiID {
+		t.Errorf("unexpected saved credentials: %+v", saved)
+	}
+}
+
+func TestCredentialRotator_Run(t *testing.T) {
+	server := newFakeCredentialsServer(t, time.Now().Add(time.Hour))
+
+	c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithRetryPolicy(NoRetryPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	rotator := NewCredentialRotator(c, RotatorOptions{
+		OnRotate: func(old, new APICredentials) { cancel() },
+	})
+
+	go func() { done <- rotator.Run(ctx) }()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Run returned %v, expected context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the credentials were not rotated")
+	}
+
+	if server.generated != 1 {
+		t.Errorf("generated %d credentials, expected 1", server.generated)
+	}
+}
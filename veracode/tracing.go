@@ -0,0 +1,93 @@
+package veracode
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// Attribute is a key-value pair that is attached to a Span.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Attr returns a new Attribute.
+func Attr(key string, value any) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Span is a single traced operation. See [Tracer].
+type Span interface {
+	// SetAttributes adds attributes to the span.
+	SetAttributes(attrs ...Attribute)
+
+	// RecordError marks the span as failed with err.
+	RecordError(err error)
+
+	// End completes the span. No methods should be called on the span after End.
+	End()
+}
+
+// Tracer creates spans for the operations of the Client. It is a minimal abstraction that can be bridged to a
+// tracing library such as OpenTelemetry, without this library depending on it. See [WithTracer].
+//
+// The Client creates a span for every call to [Client.Do] and parent spans for higher-level operations that make
+// multiple calls, such as [IdentityService.ListAllUsers] and [UploadXMLService.WaitForBuild].
+type Tracer interface {
+	// StartSpan starts a new span as a child of the span in ctx (if any) and returns a context that contains the new span.
+	StartSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// WithTracer sets the Tracer that the Client uses. By default, no spans are created.
+func WithTracer(tracer Tracer) ClientOption {
+	return func(cfg *clientConfig) error {
+		if tracer == nil {
+			tracer = noopTracer{}
+		}
+
+		cfg.tracer = tracer
+		return nil
+	}
+}
+
+type noopTracer struct{}
+
+func (noopTracer) StartSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(attrs ...Attribute) {}
+func (noopSpan) RecordError(err error)            {}
+func (noopSpan) End()                             {}
+
+// serviceName returns the service part of a logical endpoint name. For example: "Identity.ListUsers" returns "Identity".
+func serviceName(endpoint string) string {
+	service, _, _ := strings.Cut(endpoint, ".")
+	return service
+}
+
+// endCallSpan adds the outcome of a call to Client.Do to span and ends it.
+func endCallSpan(span Span, resp *Response, err error) {
+	defer span.End()
+
+	span.SetAttributes(Attr("veracode.attempts", resp.Attempts))
+
+	if resp.Response != nil {
+		span.SetAttributes(Attr("http.response.status_code", resp.StatusCode))
+	}
+
+	if err != nil {
+		var verr Error
+		if errors.As(err, &verr) {
+			span.SetAttributes(
+				Attr("veracode.error.code", verr.Code),
+				Attr("veracode.error.messages", verr.Messages),
+			)
+		}
+
+		span.RecordError(err)
+	}
+}
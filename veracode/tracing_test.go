@@ -0,0 +1,103 @@
+package veracode
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// recordingTracer records the spans that were started, with the name of their parent span.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+type recordingSpan struct {
+	name   string
+	parent string
+	attrs  map[string]any
+	err    error
+	ended  bool
+}
+
+type spanKey struct{}
+
+func (t *recordingTracer) StartSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	s := &recordingSpan{name: name, attrs: make(map[string]any)}
+	if parent, ok := ctx.Value(spanKey{}).(*recordingSpan); ok {
+		s.parent = parent.name
+	}
+	s.SetAttributes(attrs...)
+
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	t.mu.Unlock()
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (s *recordingSpan) SetAttributes(attrs ...Attribute) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *recordingSpan) RecordError(err error) { s.err = err }
+func (s *recordingSpan) End()                  { s.ended = true }
+
+func TestIdentityService_ListAllUsers_Spans(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"_embedded":{"users":[{"user_name":"user-%s"}]},"page":{"number":%s,"size":1,"total_elements":2,"total_pages":2}}`, page, page)
+	}))
+	defer server.Close()
+
+	tracer := &recordingTracer{}
+
+	c, err := New(testApiKey, testApiSecret, WithBaseURLs(server.URL, server.URL), WithTracer(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users, _, err := c.Identity.ListAllUsers(context.Background(), ListUserOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, user := range users {
+		names = append(names, user.UserName)
+	}
+	if want := []string{"user-0", "user-1"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("IdentityService.ListAllUsers() = %v, want %v", names, want)
+	}
+
+	if len(tracer.spans) != 3 {
+		t.Fatalf("%d spans were started, want 3", len(tracer.spans))
+	}
+
+	parent := tracer.spans[0]
+	if parent.name != "Identity.ListAllUsers" || parent.attrs["veracode.pages"] != 2 {
+		t.Errorf("parent span = %s with attributes %v, want Identity.ListAllUsers with 2 pages", parent.name, parent.attrs)
+	}
+
+	for _, span := range tracer.spans[1:] {
+		if span.name != "Identity.ListUsers" || span.parent != "Identity.ListAllUsers" {
+			t.Errorf("span = %s with parent %s, want Identity.ListUsers with parent Identity.ListAllUsers", span.name, span.parent)
+		}
+		if span.attrs["veracode.service"] != "Identity" || span.attrs["http.response.status_code"] != http.StatusOK {
+			t.Errorf("span attributes = %v, want service Identity and status 200", span.attrs)
+		}
+	}
+
+	for _, span := range tracer.spans {
+		if !span.ended {
+			t.Errorf("span %s was not ended", span.name)
+		}
+	}
+}
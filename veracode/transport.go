@@ -1,42 +1,309 @@
 package veracode
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/DanCreative/veracode-go/hmac"
-	"golang.org/x/time/rate"
 )
 
 // veracodeTransport implements the http.RoundTripper interface and
 // wraps either a provided http.RoundTripper or the http.DefaultTransport.
 //
-// veracodeTransport is responsible for client-side rate limiting as well as
-// adding the Veracode HMAC Hash message to the Authorization header.
+// veracodeTransport is responsible for client-side rate and concurrency limiting per host, retrying transient
+// failures as well as adding the Veracode HMAC Hash message to the Authorization header.
 type veracodeTransport struct {
-	r1        *rate.Limiter
-	Key       string
-	Secret    string
-	Transport http.RoundTripper
+	budgets     *hostBudgets
+	credentials atomic.Pointer[credentialsSource]
+	signers     signerCache
+	Transport   http.RoundTripper
+	retryPolicy atomic.Pointer[RetryPolicy]
+	logger      *slog.Logger
+	bodyLog     *bodyLogger
+	metrics     MetricsCollector
+	breaker     *circuitBreaker // Nil if the circuit breaker is disabled.
+}
+
+// callInfo carries the state of a single Client.Do call between the Client and the veracodeTransport.
+type callInfo struct {
+	attempts  int  // Number of attempts made by the transport.
+	cached    bool // Whether the response was served from the cache.
+	coalesced bool // Whether the response was shared with an identical request that was in flight.
+}
+
+type callInfoKey struct{}
+
+// withCallInfo returns a copy of ctx that carries info.
+func withCallInfo(ctx context.Context, info *callInfo) context.Context {
+	return context.WithValue(ctx, callInfoKey{}, info)
+}
+
+// callInfoFromContext returns the callInfo stored in ctx or nil if there is none.
+func callInfoFromContext(ctx context.Context) *callInfo {
+	info, _ := ctx.Value(callInfoKey{}).(*callInfo)
+	return info
 }
 
 // RoundTrip is required to implement the http.RoundTripper interface.
+//
+// RoundTrip retries the request according to the transport's RetryPolicy. Every attempt is signed with a fresh
+// HMAC Authorization header and waits for the rate limiter.
 func (v *veracodeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	// Add the HMAC Hash message to the Authorization header
-	bearer, err := hmac.CalculateAuthorizationHeader(req.URL, req.Method, v.Key, v.Secret)
+	info := callInfoFromContext(req.Context())
+	policy := v.retryPolicy.Load()
+
+	for attempt := 1; ; attempt++ {
+		if info != nil {
+			info.attempts = attempt
+		}
+
+		resp, err := v.roundTrip(req, attempt)
+		if attempt >= policy.MaxAttempts || !policy.shouldRetry(req, resp, err) {
+			return resp, err
+		}
+
+		delay, ok := policy.delay(attempt, resp)
+		if !ok {
+			return resp, err
+		}
+
+		v.logRetry(req, attempt, resp, err, delay)
+
+		discardResponse(resp)
+
+		if err := sleepContext(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// roundTrip sends a single attempt of req.
+//
+// The request is cloned, so that the Authorization header of a previous attempt is replaced instead of added to.
+func (v *veracodeTransport) roundTrip(req *http.Request, attempt int) (*http.Response, error) {
+	r := req.Clone(req.Context())
+
+	if attempt > 1 && req.Body != nil && req.Body != http.NoBody {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = body
+	}
+
+	if err := v.breaker.allow(r.Context()); err != nil {
+		v.observe(r, nil, err, 0, 0)
+		return nil, err
+	}
+
+	// Wait for a free slot and the limiter of the host.
+	budget := v.budgets.get(v.apiKeyID(r.Context()), r.URL.Host)
+
+	waitStart := time.Now()
+	if err := budget.acquire(r.Context()); err != nil {
+		v.observe(r, nil, err, 0, time.Since(waitStart))
+		return nil, err
+	}
+
+	if err := budget.limiter.Wait(r.Context()); err != nil {
+		budget.release()
+		v.observe(r, nil, err, 0, time.Since(waitStart))
+		return nil, err
+	}
+	wait := time.Since(waitStart)
+
+	// Add the HMAC Hash message to the Authorization header. The header is calculated after waiting for the limiter,
+	// so that the timestamp in the signature is as recent as possible.
+	signer, err := v.signerFor(r.Context())
+	if err != nil {
+		budget.release()
+		v.observe(r, nil, err, 0, wait)
+		return nil, err
+	}
+
+	bearer, err := signer.AuthorizationHeader(r.URL, r.Method)
+	if err != nil {
+		budget.release()
+		v.observe(r, nil, err, 0, wait)
+		return nil, err
+	}
+
+	r.Header.Set("Authorization", bearer)
+
+	v.bodyLog.logRequest(r, attempt)
+
+	start := time.Now()
+	resp, err := v.transport().RoundTrip(r)
+
+	budget.limiter.Observe(resp)
+	v.breaker.record(r.Context(), resp, err)
+
+	// The request stays in flight until its response body is closed.
+	if resp != nil && resp.Body != nil {
+		resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: budget.release}
+	} else {
+		budget.release()
+	}
+
+	v.observe(r, resp, err, time.Since(start), wait)
+
+	return resp, err
+}
+
+// observe reports the metric of an attempt to the MetricsCollector, if there is one.
+func (v *veracodeTransport) observe(r *http.Request, resp *http.Response, err error, latency, wait time.Duration) {
+	if v.metrics == nil {
+		return
+	}
+
+	v.metrics.ObserveRequest(RequestMetric{
+		Endpoint:      endpointTemplate(r.URL.Path),
+		Method:        r.Method,
+		StatusClass:   statusClass(resp, err),
+		Latency:       latency,
+		RateLimitWait: wait,
+	})
+}
+
+// logRetry logs that attempt of req failed and will be retried after delay.
+func (v *veracodeTransport) logRetry(req *http.Request, attempt int, resp *http.Response, err error, delay time.Duration) {
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("endpoint", EndpointName(req.Context())),
+		slog.String("path", req.URL.Path),
+		slog.Int("attempt", attempt),
+		slog.Duration("delay", delay),
+	}
+
+	if resp != nil {
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	}
+
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+
+	v.logger.LogAttrs(req.Context(), slog.LevelWarn, "retrying veracode api request", attrs...)
+}
+
+// credentialsSource wraps the CredentialsProvider of a veracodeTransport, so that it can be replaced atomically.
+type credentialsSource struct {
+	provider CredentialsProvider
+}
+
+// maxCachedSigners is the maximum number of hmac.Signers that a veracodeTransport keeps.
+const maxCachedSigners = 32
+
+// signerCache holds the hmac.Signers of the most recently used credentials, so that requests that alternate between
+// credentials, for example of different tenants using [WithCredentials], do not parse the credentials every time.
+type signerCache struct {
+	mu      sync.Mutex
+	signers map[signerKey]*hmac.Signer
+}
+
+type signerKey struct {
+	apiKeyID     string
+	apiKeySecret string
+}
+
+// get returns the hmac.Signer of creds, creating it if it is not cached.
+func (c *signerCache) get(creds Credentials) (*hmac.Signer, error) {
+	key := signerKey{apiKeyID: creds.APIKeyID, apiKeySecret: creds.APIKeySecret}
+
+	c.mu.Lock()
+	signer, ok := c.signers[key]
+	c.mu.Unlock()
+
+	if ok {
+		return signer, nil
+	}
+
+	signer, err := hmac.NewSigner(creds.APIKeyID, creds.APIKeySecret)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Add("Authorization", bearer)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.signers == nil {
+		c.signers = make(map[signerKey]*hmac.Signer)
+	}
+
+	// Evict an arbitrary signer once the cache is full. Rotated credentials are not used again.
+	if len(c.signers) >= maxCachedSigners {
+		for k := range c.signers {
+			delete(c.signers, k)
+			break
+		}
+	}
+
+	c.signers[key] = signer
+	return signer, nil
+}
+
+// setCredentialsProvider replaces the CredentialsProvider used for requests that start after the call.
+func (v *veracodeTransport) setCredentialsProvider(provider CredentialsProvider) {
+	v.credentials.Store(&credentialsSource{provider: provider})
+}
+
+// credentialsFor returns the credentials that requests made with ctx are signed with. Those are the credentials set
+// on ctx using [WithCredentials] or, if there are none, the credentials returned by the CredentialsProvider.
+func (v *veracodeTransport) credentialsFor(ctx context.Context) (Credentials, error) {
+	if creds, ok := credentialsFromContext(ctx); ok {
+		return creds, nil
+	}
+
+	creds, err := v.credentials.Load().provider.Credentials(ctx)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("could not get Veracode API credentials: %w", err)
+	}
+	return creds, nil
+}
+
+// withCredentials returns a copy of ctx that carries a snapshot of the credentials for ctx, so that every layer of
+// the transport chain uses the same credentials for a request, even if they are rotated while it is in flight.
+func (v *veracodeTransport) withCredentials(ctx context.Context) (context.Context, error) {
+	if _, ok := credentialsFromContext(ctx); ok {
+		return ctx, nil
+	}
 
-	// Wait for the limiter.
-	err = v.r1.Wait(req.Context())
+	creds, err := v.credentialsFor(ctx)
 	if err != nil {
 		return nil, err
 	}
+	return WithCredentials(ctx, creds), nil
+}
+
+// signerFor returns the hmac.Signer for the credentials of ctx. The Signers of recently used credentials are reused,
+// so that the credentials are not parsed for every request.
+func (v *veracodeTransport) signerFor(ctx context.Context) (*hmac.Signer, error) {
+	creds, err := v.credentialsFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.signers.get(creds)
+}
+
+// apiKeyID returns the ID of the API key that requests made with ctx are signed with, or an empty string if the
+// credentials cannot be retrieved.
+func (v *veracodeTransport) apiKeyID(ctx context.Context) string {
+	creds, _ := v.credentialsFor(ctx)
+	return creds.APIKeyID
+}
 
-	return v.transport().RoundTrip(req)
+// setRetryPolicy replaces the RetryPolicy used for requests that start after the call. The RetryStatusCodes are
+// copied, so that later changes to the caller's policy do not affect the transport.
+func (v *veracodeTransport) setRetryPolicy(policy RetryPolicy) {
+	policy.RetryStatusCodes = slices.Clone(policy.RetryStatusCodes)
+	v.retryPolicy.Store(&policy)
 }
 
 // transport checks if a custom http.RoundTripper was provided and returns it if it was and the http.DefaultTransport if it wasn't.
@@ -53,11 +320,18 @@ func (v *veracodeTransport) Client() *http.Client {
 }
 
 // newTransport returns a new veracodeTransport.
-func newTransport(rt http.RoundTripper, key, secret string, period time.Duration, burst int) *veracodeTransport {
-	return &veracodeTransport{
+func newTransport(rt http.RoundTripper, provider CredentialsProvider, budgets *hostBudgets) *veracodeTransport {
+	logger := slog.New(slog.DiscardHandler)
+
+	v := &veracodeTransport{
 		Transport: rt,
-		r1:        rate.NewLimiter(rate.Every(period), burst),
-		Key:       key,
-		Secret:    secret,
+		budgets:   budgets,
+		logger:    logger,
+		bodyLog:   newBodyLogger(logger, LogOptions{}),
 	}
+
+	v.setRetryPolicy(DefaultRetryPolicy)
+	v.setCredentialsProvider(provider)
+
+	return v
 }
@@ -261,6 +261,15 @@ func (i *IdentityService) ListUsers(ctx context.Context, options ListUserOptions
 	return usersResult.Embedded.Users, resp, err
 }
 
+// ListAllUsers pages through ListUsers, starting at options.Page, and returns the users on all of the pages.
+//
+// The returned Response is the Response of the last page.
+func (i *IdentityService) ListAllUsers(ctx context.Context, options ListUserOptions) ([]User, *Response, error) {
+	return listAll(ctx, i.Client, "Identity.ListAllUsers", &options.Page, func(ctx context.Context) ([]User, *Response, error) {
+		return i.ListUsers(ctx, options)
+	})
+}
+
 // SearchUsers takes a SearchUserOptions and returns a list of users.
 //
 // Veracode API documentation: https://docs.veracode.com/r/c_identity_search_users.
@@ -280,6 +289,15 @@ func (i *IdentityService) SearchUsers(ctx context.Context, options SearchUserOpt
 	return usersResult.Embedded.Users, resp, err
 }
 
+// SearchAllUsers pages through SearchUsers, starting at options.Page, and returns the users on all of the pages.
+//
+// The returned Response is the Response of the last page.
+func (i *IdentityService) SearchAllUsers(ctx context.Context, options SearchUserOptions) ([]User, *Response, error) {
+	return listAll(ctx, i.Client, "Identity.SearchAllUsers", &options.Page, func(ctx context.Context) ([]User, *Response, error) {
+		return i.SearchUsers(ctx, options)
+	})
+}
+
 // UpdateUser updates a specific user and sets nulls to fields not in the request (if the database allows it) unless partial is set to true.
 // If incremental is set to true, any values in the roles or teams list will be added to the user's roles/teams instead of replacing them.
 //
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strings"
@@ -19,6 +20,21 @@ type Client struct {
 	baseXmlURL  *url.URL
 	rwMu        sync.RWMutex
 	HttpClient  *http.Client
+	transport   *veracodeTransport
+	userAgent   string
+	hooks       []Hooks
+	logger      *slog.Logger
+	bodyLog     *bodyLogger
+	tracer      Tracer
+	dryRun      *dryRunTransport // Set if the Client is in dry-run mode. See [WithDryRun].
+
+	// credentialsGate holds back new calls while a CredentialRotator switches the credentials.
+	credentialsGate credentialsGate
+
+	// Overrides set using the ClientOptions. If set, they take precedence over the values derived from the API key.
+	regionOverride  *Region
+	restURLOverride *url.URL
+	xmlURLOverride  *url.URL
 
 	// Services used for talking to the different parts of the Veracode API
 	common service
@@ -32,8 +48,12 @@ type Client struct {
 
 type Response struct {
 	*http.Response
-	Page  PageMeta
-	Links NavLinks
+	Page      PageMeta
+	Links     NavLinks
+	Attempts  int    // Number of attempts the transport made before returning the response. See [RetryPolicy].
+	Endpoint  string // Logical name of the endpoint, for example "Identity.ListUsers". See [EndpointName].
+	Cached    bool   // Whether the response was served from the cache, possibly after revalidation. See [WithCache].
+	Coalesced bool   // Whether the response was shared with an identical request that was in flight. See [WithCoalescing].
 }
 
 // Any struct that is used to unmarshal a collection of entities, needs to implement the CollectionResult interface in order for the page meta and navigational links
@@ -43,21 +63,92 @@ type CollectionResult interface {
 	GetPageMeta() PageMeta
 }
 
+// NewClient returns a new Client that uses the provided http.Client to send requests.
+//
+// NewClient is a shorthand for calling [New] with [WithHTTPClient]. Use [New] to configure the Client further.
 func NewClient(httpClient *http.Client, apiKey, apiSecret string) (*Client, error) {
-	if httpClient == nil {
-		httpClient = &http.Client{}
+	return New(apiKey, apiSecret, WithHTTPClient(httpClient))
+}
+
+// New returns a new Client for the provided API credentials, configured with the provided options.
+//
+// By default, the region is derived from the API key, requests are sent using an http.Client with the
+// http.DefaultTransport, requests are rate limited to a burst of 500 requests that refills one request per minute
+// and transient errors are retried using the [DefaultRetryPolicy].
+func New(apiKey, apiSecret string, opts ...ClientOption) (*Client, error) {
+	cfg := defaultClientConfig()
+	for _, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return nil, err
+		}
 	}
 
-	// Wrap the transport provided in the http.Client with the veracodeTransport (which will handle rate limiting and authentication)
-	httpClient.Transport = newTransport(httpClient.Transport, apiKey, apiSecret, time.Minute*1, 500)
+	// Copy the provided http.Client, so that the caller's http.Client is not modified.
+	httpClient := &http.Client{}
+	if cfg.httpClient != nil {
+		*httpClient = *cfg.httpClient
+	}
 
-	region, err := GetRegionFromCredentials(apiKey)
-	if err != nil {
-		return nil, err
+	rt := httpClient.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	for i := len(cfg.middleware) - 1; i >= 0; i-- {
+		rt = cfg.middleware[i](rt)
+	}
+
+	// Wrap the transport chain with the veracodeTransport (which will handle rate limiting, retries and authentication)
+	bodyLog := newBodyLogger(cfg.logger, cfg.logOptions)
+
+	provider := cfg.credentials
+	if provider == nil {
+		provider = staticCredentials(apiKey, apiSecret)
+	} else if apiKey == "" && cfg.region == nil && (cfg.restURL == nil || cfg.xmlURL == nil) {
+		// The region is derived from the API key, so the provider is asked for its credentials up front.
+		creds, err := provider.Credentials(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("could not get Veracode API credentials: %w", err)
+		}
+		apiKey = creds.APIKeyID
+	}
+
+	transport := newTransport(rt, provider, newHostBudgets(cfg))
+	transport.setRetryPolicy(cfg.retryPolicy)
+	transport.logger, transport.bodyLog = cfg.logger, bodyLog
+	transport.metrics = cfg.metrics
+	httpClient.Transport = transport
+
+	if cfg.coalesce {
+		httpClient.Transport = newCoalesceTransport(httpClient.Transport, transport.apiKeyID, cfg.metrics)
+	}
+
+	if cfg.cache != nil {
+		httpClient.Transport = newCacheTransport(httpClient.Transport, transport.apiKeyID, *cfg.cache)
+	}
+
+	if cfg.dryRun != nil {
+		cfg.dryRun.next, cfg.dryRun.bodyLog = httpClient.Transport, bodyLog
+		httpClient.Transport = cfg.dryRun
 	}
 
 	c := &Client{
-		HttpClient: httpClient,
+		HttpClient:      httpClient,
+		transport:       transport,
+		userAgent:       cfg.userAgent,
+		hooks:           cfg.hooks,
+		logger:          cfg.logger,
+		bodyLog:         bodyLog,
+		tracer:          cfg.tracer,
+		dryRun:          cfg.dryRun,
+		regionOverride:  cfg.region,
+		restURLOverride: cfg.restURL,
+		xmlURLOverride:  cfg.xmlURL,
+	}
+
+	region, err := c.regionFor(apiKey)
+	if err != nil {
+		return nil, err
 	}
 
 	setBaseURLs(c, region)
@@ -69,66 +160,237 @@ func NewClient(httpClient *http.Client, apiKey, apiSecret string) (*Client, erro
 	c.Healthcheck = (*HealthCheckService)(&c.common)
 	c.UploadXML = (*UploadXMLService)(&c.common)
 
+	if cfg.circuitBreaker != nil {
+		transport.breaker = &circuitBreaker{
+			opts: *cfg.circuitBreaker,
+			probe: func(ctx context.Context) error {
+				resp, err := c.Healthcheck.GetStatus(ctx)
+				if err == nil && resp.StatusCode != http.StatusOK {
+					err = fmt.Errorf("healthcheck returned status: %d", resp.StatusCode)
+				}
+				return err
+			},
+			onChange: c.circuitStateChanged,
+		}
+	}
+
 	return c, nil
 }
 
-func setBaseURLs(c *Client, r Region) {
-	for _, apiType := range []string{"rest", "xml"} {
-		baseEndpoint, _ := url.Parse(r[apiType])
+// regionFor returns the region that the Client should use for apiKey. If the region was set using [WithRegion],
+// that region is returned instead.
+//
+// If both base URLs were set using [WithBaseURLs], the region is not used and an API key that does not map to a
+// region is allowed.
+func (c *Client) regionFor(apiKey string) (Region, error) {
+	if c.regionOverride != nil {
+		return *c.regionOverride, nil
+	}
 
-		if !strings.HasSuffix(baseEndpoint.Path, "/") {
-			baseEndpoint.Path += "/"
-		}
+	region, err := GetRegionFromCredentials(apiKey)
+	if err != nil && c.restURLOverride != nil && c.xmlURLOverride != nil {
+		return Region{}, nil
+	}
 
-		switch apiType {
-		case "rest":
-			c.baseRestURL = baseEndpoint
-		case "xml":
-			c.baseXmlURL = baseEndpoint
+	return region, err
+}
+
+// setBaseURLs sets the base URLs of the Client to those of the provided region.
+// Base URLs that were set using [WithBaseURLs], [WithRestBaseURL] or [WithXMLBaseURL] are kept.
+func setBaseURLs(c *Client, r Region) {
+	baseURL := func(rawURL string, override *url.URL) *url.URL {
+		if override != nil {
+			return withTrailingSlash(override)
 		}
+		u, _ := url.Parse(rawURL)
+		return withTrailingSlash(u)
+	}
+
+	c.baseRestURL = baseURL(r.Rest, c.restURLOverride)
+	c.baseXmlURL = baseURL(r.XML, c.xmlURLOverride)
+}
+
+// withTrailingSlash returns a copy of u whose path ends with a "/".
+func withTrailingSlash(u *url.URL) *url.URL {
+	r := *u
+	if !strings.HasSuffix(r.Path, "/") {
+		r.Path += "/"
 	}
+	return &r
 }
 
 // NewRequest is a helper method that creates a new request using the [Client]'s settings.
 //
 // By default, NewRequest will set the base URL to the REST variant, the caller can optionally provide shouldUseXML
 // to switch to the XML base URL.
+//
+// The endpoint path is resolved relative to the path of the base URL, even if it starts with a "/". For example, if the
+// base URL is "http://localhost:8080/veracode", the endpoint "/api/authn/v2/users" resolves to
+// "http://localhost:8080/veracode/api/authn/v2/users".
+//
+// The logical endpoint name (see [EndpointName]) is derived from the method that calls NewRequest, unless it was set
+// on ctx using [WithEndpointName].
 func (c *Client) NewRequest(ctx context.Context, endpoint string, method string, body io.Reader, shouldUseXML ...bool) (*http.Request, error) {
+	if EndpointName(ctx) == "" {
+		ctx = WithEndpointName(ctx, callerEndpointName(1))
+	}
+
 	urlEndpoint, err := url.Parse(endpoint)
 	if err != nil {
 		return nil, err
 	}
 
+	// Strip the leading "/" of the path, so that the path of the base URL is not replaced by the endpoint path.
+	if !urlEndpoint.IsAbs() && urlEndpoint.Host == "" {
+		urlEndpoint.Path = strings.TrimLeft(urlEndpoint.Path, "/")
+		urlEndpoint.RawPath = strings.TrimLeft(urlEndpoint.RawPath, "/")
+	}
+
 	c.rwMu.RLock()
 	defer c.rwMu.RUnlock()
 
-	var url *url.URL
-
+	base := requestBase{url: c.baseRestURL}
 	if len(shouldUseXML) > 0 && shouldUseXML[0] {
-		url = c.baseXmlURL.ResolveReference(urlEndpoint)
-	} else {
-		url = c.baseRestURL.ResolveReference(urlEndpoint)
+		base = requestBase{url: c.baseXmlURL, xml: true}
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, url.String(), body)
+	url := base.url.ResolveReference(urlEndpoint)
+
+	req, err := http.NewRequestWithContext(context.WithValue(ctx, requestBaseKey{}, base), method, url.String(), body)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Add("Content-Type", "application/json")
 
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
 	return req, err
 }
 
+// requestBase is the base URL that NewRequest built a request with.
+type requestBase struct {
+	url *url.URL
+	xml bool
+}
+
+type requestBaseKey struct{}
+
+// rebase returns req with its URL moved to the current base URL of the Client, if req was built by NewRequest with a
+// base URL that has changed since, for example because a CredentialRotator switched to an API key of another region
+// while the call was held back.
+func (c *Client) rebase(req *http.Request) *http.Request {
+	base, ok := req.Context().Value(requestBaseKey{}).(requestBase)
+	if !ok {
+		return req
+	}
+
+	c.rwMu.RLock()
+	current := c.baseRestURL
+	if base.xml {
+		current = c.baseXmlURL
+	}
+	c.rwMu.RUnlock()
+
+	if *current == *base.url || req.URL.Scheme != base.url.Scheme || req.URL.Host != base.url.Host ||
+		!strings.HasPrefix(req.URL.Path, base.url.Path) {
+		return req
+	}
+
+	u := *req.URL
+	u.Scheme, u.Host = current.Scheme, current.Host
+	u.Path = current.Path + strings.TrimPrefix(req.URL.Path, base.url.Path)
+	if req.URL.RawPath != "" {
+		u.RawPath = current.EscapedPath() + strings.TrimPrefix(req.URL.RawPath, base.url.EscapedPath())
+	}
+
+	r := req.Clone(req.Context())
+	r.URL, r.Host = &u, u.Host
+	return r
+}
+
 // Do is a helper method that executes the provided http.Request and marshals the JSON response body
 // into either the provided any object or into an error if an error occurred.
+//
+// The returned Response reports the number of attempts that were made. See [RetryPolicy].
+//
+// The hooks registered on the Client are called before the request is sent and after the response has been decoded.
+// See [Hooks].
 func (c *Client) Do(req *http.Request, body any) (*Response, error) {
+	c.rwMu.RLock()
+	hooks := c.hooks
+	c.rwMu.RUnlock()
+
+	for _, h := range hooks {
+		if h.BeforeRequest != nil {
+			h.BeforeRequest(req)
+		}
+	}
+
+	endpoint := EndpointName(req.Context())
+	spanName := endpoint
+	if spanName == "" {
+		spanName = req.Method + " " + req.URL.Path
+	}
+
+	ctx, span := c.tracer.StartSpan(req.Context(), spanName,
+		Attr("veracode.service", serviceName(endpoint)),
+		Attr("veracode.endpoint", endpoint),
+		Attr("http.request.method", req.Method),
+		Attr("url.path", req.URL.Path),
+	)
+	req = req.WithContext(ctx)
+
+	info := &callInfo{}
+	start := time.Now()
+
+	r, err := c.do(req.WithContext(withCallInfo(ctx, info)), body)
+	duration := time.Since(start)
+
+	r.Attempts = info.attempts
+	r.Endpoint = endpoint
+	r.Cached = info.cached
+	r.Coalesced = info.coalesced
+
+	endCallSpan(span, r, err)
+	logCall(c.logger, req, r, err, duration)
+
+	for _, h := range hooks {
+		if h.AfterResponse != nil {
+			h.AfterResponse(r, err, duration)
+		}
+	}
+
+	return r, err
+}
+
+// do executes the request and decodes the response body.
+func (c *Client) do(req *http.Request, body any) (*Response, error) {
+	ctx, leave, err := c.credentialsGate.enter(req.Context())
+	if err != nil {
+		return newResponse(nil, nil), err
+	}
+
+	// Take a snapshot of the credentials, so that the cache, coalescing and signing all use the same credentials.
+	ctx, err = c.transport.withCredentials(ctx)
+	if err != nil {
+		leave()
+		return newResponse(nil, nil), err
+	}
+
+	// The call leaves the gate once the API has responded, because the credentials are not needed afterwards.
+	req = c.rebase(req.WithContext(ctx))
 	resp, err := c.HttpClient.Do(req)
+	leave()
 	if err != nil {
 		return newResponse(resp, nil), err
 	}
 	defer resp.Body.Close()
 
+	c.bodyLog.logResponse(req, resp)
+
 	contentType := resp.Header.Get("Content-Type")
 
 	if body != nil {
@@ -209,19 +471,28 @@ func doXml(resp *http.Response, body any) (*Response, error) {
 	return newResponse(resp, nil), nil
 }
 
+// SetRetryPolicy replaces the RetryPolicy that the Client uses for all subsequent requests.
+//
+// Use [NoRetryPolicy] to disable retries.
+func (c *Client) SetRetryPolicy(policy RetryPolicy) {
+	c.transport.setRetryPolicy(policy)
+}
+
 // UpdateCredentials is a method that allows the caller to update the credentials for the client
 // after it has been initialized.
+//
+// It is safe to call UpdateCredentials while requests are in flight. Those requests keep using the previous
+// credentials. The credentials replace the CredentialsProvider set using [WithCredentialsProvider].
 func (c *Client) UpdateCredentials(apiKey, apiSecret string) error {
 	c.rwMu.Lock()
 	defer c.rwMu.Unlock()
 
-	region, err := GetRegionFromCredentials(apiKey)
+	region, err := c.regionFor(apiKey)
 	if err != nil {
 		return err
 	}
 
-	v := c.HttpClient.Transport.(*veracodeTransport)
-	v.Key, v.Secret = apiKey, apiSecret
+	c.transport.setCredentialsProvider(staticCredentials(apiKey, apiSecret))
 
 	setBaseURLs(c, region)
 
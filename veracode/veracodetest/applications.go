@@ -0,0 +1,611 @@
+package veracodetest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DanCreative/veracode-go/veracode"
+)
+
+const (
+	applicationsPath = "/appsec/v1"
+
+	// organizationID is the ID of the organization of the Server.
+	organizationID = 10000
+)
+
+func (s *Server) routeApplications() {
+	s.mux.HandleFunc("GET "+applicationsPath+"/applications", s.listApplications)
+	s.mux.HandleFunc("GET "+applicationsPath+"/applications/{guid}", s.getApplication)
+	s.mux.HandleFunc("POST "+applicationsPath+"/applications", s.postApplication)
+	s.mux.HandleFunc("PUT "+applicationsPath+"/applications/{guid}", s.putApplication)
+	s.mux.HandleFunc("DELETE "+applicationsPath+"/applications/{guid}", s.deleteApplication)
+
+	s.mux.HandleFunc("GET "+applicationsPath+"/collections", s.listCollections)
+	s.mux.HandleFunc("GET "+applicationsPath+"/collections/{guid}", s.getCollection)
+	s.mux.HandleFunc("POST "+applicationsPath+"/collections", s.postCollection)
+	s.mux.HandleFunc("PUT "+applicationsPath+"/collections/{guid}", s.putCollection)
+	s.mux.HandleFunc("DELETE "+applicationsPath+"/collections/{guid}", s.deleteCollection)
+
+	s.mux.HandleFunc("GET "+applicationsPath+"/custom_fields", s.listCustomFields)
+
+	s.mux.HandleFunc("GET "+applicationsPath+"/applications/{guid}/sandboxes", s.listSandboxes)
+	s.mux.HandleFunc("GET "+applicationsPath+"/applications/{guid}/sandboxes/{sguid}", s.getSandbox)
+	s.mux.HandleFunc("POST "+applicationsPath+"/applications/{guid}/sandboxes", s.postSandbox)
+	s.mux.HandleFunc("PUT "+applicationsPath+"/applications/{guid}/sandboxes/{sguid}", s.putSandbox)
+	s.mux.HandleFunc("DELETE "+applicationsPath+"/applications/{guid}/sandboxes/{sguid}", s.deleteSandbox)
+	s.mux.HandleFunc("POST "+applicationsPath+"/applications/{guid}/sandboxes/{sguid}/promote", s.promoteSandbox)
+}
+
+// AddApplication adds an application, as if it was created using the Applications API, and returns the created
+// application. Teams and the business unit of the profile are referenced by their Identity API IDs.
+// AddApplication panics if the application is not valid.
+func (s *Server) AddApplication(app veracode.Application) veracode.Application {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.createApplication(toResource(&app))
+	if err != nil {
+		panic("veracodetest: AddApplication: " + err.Error())
+	}
+	return fromResource[veracode.Application](r)
+}
+
+// AddCollection adds a collection, as if it was created using the Applications API, and returns the created
+// collection. AddCollection panics if the collection is not valid.
+func (s *Server) AddCollection(c veracode.Collection) veracode.Collection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.createCollection(toResource(&c))
+	if err != nil {
+		panic("veracodetest: AddCollection: " + err.Error())
+	}
+	return fromResource[veracode.Collection](r)
+}
+
+// AddSandbox adds a sandbox to the application with applicationGuid and returns the created sandbox.
+// AddSandbox panics if the sandbox is not valid.
+func (s *Server) AddSandbox(applicationGuid string, sandbox veracode.CreateSandbox) veracode.Sandbox {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app, ok := s.applications.get(applicationGuid)
+	if !ok {
+		panic("veracodetest: AddSandbox: application " + applicationGuid + " not found")
+	}
+
+	r, err := s.createSandbox(app, s.users.items[s.selfUserID], toResource(&sandbox))
+	if err != nil {
+		panic("veracodetest: AddSandbox: " + err.Error())
+	}
+	return fromResource[veracode.Sandbox](r)
+}
+
+// AddCustomField adds an application custom field with name.
+func (s *Server) AddCustomField(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.customFields = append(s.customFields, name)
+}
+
+// Applications
+
+func (s *Server) listApplications(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if v := query.Get("legacy_id"); v != "" {
+		if _, err := strconv.Atoi(v); err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrorFormatTitle, "Failed to convert value of type 'java.lang.String' to required type 'java.lang.Integer'; For input string: \""+v+"\"")
+			return
+		}
+	}
+
+	apps := s.applications.list(func(app resource) bool {
+		profile := object(app, "profile")
+
+		if v := query.Get("name"); v != "" && !containsFold(str(profile, "name"), v) {
+			return false
+		}
+		if v := query.Get("legacy_id"); v != "" && strconv.Itoa(num(app, "id")) != v {
+			return false
+		}
+		if v := query.Get("tag"); v != "" && !hasTag(str(profile, "tags"), v) {
+			return false
+		}
+		if v := query.Get("team"); v != "" && !slices.ContainsFunc(objects(profile, "teams"), func(t resource) bool { return strings.EqualFold(str(t, "team_name"), v) }) {
+			return false
+		}
+		if v := query.Get("business_unit"); v != "" && !strings.EqualFold(str(object(profile, "business_unit"), "name"), v) {
+			return false
+		}
+		if v := query.Get("policy_guid"); v != "" && !slices.ContainsFunc(objects(profile, "policies"), func(p resource) bool { return str(p, "guid") == v }) {
+			return false
+		}
+		if v := query.Get("policy_compliance"); v != "" && !slices.ContainsFunc(objects(profile, "policies"), func(p resource) bool { return str(p, "policy_compliance_status") == v }) {
+			return false
+		}
+		return matchesCustomFields(profile, query)
+	})
+
+	writeList(w, r, "applications", apps, ErrorFormatTitle)
+}
+
+// application returns the application with the guid in the path of r, or writes an error response.
+func (s *Server) application(w http.ResponseWriter, r *http.Request) (resource, bool) {
+	guid := r.PathValue("guid")
+	if !isGUID(guid) {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatMessage, "Invalid UUID string: "+guid)
+		return nil, false
+	}
+
+	app, ok := s.applications.get(guid)
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrorFormatAPIErrors, "The requested application could not be found")
+	}
+	return app, ok
+}
+
+func (s *Server) getApplication(w http.ResponseWriter, r *http.Request) {
+	if app, ok := s.application(w, r); ok {
+		writeJSON(w, r, http.StatusOK, app)
+	}
+}
+
+func (s *Server) postApplication(w http.ResponseWriter, r *http.Request) {
+	body, err := decodeBody(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatTitle, err.Error())
+		return
+	}
+
+	app, err := s.createApplication(body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatAPIErrors, err.Error())
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, app)
+}
+
+func (s *Server) putApplication(w http.ResponseWriter, r *http.Request) {
+	app, ok := s.application(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := decodeBody(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatTitle, err.Error())
+		return
+	}
+
+	profile := object(body, "profile")
+	if err := s.validateProfile(profile, str(app, "guid")); err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatAPIErrors, err.Error())
+		return
+	}
+
+	app["profile"] = profile
+	app["modified"] = now().Format(time.RFC3339Nano)
+
+	writeJSON(w, r, http.StatusOK, app)
+}
+
+func (s *Server) deleteApplication(w http.ResponseWriter, r *http.Request) {
+	app, ok := s.application(w, r)
+	if !ok {
+		return
+	}
+
+	s.applications.delete(str(app, "guid"))
+	for _, sandbox := range s.sandboxes.list(func(sb resource) bool { return str(sb, "application_guid") == str(app, "guid") }) {
+		s.sandboxes.delete(str(sandbox, "guid"))
+	}
+	for key := range s.builds {
+		if key.appID == num(app, "id") {
+			delete(s.builds, key)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createApplication validates and stores a new application.
+func (s *Server) createApplication(app resource) (resource, error) {
+	profile := object(app, "profile")
+	if err := s.validateProfile(profile, ""); err != nil {
+		return nil, err
+	}
+
+	id := s.nextID()
+	created := now().Format(time.RFC3339Nano)
+
+	app = resource{
+		"guid":            newGUID(),
+		"id":              id,
+		"oid":             id,
+		"organization_id": organizationID,
+		"created":         created,
+		"modified":        created,
+		"app_profile_url": fmt.Sprintf("HomeAppProfile:%d:%d", id, id),
+		"results_url":     fmt.Sprintf("ViewReportsResultSummary:%d:%d", id, id),
+		"profile":         profile,
+	}
+
+	s.applications.put(str(app, "guid"), app)
+	return app, nil
+}
+
+// validateProfile checks the required fields of an application profile and fills in the names of its teams and
+// business unit. guid is the GUID of the application that is updated, if any.
+func (s *Server) validateProfile(profile resource, guid string) error {
+	if profile == nil || str(profile, "name") == "" {
+		return errors.New("The application profile name must not be empty")
+	}
+	if str(profile, "business_criticality") == "" {
+		return errors.New("The application profile business criticality must not be empty")
+	}
+
+	if _, ok := s.applications.find(func(app resource) bool {
+		return str(app, "guid") != guid && strings.EqualFold(str(object(app, "profile"), "name"), str(profile, "name"))
+	}); ok {
+		return fmt.Errorf("An application profile with the name %s already exists", str(profile, "name"))
+	}
+
+	for _, ref := range objects(profile, "teams") {
+		team, ok := s.teams.get(str(ref, "guid"))
+		if !ok {
+			return fmt.Errorf("The team %s could not be found", str(ref, "guid"))
+		}
+		ref["team_id"] = team["team_legacy_id"]
+		ref["team_name"] = team["team_name"]
+	}
+
+	if ref := object(profile, "business_unit"); ref != nil {
+		bu, ok := s.businessUnits.get(str(ref, "guid"))
+		if !ok {
+			return fmt.Errorf("The business unit %s could not be found", str(ref, "guid"))
+		}
+		ref["id"] = bu["bu_legacy_id"]
+		ref["name"] = bu["bu_name"]
+	}
+
+	return nil
+}
+
+// hasTag reports whether the comma-separated tags contain tag.
+func hasTag(tags, tag string) bool {
+	for _, t := range strings.Split(tags, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesCustomFields reports whether r has the custom field values of the custom_field_names and
+// custom_field_values query parameters.
+func matchesCustomFields(r resource, query url.Values) bool {
+	names, values := query["custom_field_names"], query["custom_field_values"]
+
+	for i, name := range names {
+		if i >= len(values) {
+			break
+		}
+
+		if !slices.ContainsFunc(objects(r, "custom_fields"), func(f resource) bool {
+			return str(f, "name") == name && str(f, "value") == values[i]
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+// Collections
+
+func (s *Server) listCollections(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	collections := s.collections.list(func(c resource) bool {
+		if v := query.Get("name"); v != "" && !containsFold(str(c, "name"), v) {
+			return false
+		}
+		if v := query.Get("business_unit"); v != "" && !containsFold(str(object(c, "business_unit"), "name"), v) {
+			return false
+		}
+		if v := query.Get("tag"); v != "" && !hasTag(str(c, "tags"), v) {
+			return false
+		}
+		return matchesCustomFields(c, query)
+	})
+
+	writeList(w, r, "collections", collections, ErrorFormatTitle)
+}
+
+// collection returns the collection with the guid in the path of r, or writes an error response.
+func (s *Server) collection(w http.ResponseWriter, r *http.Request) (resource, bool) {
+	guid := r.PathValue("guid")
+	if !isGUID(guid) {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatMessage, "Invalid UUID string: "+guid)
+		return nil, false
+	}
+
+	c, ok := s.collections.get(guid)
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrorFormatAPIErrors, "The requested collection could not be found")
+	}
+	return c, ok
+}
+
+func (s *Server) getCollection(w http.ResponseWriter, r *http.Request) {
+	if c, ok := s.collection(w, r); ok {
+		writeJSON(w, r, http.StatusOK, c)
+	}
+}
+
+func (s *Server) postCollection(w http.ResponseWriter, r *http.Request) {
+	body, err := decodeBody(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatTitle, err.Error())
+		return
+	}
+
+	c, err := s.createCollection(body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatTitle, err.Error())
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, c)
+}
+
+func (s *Server) putCollection(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.collection(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := decodeBody(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatTitle, err.Error())
+		return
+	}
+
+	if err := s.validateCollection(body, str(c, "guid")); err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatTitle, err.Error())
+		return
+	}
+
+	body["guid"] = c["guid"]
+	s.collections.put(str(c, "guid"), body)
+
+	writeJSON(w, r, http.StatusOK, body)
+}
+
+func (s *Server) deleteCollection(w http.ResponseWriter, r *http.Request) {
+	if c, ok := s.collection(w, r); ok {
+		s.collections.delete(str(c, "guid"))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// createCollection validates and stores a new collection.
+func (s *Server) createCollection(c resource) (resource, error) {
+	c = clone(c)
+
+	if err := s.validateCollection(c, ""); err != nil {
+		return nil, err
+	}
+
+	c["guid"] = newGUID()
+	s.collections.put(str(c, "guid"), c)
+	return c, nil
+}
+
+// validateCollection checks the required fields of a collection and fills in the name of its business unit. guid is
+// the GUID of the collection that is updated, if any.
+func (s *Server) validateCollection(c resource, guid string) error {
+	if str(c, "name") == "" {
+		return errors.New("The collection name must not be empty")
+	}
+
+	if _, ok := s.collections.find(func(other resource) bool {
+		return str(other, "guid") != guid && strings.EqualFold(str(other, "name"), str(c, "name"))
+	}); ok {
+		return fmt.Errorf("A collection with the name %s already exists", str(c, "name"))
+	}
+
+	if ref := object(c, "business_unit"); ref != nil {
+		bu, ok := s.businessUnits.get(str(ref, "guid"))
+		if !ok {
+			return fmt.Errorf("The business unit %s could not be found", str(ref, "guid"))
+		}
+		ref["id"] = bu["bu_legacy_id"]
+		ref["name"] = bu["bu_name"]
+	}
+
+	for _, asset := range objects(c, "asset_infos") {
+		if _, ok := s.applications.get(str(asset, "guid")); !ok {
+			return fmt.Errorf("The application %s could not be found", str(asset, "guid"))
+		}
+	}
+
+	return nil
+}
+
+// Custom fields
+
+func (s *Server) listCustomFields(w http.ResponseWriter, r *http.Request) {
+	fields := make([]resource, len(s.customFields))
+	for i, name := range s.customFields {
+		fields[i] = resource{"name": name, "sort_order": i + 1}
+	}
+
+	writeList(w, r, "app_custom_field_names", fields, ErrorFormatTitle)
+}
+
+// Sandboxes
+
+func (s *Server) listSandboxes(w http.ResponseWriter, r *http.Request) {
+	app, ok := s.application(w, r)
+	if !ok {
+		return
+	}
+
+	sandboxes := s.sandboxes.list(func(sb resource) bool { return str(sb, "application_guid") == str(app, "guid") })
+	writeList(w, r, "sandboxes", sandboxes, ErrorFormatTitle)
+}
+
+// sandbox returns the sandbox with the sguid in the path of r, or writes an error response.
+func (s *Server) sandbox(w http.ResponseWriter, r *http.Request) (resource, bool) {
+	app, ok := s.application(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	sandbox, ok := s.sandboxes.get(r.PathValue("sguid"))
+	if !ok || str(sandbox, "application_guid") != str(app, "guid") {
+		writeError(w, r, http.StatusNotFound, ErrorFormatAPIErrors, "The requested sandbox could not be found")
+		return nil, false
+	}
+	return sandbox, true
+}
+
+func (s *Server) getSandbox(w http.ResponseWriter, r *http.Request) {
+	if sandbox, ok := s.sandbox(w, r); ok {
+		writeJSON(w, r, http.StatusOK, sandbox)
+	}
+}
+
+func (s *Server) postSandbox(w http.ResponseWriter, r *http.Request) {
+	app, ok := s.application(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := decodeBody(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatTitle, err.Error())
+		return
+	}
+
+	sandbox, err := s.createSandbox(app, s.users.items[self(r)], body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatAPIErrors, err.Error())
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, sandbox)
+}
+
+func (s *Server) putSandbox(w http.ResponseWriter, r *http.Request) {
+	sandbox, ok := s.sandbox(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := decodeBody(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatTitle, err.Error())
+		return
+	}
+
+	if err := s.validateSandbox(body, str(sandbox, "application_guid"), str(sandbox, "guid")); err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatAPIErrors, err.Error())
+		return
+	}
+
+	sandbox["name"] = body["name"]
+	sandbox["auto_recreate"] = boolean(body, "auto_create")
+	sandbox["custom_fields"] = body["custom_fields"]
+	sandbox["modified"] = now().Format(time.RFC3339Nano)
+
+	writeJSON(w, r, http.StatusOK, sandbox)
+}
+
+func (s *Server) deleteSandbox(w http.ResponseWriter, r *http.Request) {
+	if sandbox, ok := s.sandbox(w, r); ok {
+		s.removeSandbox(sandbox)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// promoteSandbox promotes the latest build of the sandbox to a policy build of the application.
+func (s *Server) promoteSandbox(w http.ResponseWriter, r *http.Request) {
+	sandbox, ok := s.sandbox(w, r)
+	if !ok {
+		return
+	}
+
+	app, _ := s.applications.get(str(sandbox, "application_guid"))
+	key := buildKey{appID: num(app, "id"), sandboxID: num(sandbox, "id")}
+
+	if builds := s.builds[key]; len(builds) > 0 {
+		policy := buildKey{appID: key.appID}
+		s.builds[policy] = append(s.builds[policy], builds[len(builds)-1])
+	}
+
+	if r.URL.Query().Get("delete_on_promote") == "true" {
+		s.removeSandbox(sandbox)
+	}
+
+	writeJSON(w, r, http.StatusOK, sandbox)
+}
+
+// createSandbox validates and stores a new sandbox of app that is owned by owner.
+func (s *Server) createSandbox(app, owner, body resource) (resource, error) {
+	if err := s.validateSandbox(body, str(app, "guid"), ""); err != nil {
+		return nil, err
+	}
+
+	created := now().Format(time.RFC3339Nano)
+
+	sandbox := resource{
+		"guid":             newGUID(),
+		"id":               s.nextID(),
+		"application_guid": app["guid"],
+		"name":             body["name"],
+		"auto_recreate":    boolean(body, "auto_create"),
+		"custom_fields":    body["custom_fields"],
+		"organization_id":  organizationID,
+		"owner_username":   str(owner, "user_name"),
+		"created":          created,
+		"modified":         created,
+	}
+
+	s.sandboxes.put(str(sandbox, "guid"), sandbox)
+	return sandbox, nil
+}
+
+// validateSandbox checks the name of a sandbox of the application with appGuid. guid is the GUID of the sandbox that
+// is updated, if any.
+func (s *Server) validateSandbox(body resource, appGuid, guid string) error {
+	if str(body, "name") == "" {
+		return errors.New("The sandbox name must not be empty")
+	}
+
+	if _, ok := s.sandboxes.find(func(sb resource) bool {
+		return str(sb, "application_guid") == appGuid && str(sb, "guid") != guid && strings.EqualFold(str(sb, "name"), str(body, "name"))
+	}); ok {
+		return fmt.Errorf("A sandbox with the name %s already exists", str(body, "name"))
+	}
+
+	return nil
+}
+
+// removeSandbox deletes the sandbox and its builds.
+func (s *Server) removeSandbox(sandbox resource) {
+	app, _ := s.applications.get(str(sandbox, "application_guid"))
+
+	s.sandboxes.delete(str(sandbox, "guid"))
+	delete(s.builds, buildKey{appID: num(app, "id"), sandboxID: num(sandbox, "id")})
+}
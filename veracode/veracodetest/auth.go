@@ -0,0 +1,108 @@
+package veracodetest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/DanCreative/veracode-go/hmac"
+)
+
+const (
+	// credentialLifetime is how long generated API credentials are valid.
+	credentialLifetime = 365 * 24 * time.Hour
+
+	// timestampFormat is the format of the timestamps of the Identity API.
+	timestampFormat = "2006-01-02T15:04:05.000Z0700"
+)
+
+// credential is a pair of API credentials.
+type credential struct {
+	id      string
+	secret  string
+	userID  string
+	expires time.Time
+}
+
+// generateCredentials generates new API credentials for the user with userID. Existing credentials of the user are
+// revoked.
+func (s *Server) generateCredentials(userID string) *credential {
+	s.revokeCredentials(userID)
+
+	id := make([]byte, 16)
+	secret := make([]byte, 64)
+	rand.Read(id)
+	rand.Read(secret)
+
+	cred := &credential{
+		id:      hex.EncodeToString(id),
+		secret:  hex.EncodeToString(secret),
+		userID:  userID,
+		expires: now().Add(credentialLifetime),
+	}
+
+	s.credentials[cred.id] = cred
+	return cred
+}
+
+// revokeCredentials revokes the API credentials of the user with userID and reports whether it had any.
+func (s *Server) revokeCredentials(userID string) bool {
+	var revoked bool
+	for id, cred := range s.credentials {
+		if cred.userID == userID {
+			delete(s.credentials, id)
+			revoked = true
+		}
+	}
+	return revoked
+}
+
+// credentialsOf returns the API credentials of the user with userID.
+func (s *Server) credentialsOf(userID string) *credential {
+	for _, cred := range s.credentials {
+		if cred.userID == userID {
+			return cred
+		}
+	}
+	return nil
+}
+
+// resource returns the API credentials model. The secret is only returned when the credentials are generated.
+func (c *credential) resource(withSecret bool) resource {
+	r := resource{
+		"api_id":        c.id,
+		"expiration_ts": c.expires.Format(timestampFormat),
+		"_links": map[string]any{
+			"self": map[string]any{"href": "/api/authn/v2/api_credentials/" + c.id},
+		},
+	}
+
+	if withSecret {
+		r["api_secret"] = c.secret
+	}
+	return r
+}
+
+// authenticate verifies the VERACODE-HMAC-SHA-256 signature in the Authorization header of r and returns the
+// credentials that were used to sign it. Nonces cannot be reused.
+func (s *Server) authenticate(r *http.Request) (*credential, error) {
+	auth, err := hmac.Verify(r, func(apiKeyID string) (string, error) {
+		cred, ok := s.credentials[apiKeyID]
+		if !ok {
+			return "", fmt.Errorf("%w: %s is unknown or has been revoked", hmac.ErrUnknownKey, apiKeyID)
+		}
+
+		if !now().Before(cred.expires) {
+			return "", fmt.Errorf("API credentials %s have expired", apiKeyID)
+		}
+
+		return cred.secret, nil
+	}, hmac.WithNonceCache(s.nonces))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.credentials[auth.ID], nil
+}
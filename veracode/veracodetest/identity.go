@@ -0,0 +1,947 @@
+package veracodetest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/DanCreative/veracode-go/veracode"
+)
+
+// defaultRoles are the roles of a Veracode organization.
+var defaultRoles = []veracode.Role{
+	{RoleName: "extadmin", RoleDescription: "Administrator", RoleLegacyId: 1, TeamAdminManageable: false},
+	{RoleName: "extcreator", RoleDescription: "Creator", RoleLegacyId: 2, TeamAdminManageable: true},
+	{RoleName: "extexecutive", RoleDescription: "Executive", RoleLegacyId: 3, TeamAdminManageable: true},
+	{RoleName: "extmitigationapprover", RoleDescription: "Mitigation Approver", RoleLegacyId: 4, TeamAdminManageable: true},
+	{RoleName: "extreviewer", RoleDescription: "Reviewer", RoleLegacyId: 5, TeamAdminManageable: true},
+	{RoleName: "extseclead", RoleDescription: "Security Lead", RoleLegacyId: 6, TeamAdminManageable: true},
+	{RoleName: "extsubmitter", RoleDescription: "Submitter", RoleLegacyId: 7, TeamAdminManageable: true, IsScanType: true},
+	{RoleName: "securityinsightsonly", RoleDescription: "Security Insights", RoleLegacyId: 8, TeamAdminManageable: true},
+	{RoleName: "teamAdmin", RoleDescription: "Team Admin", RoleLegacyId: 9},
+	{RoleName: "adminapi", RoleDescription: "Admin API", RoleLegacyId: 10, IsApi: true},
+	{RoleName: "noteamrestrictionapi", RoleDescription: "No Team Restriction API", RoleLegacyId: 11, IsApi: true},
+	{RoleName: "resultsapi", RoleDescription: "Results API", RoleLegacyId: 12, IsApi: true},
+	{RoleName: "uploadapi", RoleDescription: "Upload API - Submit Only", RoleLegacyId: 13, IsApi: true},
+}
+
+const identityPath = "/api/authn/v2"
+
+func (s *Server) routeIdentity() {
+	s.mux.HandleFunc("GET "+identityPath+"/users", s.listUsers)
+	s.mux.HandleFunc("GET "+identityPath+"/users/search", s.searchUsers)
+	s.mux.HandleFunc("GET "+identityPath+"/users/notinteam", s.listUsersNotInTeam)
+	s.mux.HandleFunc("GET "+identityPath+"/users/{id}", s.getUser)
+	s.mux.HandleFunc("POST "+identityPath+"/users", s.postUser)
+	s.mux.HandleFunc("PUT "+identityPath+"/users/{id}", s.putUser)
+	s.mux.HandleFunc("DELETE "+identityPath+"/users/{id}", s.deleteUser)
+
+	s.mux.HandleFunc("GET "+identityPath+"/teams", s.listTeams)
+	s.mux.HandleFunc("GET "+identityPath+"/teams/{id}", s.getTeam)
+	s.mux.HandleFunc("POST "+identityPath+"/teams", s.postTeam)
+	s.mux.HandleFunc("PUT "+identityPath+"/teams/{id}", s.putTeam)
+	s.mux.HandleFunc("DELETE "+identityPath+"/teams/{id}", s.deleteTeam)
+
+	s.mux.HandleFunc("GET "+identityPath+"/business_units", s.listBusinessUnits)
+	s.mux.HandleFunc("GET "+identityPath+"/business_units/{id}", s.getBusinessUnit)
+	s.mux.HandleFunc("POST "+identityPath+"/business_units", s.postBusinessUnit)
+	s.mux.HandleFunc("PUT "+identityPath+"/business_units/{id}", s.putBusinessUnit)
+	s.mux.HandleFunc("DELETE "+identityPath+"/business_units/{id}", s.deleteBusinessUnit)
+
+	s.mux.HandleFunc("GET "+identityPath+"/roles", s.listRoles)
+
+	s.mux.HandleFunc("GET "+identityPath+"/api_credentials", s.getCredentials)
+	s.mux.HandleFunc("POST "+identityPath+"/api_credentials", s.postCredentials)
+	s.mux.HandleFunc("DELETE "+identityPath+"/api_credentials", s.deleteCredentials)
+	s.mux.HandleFunc("GET "+identityPath+"/api_credentials/user_id/{id}", s.getCredentials)
+	s.mux.HandleFunc("POST "+identityPath+"/api_credentials/user_id/{id}", s.postCredentials)
+	s.mux.HandleFunc("DELETE "+identityPath+"/api_credentials/user_id/{id}", s.deleteCredentials)
+	s.mux.HandleFunc("GET "+identityPath+"/api_credentials/{key}", s.getCredentialsByKey)
+	s.mux.HandleFunc("DELETE "+identityPath+"/api_credentials/{key}", s.deleteCredentialsByKey)
+}
+
+// AddUser adds a user, as if it was created using the Identity API, and returns the created user. Roles can be
+// referenced by name and teams by ID. AddUser panics if the user is not valid.
+func (s *Server) AddUser(user veracode.User) veracode.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.createUser(toResource(&user))
+	if err != nil {
+		panic("veracodetest: AddUser: " + err.Error())
+	}
+	return fromResource[veracode.User](r)
+}
+
+// AddTeam adds a team, as if it was created using the Identity API, and returns the created team. Users can be
+// referenced by ID or user name and the business unit by ID or name. AddTeam panics if the team is not valid.
+func (s *Server) AddTeam(team veracode.Team) veracode.Team {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.createTeam(toResource(&team))
+	if err != nil {
+		panic("veracodetest: AddTeam: " + err.Error())
+	}
+	return fromResource[veracode.Team](r)
+}
+
+// AddBusinessUnit adds a business unit, as if it was created using the Identity API, and returns the created
+// business unit. AddBusinessUnit panics if the business unit is not valid.
+func (s *Server) AddBusinessUnit(bu veracode.BusinessUnit) veracode.BusinessUnit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.createBusinessUnit(toResource(&bu))
+	if err != nil {
+		panic("veracodetest: AddBusinessUnit: " + err.Error())
+	}
+	return fromResource[veracode.BusinessUnit](r)
+}
+
+// Users
+
+// userID returns the ID of the user in the path of r. The ID "self" refers to the user that signed r.
+func userID(r *http.Request) string {
+	if id := r.PathValue("id"); id != "self" {
+		return id
+	}
+	return self(r)
+}
+
+func (s *Server) listUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var emails []string
+	if v := query.Get("email_address"); v != "" {
+		emails = strings.Split(v, ",")
+	}
+
+	users := s.users.list(func(u resource) bool {
+		if v := query.Get("user_name"); v != "" && !strings.EqualFold(str(u, "user_name"), v) {
+			return false
+		}
+		if emails != nil && !slices.ContainsFunc(emails, func(e string) bool { return strings.EqualFold(str(u, "email_address"), e) }) {
+			return false
+		}
+		return true
+	})
+
+	s.writeUsers(w, r, users)
+}
+
+func (s *Server) searchUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var errs []string
+	flag := func(name string) *bool {
+		v := query.Get(name)
+		if v == "" {
+			return nil
+		}
+
+		b, err := yesNo(v)
+		if err != nil {
+			errs = append(errs, name+": "+err.Error())
+		}
+		return &b
+	}
+
+	loginEnabled, samlUser := flag("login_enabled"), flag("saml_user")
+
+	if v := query.Get("user_type"); v != "" && !strings.EqualFold(v, "user") && !strings.EqualFold(v, "api") {
+		errs = append(errs, "user_type: Invalid value. Value should be one of: user or api")
+	}
+	if v := query.Get("role_id"); v != "" && !isGUID(v) {
+		errs = append(errs, "role_id: not a valid GUID")
+	}
+	if v := query.Get("team_id"); v != "" && !isGUID(v) {
+		errs = append(errs, "team_id: Invalid value.")
+	}
+
+	if len(errs) > 0 {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatErrors, errs...)
+		return
+	}
+
+	users := s.users.list(func(u resource) bool {
+		if v := query.Get("search_term"); v != "" && !matchesSearchTerm(u, v) {
+			return false
+		}
+		if v := query.Get("role_id"); v != "" && !slices.ContainsFunc(objects(u, "roles"), func(role resource) bool { return str(role, "role_id") == v }) {
+			return false
+		}
+		if v := query.Get("user_type"); v != "" && strings.EqualFold(v, "api") != isAPIUser(u) {
+			return false
+		}
+		if loginEnabled != nil && boolean(u, "login_enabled") != *loginEnabled {
+			return false
+		}
+		if samlUser != nil && boolean(u, "saml_user") != *samlUser {
+			return false
+		}
+		if v := query.Get("team_id"); v != "" && s.members[v][str(u, "user_id")] == "" {
+			return false
+		}
+		if v := query.Get("api_id"); v != "" {
+			if cred, ok := s.credentials[v]; !ok || cred.userID != str(u, "user_id") {
+				return false
+			}
+		}
+		return true
+	})
+
+	s.writeUsers(w, r, users)
+}
+
+func (s *Server) listUsersNotInTeam(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	teamID := query.Get("team_id")
+	if teamID == "" {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatErrors, "team_id: must not be empty")
+		return
+	}
+
+	if _, ok := s.teams.get(teamID); !ok {
+		writeError(w, r, http.StatusNotFound, ErrorFormatMessage, "Team with ID "+teamID+" not found")
+		return
+	}
+
+	users := s.users.list(func(u resource) bool {
+		if v := query.Get("search_term"); v != "" && !matchesSearchTerm(u, v) {
+			return false
+		}
+		return s.members[teamID][str(u, "user_id")] == ""
+	})
+
+	s.writeUsers(w, r, users)
+}
+
+// writeUsers sorts users and writes a page of them.
+func (s *Server) writeUsers(w http.ResponseWriter, r *http.Request, users []resource) {
+	if errs := sortResources(users, r.URL.Query(), "user_name", "first_name", "last_name", "email_address"); errs != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatErrors, errs...)
+		return
+	}
+
+	rendered := make([]resource, len(users))
+	for i, u := range users {
+		rendered[i] = s.renderUser(u)
+	}
+
+	writeList(w, r, "users", rendered, ErrorFormatErrors)
+}
+
+func (s *Server) getUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.users.get(userID(r))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrorFormatMessage, "User with ID "+r.PathValue("id")+" not found")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, s.renderUser(user))
+}
+
+func (s *Server) postUser(w http.ResponseWriter, r *http.Request) {
+	body, err := decodeBody(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatMessage, err.Error())
+		return
+	}
+
+	user, err := s.createUser(body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatMessage, err.Error())
+		return
+	}
+
+	if r.URL.Query().Get("generate_api_creds") == "true" {
+		if !isAPIUser(user) {
+			writeError(w, r, http.StatusBadRequest, ErrorFormatMessage, "API credentials can only be generated for API users")
+			return
+		}
+
+		user["api_credentials"] = s.generateCredentials(str(user, "user_id")).resource(true)
+	}
+
+	writeJSON(w, r, http.StatusOK, user)
+}
+
+func (s *Server) putUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.users.get(userID(r))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrorFormatMessage, "User with ID "+r.PathValue("id")+" not found")
+		return
+	}
+
+	body, err := decodeBody(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatMessage, err.Error())
+		return
+	}
+
+	if err := s.resolveUser(body); err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatMessage, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	partial, incremental := query.Get("partial") == "true", query.Get("incremental") == "true"
+
+	teams, hasTeams := body["teams"]
+	delete(body, "teams")
+	delete(body, "user_id")
+	delete(body, "legacy_user_id")
+	delete(body, "relationship")
+
+	if !partial {
+		updated := resource{"user_id": user["user_id"], "legacy_user_id": user["legacy_user_id"], "user_type": user["user_type"]}
+		merge(updated, body, false)
+		user = updated
+	} else {
+		merge(user, body, incremental)
+	}
+	s.users.put(str(user, "user_id"), user)
+
+	if hasTeams || !partial {
+		s.setUserTeams(str(user, "user_id"), objects(resource{"teams": teams}, "teams"), incremental)
+	}
+
+	writeJSON(w, r, http.StatusOK, s.renderUser(user))
+}
+
+func (s *Server) deleteUser(w http.ResponseWriter, r *http.Request) {
+	id := userID(r)
+	if !s.users.delete(id) {
+		writeError(w, r, http.StatusNotFound, ErrorFormatMessage, "User with ID "+r.PathValue("id")+" not found")
+		return
+	}
+
+	for _, members := range s.members {
+		delete(members, id)
+	}
+	s.revokeCredentials(id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createUser validates and stores a new user and returns the rendered user.
+func (s *Server) createUser(user resource) (resource, error) {
+	user = clone(user)
+
+	if str(user, "email_address") == "" {
+		return nil, errors.New("email_address: must not be empty")
+	}
+	if str(user, "user_name") == "" {
+		user["user_name"] = user["email_address"]
+	}
+	if _, ok := s.users.find(func(u resource) bool { return strings.EqualFold(str(u, "user_name"), str(user, "user_name")) }); ok {
+		return nil, fmt.Errorf("User name %s is already in use", str(user, "user_name"))
+	}
+
+	if err := s.resolveUser(user); err != nil {
+		return nil, err
+	}
+
+	teams := objects(user, "teams")
+	delete(user, "teams")
+	delete(user, "relationship")
+
+	user["user_id"] = newGUID()
+	user["legacy_user_id"] = strconv.Itoa(s.nextID())
+	for _, key := range []string{"active", "login_enabled"} {
+		if _, ok := user[key]; !ok {
+			user[key] = true
+		}
+	}
+	if _, ok := user["saml_user"]; !ok {
+		user["saml_user"] = false
+	}
+	if slices.ContainsFunc(objects(user, "permissions"), func(p resource) bool { return str(p, "permission_name") == "apiUser" }) {
+		user["user_type"] = "API"
+	} else if str(user, "user_type") == "" {
+		user["user_type"] = "VOSP"
+	}
+
+	s.users.put(str(user, "user_id"), user)
+	s.setUserTeams(str(user, "user_id"), teams, false)
+
+	return s.renderUser(user), nil
+}
+
+// resolveUser replaces the roles of user, which can be referenced by ID or name, with the roles of the Server and
+// checks that its teams exist.
+func (s *Server) resolveUser(user resource) error {
+	if _, ok := user["roles"]; ok {
+		var roles []resource
+		for _, ref := range objects(user, "roles") {
+			role, ok := s.roles.find(func(role resource) bool {
+				return (str(ref, "role_id") != "" && str(role, "role_id") == str(ref, "role_id")) || (str(ref, "role_id") == "" && str(role, "role_name") == str(ref, "role_name"))
+			})
+			if !ok {
+				return fmt.Errorf("Invalid role: %s%s", str(ref, "role_id"), str(ref, "role_name"))
+			}
+
+			roles = append(roles, resource{
+				"role_id":          role["role_id"],
+				"role_name":        role["role_name"],
+				"role_description": role["role_description"],
+			})
+		}
+		user["roles"] = array(roles)
+	}
+
+	for _, ref := range objects(user, "teams") {
+		if _, ok := s.teams.get(str(ref, "team_id")); !ok {
+			return fmt.Errorf("Invalid team: %s", str(ref, "team_id"))
+		}
+	}
+
+	return nil
+}
+
+// setUserTeams sets the teams of the user with id. If incremental is true, the user is added to the teams, instead
+// of replacing its existing teams.
+func (s *Server) setUserTeams(id string, teams []resource, incremental bool) {
+	if !incremental {
+		for _, members := range s.members {
+			delete(members, id)
+		}
+	}
+
+	for _, team := range teams {
+		s.addMember(str(team, "team_id"), id, str(object(team, "relationship"), "name"))
+	}
+}
+
+// addMember adds the user to the team, with relationship "MEMBER" or "ADMIN".
+func (s *Server) addMember(teamID, userID, relationship string) {
+	if relationship == "" {
+		relationship = "MEMBER"
+	}
+
+	if s.members[teamID] == nil {
+		s.members[teamID] = make(map[string]string)
+	}
+	s.members[teamID][userID] = relationship
+}
+
+// renderUser returns user with its teams.
+func (s *Server) renderUser(user resource) resource {
+	user = clone(user)
+
+	var teams []resource
+	for _, team := range s.teams.list(nil) {
+		if relationship := s.members[str(team, "team_id")][str(user, "user_id")]; relationship != "" {
+			teams = append(teams, resource{
+				"team_id":        team["team_id"],
+				"team_legacy_id": team["team_legacy_id"],
+				"team_name":      team["team_name"],
+				"relationship":   map[string]any{"name": relationship},
+			})
+		}
+	}
+
+	if teams != nil {
+		user["teams"] = array(teams)
+	}
+	return user
+}
+
+// isAPIUser reports whether user is an API service account.
+func isAPIUser(user resource) bool {
+	return strings.EqualFold(str(user, "user_type"), "API")
+}
+
+// matchesSearchTerm reports whether the user name, first name, last name or email address of user contain term.
+func matchesSearchTerm(user resource, term string) bool {
+	for _, key := range []string{"user_name", "first_name", "last_name", "email_address"} {
+		if containsFold(str(user, key), term) {
+			return true
+		}
+	}
+	return false
+}
+
+// Teams
+
+func (s *Server) listTeams(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	teams := s.teams.list(func(t resource) bool {
+		if query.Get("deleted") == "true" {
+			return false
+		}
+		if v := query.Get("team_name"); v != "" && !containsFold(str(t, "team_name"), v) {
+			return false
+		}
+		if r.URL.Path == identityPath+"/teams/self" && s.members[str(t, "team_id")][self(r)] == "" {
+			return false
+		}
+		return true
+	})
+
+	if errs := sortResources(teams, query, "team_name"); errs != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatErrors, errs...)
+		return
+	}
+
+	rendered := make([]resource, len(teams))
+	for i, t := range teams {
+		rendered[i] = s.renderTeam(t, false)
+	}
+
+	writeList(w, r, "teams", rendered, ErrorFormatErrors)
+}
+
+func (s *Server) getTeam(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("id") == "self" {
+		s.listTeams(w, r)
+		return
+	}
+
+	team, ok := s.teams.get(r.PathValue("id"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrorFormatMessage, "Team with ID "+r.PathValue("id")+" not found")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, s.renderTeam(team, true))
+}
+
+func (s *Server) postTeam(w http.ResponseWriter, r *http.Request) {
+	body, err := decodeBody(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatMessage, err.Error())
+		return
+	}
+
+	team, err := s.createTeam(body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatMessage, err.Error())
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, team)
+}
+
+func (s *Server) putTeam(w http.ResponseWriter, r *http.Request) {
+	team, ok := s.teams.get(r.PathValue("id"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrorFormatMessage, "Team with ID "+r.PathValue("id")+" not found")
+		return
+	}
+
+	body, err := decodeBody(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatMessage, err.Error())
+		return
+	}
+
+	users, err := s.resolveTeam(body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatMessage, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	partial, incremental := query.Get("partial") == "true", query.Get("incremental") == "true"
+
+	_, hasUsers := body["users"]
+	for _, key := range []string{"users", "team_id", "team_legacy_id", "relationship"} {
+		delete(body, key)
+	}
+
+	if !partial && str(body, "team_name") == "" {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatMessage, "team_name: must not be empty")
+		return
+	}
+
+	merge(team, body, false)
+
+	if hasUsers || !partial {
+		teamID := str(team, "team_id")
+		if !incremental {
+			delete(s.members, teamID)
+		}
+		for _, u := range users {
+			s.addMember(teamID, str(u, "user_id"), str(object(u, "relationship"), "name"))
+		}
+	}
+
+	writeJSON(w, r, http.StatusOK, s.renderTeam(team, true))
+}
+
+func (s *Server) deleteTeam(w http.ResponseWriter, r *http.Request) {
+	if !s.teams.delete(r.PathValue("id")) {
+		writeError(w, r, http.StatusNotFound, ErrorFormatMessage, "Team with ID "+r.PathValue("id")+" not found")
+		return
+	}
+
+	delete(s.members, r.PathValue("id"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createTeam validates and stores a new team and returns the rendered team.
+func (s *Server) createTeam(team resource) (resource, error) {
+	team = clone(team)
+
+	if str(team, "team_name") == "" {
+		return nil, errors.New("team_name: must not be empty")
+	}
+	if _, ok := s.teams.find(func(t resource) bool { return strings.EqualFold(str(t, "team_name"), str(team, "team_name")) }); ok {
+		return nil, fmt.Errorf("Team with name %s already exists", str(team, "team_name"))
+	}
+
+	users, err := s.resolveTeam(team)
+	if err != nil {
+		return nil, err
+	}
+
+	if team["business_unit"] == nil {
+		bu, _ := s.businessUnits.find(func(bu resource) bool { return boolean(bu, "is_default") })
+		team["business_unit"] = map[string]any{"bu_id": str(bu, "bu_id")}
+	}
+
+	delete(team, "users")
+	delete(team, "relationship")
+	team["team_id"] = newGUID()
+	team["team_legacy_id"] = s.nextID()
+
+	s.teams.put(str(team, "team_id"), team)
+	for _, u := range users {
+		s.addMember(str(team, "team_id"), str(u, "user_id"), str(object(u, "relationship"), "name"))
+	}
+
+	return s.renderTeam(team, true), nil
+}
+
+// resolveTeam resolves the business unit of team, which can be referenced by ID or name, and returns its users,
+// which can be referenced by ID or user name, with their IDs.
+func (s *Server) resolveTeam(team resource) ([]resource, error) {
+	if ref := object(team, "business_unit"); ref != nil {
+		bu, ok := s.businessUnits.find(func(bu resource) bool {
+			return (str(ref, "bu_id") != "" && str(bu, "bu_id") == str(ref, "bu_id")) || (str(ref, "bu_id") == "" && str(bu, "bu_name") == str(ref, "bu_name"))
+		})
+		if !ok {
+			return nil, fmt.Errorf("Invalid business unit: %s%s", str(ref, "bu_id"), str(ref, "bu_name"))
+		}
+
+		team["business_unit"] = map[string]any{"bu_id": bu["bu_id"]}
+	}
+
+	var users []resource
+	for _, ref := range objects(team, "users") {
+		user, ok := s.users.find(func(u resource) bool {
+			return (str(ref, "user_id") != "" && str(u, "user_id") == str(ref, "user_id")) || (str(ref, "user_id") == "" && strings.EqualFold(str(u, "user_name"), str(ref, "user_name")))
+		})
+		if !ok {
+			return nil, fmt.Errorf("Invalid user: %s%s", str(ref, "user_id"), str(ref, "user_name"))
+		}
+
+		users = append(users, resource{"user_id": user["user_id"], "relationship": ref["relationship"]})
+	}
+
+	return users, nil
+}
+
+// renderTeam returns team with its business unit and, if detailed is true, its users.
+func (s *Server) renderTeam(team resource, detailed bool) resource {
+	team = clone(team)
+
+	if bu, ok := s.businessUnits.get(str(object(team, "business_unit"), "bu_id")); ok {
+		team["business_unit"] = map[string]any{
+			"bu_id":        bu["bu_id"],
+			"bu_legacy_id": bu["bu_legacy_id"],
+			"bu_name":      bu["bu_name"],
+		}
+	} else {
+		delete(team, "business_unit")
+	}
+
+	if detailed {
+		users := []resource{}
+		for _, user := range s.users.list(nil) {
+			if relationship := s.members[str(team, "team_id")][str(user, "user_id")]; relationship != "" {
+				users = append(users, resource{
+					"user_id":      user["user_id"],
+					"user_name":    user["user_name"],
+					"first_name":   user["first_name"],
+					"last_name":    user["last_name"],
+					"relationship": map[string]any{"name": relationship},
+				})
+			}
+		}
+		team["users"] = array(users)
+	}
+
+	return team
+}
+
+// Business units
+
+func (s *Server) listBusinessUnits(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	bus := s.businessUnits.list(func(bu resource) bool {
+		v := query.Get("search_term")
+		return v == "" || containsFold(str(bu, "bu_name"), v)
+	})
+
+	if errs := sortResources(bus, query, "bu_name"); errs != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatErrors, errs...)
+		return
+	}
+
+	writeList(w, r, "business_units", bus, ErrorFormatErrors)
+}
+
+func (s *Server) getBusinessUnit(w http.ResponseWriter, r *http.Request) {
+	bu, ok := s.businessUnits.get(r.PathValue("id"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrorFormatMessage, "Business unit with ID "+r.PathValue("id")+" not found")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, s.renderBusinessUnit(bu))
+}
+
+func (s *Server) postBusinessUnit(w http.ResponseWriter, r *http.Request) {
+	body, err := decodeBody(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatMessage, err.Error())
+		return
+	}
+
+	// Only the default business unit of the Server is the default.
+	delete(body, "is_default")
+
+	bu, err := s.createBusinessUnit(body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatMessage, err.Error())
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, bu)
+}
+
+func (s *Server) putBusinessUnit(w http.ResponseWriter, r *http.Request) {
+	bu, ok := s.businessUnits.get(r.PathValue("id"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrorFormatMessage, "Business unit with ID "+r.PathValue("id")+" not found")
+		return
+	}
+
+	body, err := decodeBody(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatMessage, err.Error())
+		return
+	}
+
+	if r.URL.Query().Get("partial") != "true" && str(body, "bu_name") == "" {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatMessage, "bu_name: must not be empty")
+		return
+	}
+
+	teams, err := s.resolveBusinessUnitTeams(body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatMessage, err.Error())
+		return
+	}
+
+	for _, key := range []string{"teams", "bu_id", "bu_legacy_id", "is_default"} {
+		delete(body, key)
+	}
+
+	merge(bu, body, false)
+	for _, team := range teams {
+		team["business_unit"] = map[string]any{"bu_id": bu["bu_id"]}
+	}
+
+	writeJSON(w, r, http.StatusOK, s.renderBusinessUnit(bu))
+}
+
+func (s *Server) deleteBusinessUnit(w http.ResponseWriter, r *http.Request) {
+	bu, ok := s.businessUnits.get(r.PathValue("id"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrorFormatMessage, "Business unit with ID "+r.PathValue("id")+" not found")
+		return
+	}
+
+	if boolean(bu, "is_default") {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatMessage, "The default business unit cannot be deleted")
+		return
+	}
+
+	s.businessUnits.delete(str(bu, "bu_id"))
+
+	// The teams of the deleted business unit are moved to the default business unit.
+	def, _ := s.businessUnits.find(func(bu resource) bool { return boolean(bu, "is_default") })
+	for _, team := range s.teams.list(nil) {
+		if str(object(team, "business_unit"), "bu_id") == str(bu, "bu_id") {
+			team["business_unit"] = map[string]any{"bu_id": def["bu_id"]}
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createBusinessUnit validates and stores a new business unit and returns the rendered business unit.
+func (s *Server) createBusinessUnit(bu resource) (resource, error) {
+	bu = clone(bu)
+
+	if str(bu, "bu_name") == "" {
+		return nil, errors.New("bu_name: must not be empty")
+	}
+	if _, ok := s.businessUnits.find(func(b resource) bool { return strings.EqualFold(str(b, "bu_name"), str(bu, "bu_name")) }); ok {
+		return nil, fmt.Errorf("Business unit with name %s already exists", str(bu, "bu_name"))
+	}
+
+	teams, err := s.resolveBusinessUnitTeams(bu)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(bu, "teams")
+	bu["bu_id"] = newGUID()
+	bu["bu_legacy_id"] = s.nextID()
+	if _, ok := bu["is_default"]; !ok {
+		bu["is_default"] = false
+	}
+
+	s.businessUnits.put(str(bu, "bu_id"), bu)
+	for _, team := range teams {
+		team["business_unit"] = map[string]any{"bu_id": bu["bu_id"]}
+	}
+
+	return s.renderBusinessUnit(bu), nil
+}
+
+// resolveBusinessUnitTeams returns the stored teams that are referenced by ID in the teams of bu.
+func (s *Server) resolveBusinessUnitTeams(bu resource) ([]resource, error) {
+	var teams []resource
+	for _, ref := range objects(bu, "teams") {
+		team, ok := s.teams.get(str(ref, "team_id"))
+		if !ok {
+			return nil, fmt.Errorf("Invalid team: %s", str(ref, "team_id"))
+		}
+		teams = append(teams, team)
+	}
+	return teams, nil
+}
+
+// renderBusinessUnit returns bu with its teams.
+func (s *Server) renderBusinessUnit(bu resource) resource {
+	bu = clone(bu)
+
+	teams := []resource{}
+	for _, team := range s.teams.list(nil) {
+		if str(object(team, "business_unit"), "bu_id") == str(bu, "bu_id") {
+			teams = append(teams, resource{
+				"team_id":        team["team_id"],
+				"team_legacy_id": team["team_legacy_id"],
+				"team_name":      team["team_name"],
+			})
+		}
+	}
+
+	bu["teams"] = array(teams)
+	return bu
+}
+
+// Roles
+
+func (s *Server) listRoles(w http.ResponseWriter, r *http.Request) {
+	roles := s.roles.list(nil)
+
+	if errs := sortResources(roles, r.URL.Query(), "role_name", "role_description"); errs != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatErrors, errs...)
+		return
+	}
+
+	writeList(w, r, "roles", roles, ErrorFormatErrors)
+}
+
+// API credentials
+
+// credentialsUser returns the user of an API credentials request: either the user in the path or the user that
+// signed r.
+func (s *Server) credentialsUser(w http.ResponseWriter, r *http.Request) (resource, bool) {
+	id := r.PathValue("id")
+	if id == "" {
+		id = self(r)
+	}
+
+	user, ok := s.users.get(id)
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrorFormatMessage, "User with ID "+id+" not found")
+	}
+	return user, ok
+}
+
+func (s *Server) getCredentials(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.credentialsUser(w, r)
+	if !ok {
+		return
+	}
+
+	cred := s.credentialsOf(str(user, "user_id"))
+	if cred == nil {
+		writeError(w, r, http.StatusNotFound, ErrorFormatMessage, "No API credentials found for user "+str(user, "user_name"))
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, cred.resource(false))
+}
+
+func (s *Server) postCredentials(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.credentialsUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !isAPIUser(user) {
+		writeError(w, r, http.StatusBadRequest, ErrorFormatMessage, "API credentials can only be generated for API users")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, s.generateCredentials(str(user, "user_id")).resource(true))
+}
+
+func (s *Server) deleteCredentials(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.credentialsUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !s.revokeCredentials(str(user, "user_id")) {
+		writeError(w, r, http.StatusNotFound, ErrorFormatMessage, "No API credentials found for user "+str(user, "user_name"))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getCredentialsByKey(w http.ResponseWriter, r *http.Request) {
+	cred, ok := s.credentials[r.PathValue("key")]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrorFormatMessage, "API credentials "+r.PathValue("key")+" not found")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, cred.resource(false))
+}
+
+func (s *Server) deleteCredentialsByKey(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.credentials[r.PathValue("key")]; !ok {
+		writeError(w, r, http.StatusNotFound, ErrorFormatMessage, "API credentials "+r.PathValue("key")+" not found")
+		return
+	}
+
+	delete(s.credentials, r.PathValue("key"))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,362 @@
+// Package veracodetest provides an in-memory fake of the Veracode APIs for integration tests.
+//
+// A Server implements the Identity API (users, teams, business units, roles and API credentials), the Applications
+// API (applications, collections, custom fields and sandboxes) and the getbuildinfo.do and getbuildlist.do XML APIs.
+// It verifies the HMAC signature of every request using [hmac.Verify], supports the paging and filter query parameters
+// of the real APIs and returns error bodies in the formats that the Veracode APIs use:
+//
+//	srv := veracodetest.NewServer()
+//	defer srv.Close()
+//
+//	client, err := srv.Client()
+//	...
+//	srv.AddTeam(veracode.Team{TeamName: "Team A"})
+//	teams, _, err := client.Identity.ListTeams(ctx, veracode.ListTeamOptions{})
+package veracodetest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DanCreative/veracode-go/hmac"
+	"github.com/DanCreative/veracode-go/veracode"
+)
+
+// ErrorFormat is the format of an error response body. The Veracode APIs return errors in different formats,
+// all of which are decoded by [veracode.Error].
+type ErrorFormat int
+
+const (
+	// ErrorFormatMessage is the general format of the Identity API:
+	//	{"http_code": 404, "http_status": "Not Found", "message": "..."}
+	ErrorFormatMessage ErrorFormat = iota
+
+	// ErrorFormatOAuth is the format of authentication errors:
+	//	{"error": "unauthorized", "error_description": "..."}
+	ErrorFormatOAuth
+
+	// ErrorFormatTitle is the format of single errors of the Applications API:
+	//	{"id": "...", "code": "BAD_REQUEST", "title": "...", "status": "400", "source": {...}}
+	ErrorFormatTitle
+
+	// ErrorFormatErrors is the format of invalid query values of the Identity API:
+	//	{"errors": ["team_id: Invalid value."], "status": 400}
+	ErrorFormatErrors
+
+	// ErrorFormatAPIErrors is the general format of the Applications API:
+	//	{"_embedded": {"api_errors": [{"id": "...", "code": "NOT_FOUND", "title": "...", ...}]}}
+	ErrorFormatAPIErrors
+
+	// ErrorFormatXML is the format of the XML APIs:
+	//	<error>...</error>
+	ErrorFormatXML
+)
+
+// Server is a fake of the Veracode APIs, which keeps its state in memory. A Server is safe for concurrent use.
+type Server struct {
+	// URL is the base URL of the REST and XML APIs, for example "http://127.0.0.1:54321".
+	URL string
+
+	// APIKeyID and APIKeySecret are the API credentials of the user that the Server was started with. Requests must
+	// be signed with these or with other credentials that were generated using the API.
+	APIKeyID     string
+	APIKeySecret string
+
+	server *httptest.Server
+	mux    *http.ServeMux
+	nonces *hmac.MemoryNonceCache
+
+	mu            sync.Mutex
+	selfUserID    string
+	credentials   map[string]*credential // By API ID.
+	users         *collection
+	teams         *collection
+	businessUnits *collection
+	roles         *collection
+	members       map[string]map[string]string // Team ID to user ID to relationship.
+	applications  *collection
+	collections   *collection
+	sandboxes     *collection
+	customFields  []string
+	builds        map[buildKey][]veracode.BuildDetailed
+	failures      []failure
+	lastID        int // Last legacy ID that was assigned.
+}
+
+// failure is an error response that is returned for the next matching request. See [Server.FailNext].
+type failure struct {
+	method  string
+	path    string
+	status  int
+	format  ErrorFormat
+	message string
+}
+
+// NewServer starts and returns a new Server. The caller should call Close when finished, to shut it down.
+//
+// The Server contains the default roles of the Veracode platform, a default business unit named "Not Specified"
+// and the API user whose credentials are in APIKeyID and APIKeySecret.
+func NewServer() *Server {
+	s := &Server{
+		credentials:   make(map[string]*credential),
+		users:         newCollection(),
+		teams:         newCollection(),
+		businessUnits: newCollection(),
+		roles:         newCollection(),
+		members:       make(map[string]map[string]string),
+		applications:  newCollection(),
+		collections:   newCollection(),
+		sandboxes:     newCollection(),
+		builds:        make(map[buildKey][]veracode.BuildDetailed),
+		mux:           http.NewServeMux(),
+		nonces:        hmac.NewMemoryNonceCache(),
+	}
+
+	s.routeIdentity()
+	s.routeApplications()
+	s.routeXML()
+	s.mux.HandleFunc("GET /healthcheck/status", func(w http.ResponseWriter, r *http.Request) {})
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, http.StatusNotFound, defaultFormat(r), "No resource found for "+r.URL.Path)
+	})
+
+	s.seed()
+
+	s.server = httptest.NewServer(s)
+	s.URL = s.server.URL
+
+	return s
+}
+
+// seed adds the default roles, business unit and API user.
+func (s *Server) seed() {
+	for _, role := range defaultRoles {
+		role.RoleId = newGUID()
+		s.roles.put(role.RoleId, toResource(&role))
+	}
+
+	isDefault := true
+	s.AddBusinessUnit(veracode.BusinessUnit{BuName: "Not Specified", IsDefault: &isDefault})
+
+	user, err := s.createUser(toResource(veracode.NewAPIUser("veracodetest", "veracodetest@example.com", "Veracode", "Test", nil)))
+	if err != nil {
+		panic("veracodetest: failed to create the API user: " + err.Error())
+	}
+
+	s.selfUserID = str(user, "user_id")
+	cred := s.generateCredentials(s.selfUserID)
+	s.APIKeyID, s.APIKeySecret = cred.id, cred.secret
+}
+
+// Close shuts down the Server and blocks until all outstanding requests have completed.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Client returns a new Client that sends its requests to the Server and signs them with the credentials of the
+// Server. The options are applied after the base URLs have been set.
+func (s *Server) Client(opts ...veracode.ClientOption) (*veracode.Client, error) {
+	return veracode.New(s.APIKeyID, s.APIKeySecret, append([]veracode.ClientOption{veracode.WithBaseURLs(s.URL, s.URL)}, opts...)...)
+}
+
+// FailNext makes the next request with method and path fail with status and an error body in format. The path does
+// not include the query, for example "/api/authn/v2/users". Requests fail in the order in which FailNext was called.
+func (s *Server) FailNext(method, path string, status int, format ErrorFormat, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = append(s.failures, failure{method: method, path: path, status: status, format: format, message: message})
+}
+
+// ServeHTTP is required to implement the http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := slices.IndexFunc(s.failures, func(f failure) bool { return f.method == r.Method && f.path == r.URL.Path }); i >= 0 {
+		f := s.failures[i]
+		s.failures = slices.Delete(s.failures, i, i+1)
+
+		writeError(w, r, f.status, f.format, f.message)
+		return
+	}
+
+	if r.URL.Path != "/healthcheck/status" {
+		cred, err := s.authenticate(r)
+		if err != nil {
+			format := ErrorFormatOAuth
+			if isXML(r) {
+				format = ErrorFormatXML
+			}
+
+			writeError(w, r, http.StatusUnauthorized, format, err.Error())
+			return
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), credentialKey{}, cred))
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+type credentialKey struct{}
+
+// self returns the ID of the user whose credentials were used to sign r.
+func self(r *http.Request) string {
+	cred, _ := r.Context().Value(credentialKey{}).(*credential)
+	if cred == nil {
+		return ""
+	}
+	return cred.userID
+}
+
+// nextID returns a new legacy ID.
+func (s *Server) nextID() int {
+	s.lastID++
+	return s.lastID
+}
+
+// newGUID returns a new random version 4 UUID.
+func newGUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+var guidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// isGUID reports whether s is a valid UUID.
+func isGUID(s string) bool {
+	return guidRe.MatchString(s)
+}
+
+// isXML reports whether r is a request to the XML APIs.
+func isXML(r *http.Request) bool {
+	return strings.HasSuffix(r.URL.Path, ".do")
+}
+
+// isApplicationsAPI reports whether r is a request to the Applications API.
+func isApplicationsAPI(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/appsec/")
+}
+
+// defaultFormat returns the error format of the API that r was sent to.
+func defaultFormat(r *http.Request) ErrorFormat {
+	switch {
+	case isXML(r):
+		return ErrorFormatXML
+	case isApplicationsAPI(r):
+		return ErrorFormatAPIErrors
+	default:
+		return ErrorFormatMessage
+	}
+}
+
+// writeJSON writes v as the JSON response body. The Applications API includes the charset in the Content-Type.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	contentType := "application/json"
+	if isApplicationsAPI(r) {
+		contentType = "application/json;charset=UTF-8"
+	}
+
+	buf, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	w.Write(buf)
+}
+
+// writeXML writes v as the XML response body. The XML APIs always respond with status 200.
+func writeXML(w http.ResponseWriter, v any) {
+	buf, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.Write([]byte(xml.Header))
+	w.Write(buf)
+}
+
+// writeError writes an error response with an error body in format. Every message is returned as a separate error
+// in the formats that support multiple errors.
+func writeError(w http.ResponseWriter, r *http.Request, status int, format ErrorFormat, messages ...string) {
+	message := strings.Join(messages, " ")
+	code := strings.ToUpper(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+
+	apiError := func(title string) map[string]any {
+		return map[string]any{
+			"id":     newGUID(),
+			"code":   code,
+			"title":  title,
+			"status": fmt.Sprint(status),
+			"source": map[string]any{"pointer": r.URL.Path, "parameter": nil},
+		}
+	}
+
+	switch format {
+	case ErrorFormatOAuth:
+		writeJSON(w, r, status, map[string]any{
+			"error":             strings.ToLower(code),
+			"error_description": message,
+		})
+
+	case ErrorFormatTitle:
+		writeJSON(w, r, status, apiError(message))
+
+	case ErrorFormatErrors:
+		writeJSON(w, r, status, map[string]any{"errors": messages, "status": status})
+
+	case ErrorFormatAPIErrors:
+		apiErrors := make([]any, len(messages))
+		for i, m := range messages {
+			apiErrors[i] = apiError(m)
+		}
+
+		writeJSON(w, r, status, map[string]any{
+			"_embedded":     map[string]any{"api_errors": apiErrors},
+			"fallback_type": nil,
+			"full_type":     nil,
+		})
+
+	case ErrorFormatXML:
+		var sb strings.Builder
+		xml.EscapeText(&sb, []byte(message))
+
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "%s<error>%s</error>\n", xml.Header, sb.String())
+
+	default:
+		writeJSON(w, r, status, map[string]any{
+			"http_code":   status,
+			"http_status": http.StatusText(status),
+			"message":     message,
+		})
+	}
+}
+
+// now returns the current time, truncated to milliseconds like the timestamps of the Veracode APIs.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
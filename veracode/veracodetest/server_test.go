@@ -0,0 +1,332 @@
+package veracodetest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DanCreative/veracode-go/veracode"
+)
+
+func newTestClient(t *testing.T) (*Server, *veracode.Client) {
+	t.Helper()
+
+	srv := NewServer()
+	t.Cleanup(srv.Close)
+
+	client, err := srv.Client(veracode.WithRetryPolicy(veracode.NoRetryPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return srv, client
+}
+
+func TestServer_Identity(t *testing.T) {
+	ctx := context.Background()
+	srv, client := newTestClient(t)
+
+	bu := srv.AddBusinessUnit(veracode.BusinessUnit{BuName: "Engineering"})
+
+	team, _, err := client.Identity.CreateTeam(ctx, &veracode.Team{TeamName: "Team A", BusinessUnit: &veracode.BusinessUnit{BuId: bu.BuId}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if team.TeamId == "" || team.BusinessUnit == nil || team.BusinessUnit.BuName != "Engineering" {
+		t.Fatalf("unexpected team: %+v", team)
+	}
+
+	for _, name := range []string{"dave", "alice", "carol", "bob", "erin"} {
+		user := veracode.NewUser(name+"@example.com", name, "Test")
+		if name == "alice" || name == "bob" {
+			user.Teams = &[]veracode.Team{{TeamId: team.TeamId, Relationship: veracode.TeamRelationship{Name: "ADMIN"}}}
+		}
+
+		if _, _, err := client.Identity.CreateUser(ctx, user, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Paging and sorting.
+	users, resp, err := client.Identity.ListAllUsers(ctx, veracode.ListUserOptions{
+		PageOptions: veracode.PageOptions{Size: 2, Sort: []veracode.SortQueryField{{Name: "userName"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, u := range users {
+		names = append(names, u.UserName)
+	}
+
+	expected := []string{"alice@example.com", "bob@example.com", "carol@example.com", "dave@example.com", "erin@example.com", "veracodetest"}
+	if !slices.Equal(names, expected) {
+		t.Errorf("ListAllUsers returned %v, expected %v", names, expected)
+	}
+	if resp.Page.TotalElements != 6 || resp.Page.TotalPages != 3 || resp.Page.Number != 2 {
+		t.Errorf("unexpected page meta: %+v", resp.Page)
+	}
+
+	// Filters.
+	members, _, err := client.Identity.SearchUsers(ctx, veracode.SearchUserOptions{TeamId: team.TeamId, SearchTerm: "ALI"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0].UserName != "alice@example.com" {
+		t.Fatalf("SearchUsers returned %+v", members)
+	}
+	if members[0].Teams == nil || (*members[0].Teams)[0].Relationship.Name != "ADMIN" {
+		t.Errorf("user is not a team admin: %+v", members[0].Teams)
+	}
+
+	apiUsers, _, err := client.Identity.SearchUsers(ctx, veracode.SearchUserOptions{UserType: "api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apiUsers) != 1 || apiUsers[0].UserName != "veracodetest" {
+		t.Errorf("SearchUsers returned %+v", apiUsers)
+	}
+
+	notInTeam, _, err := client.Identity.ListUsersNotInTeam(ctx, veracode.NotInTeamOptions{TeamId: team.TeamId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notInTeam) != 4 {
+		t.Errorf("ListUsersNotInTeam returned %d users, expected 4", len(notInTeam))
+	}
+
+	// Incremental update of the team members.
+	partial, incremental := true, true
+	_, _, err = client.Identity.UpdateTeam(ctx, &veracode.Team{TeamId: team.TeamId, Users: &[]veracode.User{{UserName: "carol@example.com"}}}, veracode.UpdateOptions{Partial: &partial, Incremental: &incremental})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	team, _, err = client.Identity.GetTeam(ctx, team.TeamId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if team.Users == nil || len(*team.Users) != 3 || team.TeamName != "Team A" {
+		t.Errorf("unexpected team after update: %+v", team)
+	}
+
+	// Roles are resolved by name.
+	self, _, err := client.Identity.SelfGetUser(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if self.Roles == nil || (*self.Roles)[0].RoleId == "" {
+		t.Errorf("roles of the API user were not resolved: %+v", self.Roles)
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	ctx := context.Background()
+	srv, client := newTestClient(t)
+
+	app := srv.AddApplication(veracode.NewApplication("App", "", veracode.High))
+
+	tests := []struct {
+		name         string
+		setup        func()
+		call         func() error
+		wantCode     int
+		wantMessages []string
+	}{
+		{
+			name:         "message",
+			call:         func() error { _, _, err := client.Identity.GetTeam(ctx, "abcd"); return err },
+			wantCode:     http.StatusNotFound,
+			wantMessages: []string{"Team with ID abcd not found"},
+		},
+		{
+			name: "errors",
+			call: func() error {
+				_, _, err := client.Identity.SearchUsers(ctx, veracode.SearchUserOptions{RoleId: "abcd", TeamId: "efgh"})
+				return err
+			},
+			wantCode:     http.StatusBadRequest,
+			wantMessages: []string{"role_id: not a valid GUID", "team_id: Invalid value."},
+		},
+		{
+			name: "api errors",
+			call: func() error {
+				_, _, err := client.Application.GetApplication(ctx, "00000000-0000-4000-8000-000000000000")
+				return err
+			},
+			wantCode:     http.StatusNotFound,
+			wantMessages: []string{"The requested application could not be found"},
+		},
+		{
+			name:         "title",
+			call:         func() error { _, _, err := client.Application.CreateCollection(ctx, veracode.Collection{}); return err },
+			wantCode:     http.StatusBadRequest,
+			wantMessages: []string{"The collection name must not be empty"},
+		},
+		{
+			name: "oauth",
+			setup: func() {
+				srv.FailNext(http.MethodGet, "/api/authn/v2/roles", http.StatusForbidden, ErrorFormatOAuth, "access denied")
+			},
+			call:         func() error { _, _, err := client.Identity.ListRoles(ctx, veracode.PageOptions{}); return err },
+			wantCode:     http.StatusForbidden,
+			wantMessages: []string{"forbidden", "access denied"},
+		},
+		{
+			name: "xml",
+			call: func() error {
+				_, _, err := client.UploadXML.GetBuildInfo(ctx, veracode.BuildInfoOptions{AppId: app.Id})
+				return err
+			},
+			wantCode:     http.StatusOK,
+			wantMessages: []string{"Could not find a build for application=" + strconv.Itoa(app.Id)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.setup != nil {
+				tt.setup()
+			}
+
+			var verr veracode.Error
+			if err := tt.call(); !errors.As(err, &verr) {
+				t.Fatalf("expected a veracode.Error, got: %v", err)
+			}
+
+			if verr.Code != tt.wantCode || !slices.Equal(verr.Messages, tt.wantMessages) {
+				t.Errorf("got code %d and messages %q, expected %d and %q", verr.Code, verr.Messages, tt.wantCode, tt.wantMessages)
+			}
+		})
+	}
+}
+
+func TestServer_Authentication(t *testing.T) {
+	ctx := context.Background()
+	srv, client := newTestClient(t)
+
+	wrong, err := veracode.New(srv.APIKeyID, strings.Repeat("0", 128), veracode.WithBaseURLs(srv.URL, srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var verr veracode.Error
+	if _, _, err := wrong.Identity.ListRoles(ctx, veracode.PageOptions{}); !errors.As(err, &verr) || verr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected an unauthorized error, got: %v", err)
+	}
+
+	// Generating new credentials revokes the current credentials.
+	creds, _, err := client.Identity.SelfGenerateCredentials(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.ExpirationTs.Before(time.Now()) {
+		t.Errorf("unexpected expiration: %s", creds.ExpirationTs)
+	}
+
+	if _, _, err := client.Identity.ListRoles(ctx, veracode.PageOptions{}); !errors.As(err, &verr) || verr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected an unauthorized error, got: %v", err)
+	}
+
+	if err := client.UpdateCredentials(creds.ApiId, creds.ApiSecret); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := client.Identity.ListRoles(ctx, veracode.PageOptions{}); err != nil {
+		t.Fatalf("request with the new credentials failed: %v", err)
+	}
+}
+
+func TestServer_Applications(t *testing.T) {
+	ctx := context.Background()
+	srv, client := newTestClient(t)
+
+	team := srv.AddTeam(veracode.Team{TeamName: "Team A"})
+	srv.AddCustomField("Owner")
+
+	for _, name := range []string{"Alpha", "Beta", "Gamma"} {
+		app := veracode.NewApplication(name, "", veracode.Medium)
+		app.Profile.Teams = []veracode.ApplicationTeam{{Guid: team.TeamId}}
+		app.Profile.CustomFields = []veracode.CustomField{{Name: "Owner", Value: name + "-owner"}}
+
+		if _, _, err := client.Application.CreateApplication(ctx, app); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	options := veracode.ListApplicationOptions{Team: "Team A"}
+	options.AddCustomFieldOption("Owner", "Beta-owner")
+
+	apps, _, err := client.Application.ListApplications(ctx, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 1 || apps[0].Profile.Name != "Beta" || apps[0].Profile.Teams[0].TeamName != "Team A" {
+		t.Fatalf("ListApplications returned %+v", apps)
+	}
+	app := apps[0]
+
+	fields, _, err := client.Application.ListCustomFields(ctx, veracode.ListCustomFieldOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 1 || fields[0].Name != "Owner" {
+		t.Errorf("ListCustomFields returned %+v", fields)
+	}
+
+	sandbox, _, err := client.Sandbox.CreateSandbox(ctx, app.Guid, veracode.CreateSandbox{Name: "feature"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sandbox.OwnerUsername != "veracodetest" || sandbox.ApplicationGuid != app.Guid {
+		t.Errorf("unexpected sandbox: %+v", sandbox)
+	}
+
+	if _, _, err := client.Sandbox.CreateSandbox(ctx, app.Guid, veracode.CreateSandbox{Name: "Feature"}); err == nil {
+		t.Error("expected an error for a duplicate sandbox name")
+	}
+
+	// Builds are polled until the results are ready.
+	build := srv.PutBuild(app.Id, sandbox.Id, veracode.BuildDetailed{Version: "1.0", AnalysisUnit: veracode.AnalysisUnit{Status: "Scan In Process"}})
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		build.ResultsReady = true
+		build.AnalysisUnit.Status = "Results Ready"
+		srv.PutBuild(app.Id, sandbox.Id, build)
+	}()
+
+	info, _, err := client.UploadXML.WaitForBuild(ctx, veracode.BuildInfoOptions{AppId: app.Id, SandboxId: sandbox.Id}, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.BuildId != build.BuildId || info.Build.AnalysisUnit.Status != "Results Ready" {
+		t.Errorf("unexpected build info: %+v", info)
+	}
+
+	if _, _, err := client.Sandbox.PromoteSandbox(ctx, app.Guid, sandbox.Guid, true); err != nil {
+		t.Fatal(err)
+	}
+
+	list, _, err := client.UploadXML.GetBuildList(ctx, veracode.BuildListOptions{AppId: app.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.AppName != "Beta" || len(list.Builds) != 1 || list.Builds[0].BuildId != build.BuildId {
+		t.Errorf("unexpected build list: %+v", list)
+	}
+
+	sandboxes, _, err := client.Sandbox.ListSandboxes(ctx, app.Guid, veracode.PageOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sandboxes) != 0 {
+		t.Errorf("sandbox was not deleted on promotion: %+v", sandboxes)
+	}
+}
@@ -0,0 +1,388 @@
+package veracodetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// resource is the JSON representation of an entity. Resources are stored as generic maps, so that they are returned
+// in the same shape as by the Veracode APIs, regardless of how the models of the veracode package marshal them.
+type resource = map[string]any
+
+// collection stores resources in the order in which they were created.
+type collection struct {
+	ids   []string
+	items map[string]resource
+}
+
+func newCollection() *collection {
+	return &collection{items: make(map[string]resource)}
+}
+
+func (c *collection) get(id string) (resource, bool) {
+	r, ok := c.items[id]
+	return r, ok
+}
+
+// put adds or replaces the resource with id.
+func (c *collection) put(id string, r resource) {
+	if _, ok := c.items[id]; !ok {
+		c.ids = append(c.ids, id)
+	}
+	c.items[id] = r
+}
+
+// delete removes the resource with id and reports whether it existed.
+func (c *collection) delete(id string) bool {
+	if _, ok := c.items[id]; !ok {
+		return false
+	}
+
+	delete(c.items, id)
+	c.ids = slices.DeleteFunc(c.ids, func(v string) bool { return v == id })
+	return true
+}
+
+// list returns the resources for which match returns true, in the order in which they were created. A nil match
+// returns all resources.
+func (c *collection) list(match func(resource) bool) []resource {
+	var r []resource
+	for _, id := range c.ids {
+		if match == nil || match(c.items[id]) {
+			r = append(r, c.items[id])
+		}
+	}
+	return r
+}
+
+// find returns the first resource for which match returns true.
+func (c *collection) find(match func(resource) bool) (resource, bool) {
+	for _, id := range c.ids {
+		if match(c.items[id]) {
+			return c.items[id], true
+		}
+	}
+	return nil, false
+}
+
+// toResource converts a model of the veracode package to a resource.
+func toResource(v any) resource {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		panic("veracodetest: failed to encode model: " + err.Error())
+	}
+
+	r, err := decodeResource(buf)
+	if err != nil {
+		panic("veracodetest: failed to decode model: " + err.Error())
+	}
+	return r
+}
+
+// fromResource converts a resource to a model of the veracode package.
+func fromResource[T any](r resource) T {
+	var v T
+
+	buf, err := json.Marshal(r)
+	if err == nil {
+		err = json.Unmarshal(buf, &v)
+	}
+	if err != nil {
+		panic("veracodetest: failed to convert resource: " + err.Error())
+	}
+
+	return v
+}
+
+// decodeResource decodes a JSON object. The team relationships, which the models of the veracode package send as
+// strings, are converted to the object that the Veracode APIs return.
+func decodeResource(buf []byte) (resource, error) {
+	var r resource
+	if err := json.Unmarshal(buf, &r); err != nil {
+		return nil, err
+	}
+	if r == nil {
+		r = resource{}
+	}
+
+	normalize(r)
+	return r, nil
+}
+
+// decodeBody decodes the JSON body of r. An empty body is decoded as an empty resource.
+func decodeBody(r *http.Request) (resource, error) {
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r.Body); err != nil {
+		return nil, err
+	}
+
+	if buf.Len() == 0 {
+		return resource{}, nil
+	}
+
+	body, err := decodeResource(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("JSON parse error: %w", err)
+	}
+	return body, nil
+}
+
+func normalize(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if name, ok := value.(string); ok && key == "relationship" {
+				v[key] = map[string]any{"name": name}
+				continue
+			}
+			normalize(value)
+		}
+	case []any:
+		for _, value := range v {
+			normalize(value)
+		}
+	}
+}
+
+// str returns the string value of key.
+func str(r resource, key string) string {
+	s, _ := r[key].(string)
+	return s
+}
+
+// num returns the numeric value of key.
+func num(r resource, key string) int {
+	switch v := r[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case string:
+		n, _ := strconv.Atoi(v)
+		return n
+	}
+	return 0
+}
+
+// boolean returns the boolean value of key.
+func boolean(r resource, key string) bool {
+	b, _ := r[key].(bool)
+	return b
+}
+
+// object returns the object value of key.
+func object(r resource, key string) resource {
+	o, _ := r[key].(map[string]any)
+	return o
+}
+
+// objects returns the objects in the array value of key.
+func objects(r resource, key string) []resource {
+	values, _ := r[key].([]any)
+
+	var o []resource
+	for _, v := range values {
+		if m, ok := v.(map[string]any); ok {
+			o = append(o, m)
+		}
+	}
+	return o
+}
+
+// array converts resources to a JSON array value.
+func array(resources []resource) []any {
+	a := make([]any, len(resources))
+	for i, r := range resources {
+		a[i] = r
+	}
+	return a
+}
+
+// containsFold reports whether substr is within s, ignoring case.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// yesNo parses the "Yes" and "No" values of the Identity API filters.
+func yesNo(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes", "true":
+		return true, nil
+	case "no", "false":
+		return false, nil
+	default:
+		return false, fmt.Errorf("Invalid value %q. Value should be one of: Yes or No", value)
+	}
+}
+
+// merge copies the fields of src to dst. If incremental is true, the items of list fields are added to the existing
+// items instead of replacing them.
+func merge(dst, src resource, incremental bool) {
+	for key, value := range src {
+		existing, isList := dst[key].([]any)
+		added, ok := value.([]any)
+
+		if incremental && isList && ok {
+			list := slices.Clone(existing)
+			for _, item := range added {
+				if !slices.ContainsFunc(list, func(v any) bool { return reflect.DeepEqual(v, item) }) {
+					list = append(list, item)
+				}
+			}
+
+			dst[key] = list
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// clone returns a shallow copy of r.
+func clone(r resource) resource {
+	return maps.Clone(r)
+}
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// pageParams returns the page number and size of a list request.
+func pageParams(query url.Values) (page, size int, errs []string) {
+	page, size = 0, defaultPageSize
+
+	if v := query.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			errs = append(errs, "page: must be a number greater than or equal to 0")
+		}
+		page = n
+	}
+
+	if v := query.Get("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			errs = append(errs, fmt.Sprintf("size: must be a number between 1 and %d", maxPageSize))
+		}
+		size = n
+	}
+
+	return page, size, errs
+}
+
+// sortResources sorts resources by the "sort" query values, for example "userName,desc". Sort fields are written in
+// camelCase and must be one of fields, which are the snake_case names of the sortable fields.
+func sortResources(resources []resource, query url.Values, fields ...string) []string {
+	type sortField struct {
+		name string
+		desc bool
+	}
+
+	var sorts []sortField
+	var errs []string
+
+	for _, value := range query["sort"] {
+		name, direction, _ := strings.Cut(value, ",")
+		name = snakeCase(name)
+
+		if !slices.Contains(fields, name) {
+			errs = append(errs, fmt.Sprintf("sort: No property '%s' found. Sortable properties are: %s", value, strings.Join(fields, ", ")))
+			continue
+		}
+		sorts = append(sorts, sortField{name: name, desc: strings.EqualFold(direction, "desc")})
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	slices.SortStableFunc(resources, func(a, b resource) int {
+		for _, s := range sorts {
+			c := strings.Compare(strings.ToLower(fmt.Sprint(a[s.name])), strings.ToLower(fmt.Sprint(b[s.name])))
+			if s.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+
+	return nil
+}
+
+// snakeCase converts a camelCase name to snake_case.
+func snakeCase(name string) string {
+	var sb strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				sb.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// writeList writes a page of resources, embedded under key, with the paging links and metadata of the Veracode APIs.
+// Invalid paging parameters are reported in format.
+func writeList(w http.ResponseWriter, r *http.Request, key string, resources []resource, format ErrorFormat) {
+	page, size, errs := pageParams(r.URL.Query())
+	if len(errs) > 0 {
+		writeError(w, r, http.StatusBadRequest, format, errs...)
+		return
+	}
+
+	total := len(resources)
+	totalPages := int(math.Ceil(float64(total) / float64(size)))
+
+	start := min(page*size, total)
+	end := min(start+size, total)
+
+	link := func(page int) map[string]any {
+		u := url.URL{Scheme: "http", Host: r.Host, Path: r.URL.Path}
+
+		query := r.URL.Query()
+		query.Set("page", strconv.Itoa(page))
+		query.Set("size", strconv.Itoa(size))
+		u.RawQuery = query.Encode()
+
+		return map[string]any{"href": u.String()}
+	}
+
+	links := map[string]any{"self": link(page)}
+	if totalPages > 0 {
+		links["first"] = link(0)
+		links["last"] = link(totalPages - 1)
+	}
+	if page+1 < totalPages {
+		links["next"] = link(page + 1)
+	}
+	if page > 0 && page-1 < totalPages {
+		links["prev"] = link(page - 1)
+	}
+
+	writeJSON(w, r, http.StatusOK, map[string]any{
+		"_embedded": map[string]any{key: array(resources[start:end])},
+		"_links":    links,
+		"page": map[string]any{
+			"number":         page,
+			"size":           size,
+			"total_elements": total,
+			"total_pages":    totalPages,
+		},
+	})
+}
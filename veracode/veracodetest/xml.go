@@ -0,0 +1,131 @@
+package veracodetest
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/DanCreative/veracode-go/veracode"
+)
+
+const xmlPath = "/api/5.0"
+
+// buildKey identifies the builds of an application or one of its sandboxes. The sandboxID of policy builds is 0.
+type buildKey struct {
+	appID     int
+	sandboxID int
+}
+
+func (s *Server) routeXML() {
+	s.mux.HandleFunc("GET "+xmlPath+"/getbuildlist.do", s.getBuildList)
+	s.mux.HandleFunc("GET "+xmlPath+"/getbuildinfo.do", s.getBuildInfo)
+}
+
+// PutBuild adds a build to an application, or to one of its sandboxes if sandboxID is not 0, and returns it. The
+// application and sandbox are identified by their legacy IDs ([veracode.Application.Id] and [veracode.Sandbox.Id]).
+//
+// If build.BuildId is empty, a new ID is assigned. If the application already has a build with the same ID, that
+// build is replaced, which allows tests to change the status of a build while it is being polled.
+func (s *Server) PutBuild(appID, sandboxID int, build veracode.BuildDetailed) veracode.BuildDetailed {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if build.BuildId == "" {
+		build.BuildId = strconv.Itoa(s.nextID())
+	}
+
+	key := buildKey{appID: appID, sandboxID: sandboxID}
+	if i := slices.IndexFunc(s.builds[key], func(b veracode.BuildDetailed) bool { return b.BuildId == build.BuildId }); i >= 0 {
+		s.builds[key][i] = build
+	} else {
+		s.builds[key] = append(s.builds[key], build)
+	}
+
+	return build
+}
+
+// buildApplication returns the application and builds that are identified by the app_id and sandbox_id parameters
+// of r, or writes an error response.
+func (s *Server) buildApplication(w http.ResponseWriter, r *http.Request) (resource, []veracode.BuildDetailed, bool) {
+	query := r.URL.Query()
+
+	appID, err := strconv.Atoi(query.Get("app_id"))
+	if err != nil {
+		writeError(w, r, http.StatusOK, ErrorFormatXML, "Invalid or missing parameter: app_id")
+		return nil, nil, false
+	}
+
+	app, ok := s.applications.find(func(app resource) bool { return num(app, "id") == appID })
+	if !ok {
+		writeError(w, r, http.StatusOK, ErrorFormatXML, "Could not find an application with app_id="+query.Get("app_id"))
+		return nil, nil, false
+	}
+
+	var sandboxID int
+	if v := query.Get("sandbox_id"); v != "" {
+		sandboxID, _ = strconv.Atoi(v)
+
+		if _, ok := s.sandboxes.find(func(sb resource) bool {
+			return num(sb, "id") == sandboxID && str(sb, "application_guid") == str(app, "guid")
+		}); !ok {
+			writeError(w, r, http.StatusOK, ErrorFormatXML, "Could not find a sandbox with sandbox_id="+v)
+			return nil, nil, false
+		}
+	}
+
+	return app, s.builds[buildKey{appID: appID, sandboxID: sandboxID}], true
+}
+
+func (s *Server) getBuildList(w http.ResponseWriter, r *http.Request) {
+	app, builds, ok := s.buildApplication(w, r)
+	if !ok {
+		return
+	}
+
+	list := veracode.BuildList{
+		BuildListVersion: "1.6",
+		AccountId:        strconv.Itoa(organizationID),
+		AppId:            strconv.Itoa(num(app, "id")),
+		AppName:          str(object(app, "profile"), "name"),
+	}
+
+	for _, build := range builds {
+		list.Builds = append(list.Builds, veracode.BuildSummary{
+			BuildId:           build.BuildId,
+			Version:           build.Version,
+			PolicyUpdatedDate: build.PolicyUpdatedDate,
+		})
+	}
+
+	writeXML(w, list)
+}
+
+func (s *Server) getBuildInfo(w http.ResponseWriter, r *http.Request) {
+	app, builds, ok := s.buildApplication(w, r)
+	if !ok {
+		return
+	}
+
+	if len(builds) == 0 {
+		writeError(w, r, http.StatusOK, ErrorFormatXML, "Could not find a build for application="+strconv.Itoa(num(app, "id")))
+		return
+	}
+
+	build := builds[len(builds)-1]
+	if v := r.URL.Query().Get("build_id"); v != "" {
+		i := slices.IndexFunc(builds, func(b veracode.BuildDetailed) bool { return b.BuildId == v })
+		if i < 0 {
+			writeError(w, r, http.StatusOK, ErrorFormatXML, "Could not find a build with build_id="+v)
+			return
+		}
+		build = builds[i]
+	}
+
+	writeXML(w, veracode.BuildInfo{
+		BuildInfoVersion: "1.5",
+		AccountId:        strconv.Itoa(organizationID),
+		AppId:            strconv.Itoa(num(app, "id")),
+		BuildId:          build.BuildId,
+		Build:            build,
+	})
+}